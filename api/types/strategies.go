@@ -0,0 +1,70 @@
+package types
+
+import "fmt"
+
+// Ordering is how the order modules are installed in is carried by an export
+type Ordering string
+
+const (
+	// OrderingNone exports modules as is
+	OrderingNone Ordering = "none"
+	// OrderingNumbered prefixes the directory of each module with its wave, such as 01-auth/dex
+	OrderingNumbered Ordering = "numbered"
+	// OrderingSyncWaves annotates every resource with the wave of its module as an Argo CD sync wave
+	OrderingSyncWaves Ordering = "sync-waves"
+)
+
+// ParseOrdering returns the ordering matching s. An empty string returns OrderingNone.
+func ParseOrdering(s string) (Ordering, error) {
+	switch Ordering(s) {
+	case "":
+		return OrderingNone, nil
+	case OrderingNone, OrderingNumbered, OrderingSyncWaves:
+		return Ordering(s), nil
+	}
+	return "", fmt.Errorf("unknown ordering %q, must be one of %s, %s or %s", s, OrderingNone, OrderingNumbered, OrderingSyncWaves)
+}
+
+// MissingDependencies is what is done about modules depended on but not declared
+type MissingDependencies string
+
+const (
+	// MissingFail fails the build
+	MissingFail MissingDependencies = "fail"
+	// MissingAdd adds the module depended on, at the version given by the dependency
+	MissingAdd MissingDependencies = "add"
+)
+
+// ParseMissingDependencies returns the strategy matching s. An empty string returns MissingFail.
+func ParseMissingDependencies(s string) (MissingDependencies, error) {
+	switch MissingDependencies(s) {
+	case "":
+		return MissingFail, nil
+	case MissingFail, MissingAdd:
+		return MissingDependencies(s), nil
+	}
+	return "", fmt.Errorf("unknown strategy for missing dependencies %q, must be one of %s or %s", s, MissingFail, MissingAdd)
+}
+
+// ConflictStrategy is how resources emitted by several modules deployed together are resolved
+type ConflictStrategy string
+
+const (
+	// ConflictFail fails the build
+	ConflictFail ConflictStrategy = "fail"
+	// ConflictFirstWins keeps the resource of the module declared first
+	ConflictFirstWins ConflictStrategy = "first-wins"
+	// ConflictMergeIfIdentical keeps one of the resources if they are identical and fails otherwise
+	ConflictMergeIfIdentical ConflictStrategy = "merge-if-identical"
+)
+
+// ParseConflictStrategy returns the strategy matching s. An empty string returns ConflictMergeIfIdentical.
+func ParseConflictStrategy(s string) (ConflictStrategy, error) {
+	switch ConflictStrategy(s) {
+	case "":
+		return ConflictMergeIfIdentical, nil
+	case ConflictFail, ConflictFirstWins, ConflictMergeIfIdentical:
+		return ConflictStrategy(s), nil
+	}
+	return "", fmt.Errorf("unknown conflict strategy %q, must be one of %s, %s or %s", s, ConflictFail, ConflictFirstWins, ConflictMergeIfIdentical)
+}
@@ -0,0 +1,51 @@
+// Package types holds the in-memory representation of the banana file used throughout banana.
+// It always refers to the latest version of the format. Older versions are converted into it when read.
+package types
+
+import "github.com/middlewaregruppen/banana/api/v1beta1"
+
+const (
+	// Kind is the kind of a banana file
+	Kind = v1beta1.Kind
+
+	// APIVersion is the latest api version of a banana file
+	APIVersion = v1beta1.APIVersion
+
+	// ModuleMetadataKind is the kind of a module metadata file
+	ModuleMetadataKind = v1beta1.ModuleMetadataKind
+)
+
+type (
+	Age                 = v1beta1.Age
+	ArgoCD              = v1beta1.ArgoCD
+	ArgoCDAutomatedSync = v1beta1.ArgoCDAutomatedSync
+	ArgoCDSyncPolicy    = v1beta1.ArgoCDSyncPolicy
+	BananaFile          = v1beta1.BananaFile
+	Cluster             = v1beta1.Cluster
+	Component           = v1beta1.Component
+	Conflicts           = v1beta1.Conflicts
+	Dependencies        = v1beta1.Dependencies
+	Export              = v1beta1.Export
+	ExternalSecrets     = v1beta1.ExternalSecrets
+	FieldSpec           = v1beta1.FieldSpec
+	Flux                = v1beta1.Flux
+	FluxSourceRef       = v1beta1.FluxSourceRef
+	Host                = v1beta1.Host
+	Image               = v1beta1.Image
+	ImageRegistry       = v1beta1.ImageRegistry
+	Ingress             = v1beta1.Ingress
+	Module              = v1beta1.Module
+	ModuleDependency    = v1beta1.ModuleDependency
+	ModuleMetadata      = v1beta1.ModuleMetadata
+	ModuleOption        = v1beta1.ModuleOption
+	ModuleOpts          = v1beta1.ModuleOpts
+	ModuleSecret        = v1beta1.ModuleSecret
+	Namespace           = v1beta1.Namespace
+	ObjectMeta          = v1beta1.ObjectMeta
+	Patch               = v1beta1.Patch
+	PatchTarget         = v1beta1.PatchTarget
+	SealedSecrets       = v1beta1.SealedSecrets
+	Secret              = v1beta1.Secret
+	SecretStoreRef      = v1beta1.SecretStoreRef
+	TypeMeta            = v1beta1.TypeMeta
+)
@@ -0,0 +1,6 @@
+package v1alpha1
+
+type Age struct {
+	// Recipients is a list of age recipients
+	Recipients []string `json:"recipients,omitempty" yaml:"recipients,omitempty"`
+}
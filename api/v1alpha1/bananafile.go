@@ -1,4 +1,4 @@
-package types
+package v1alpha1
 
 type BananaFile struct {
 	TypeMeta `json:",inline" yaml:",inline"`
@@ -18,4 +18,10 @@ type BananaFile struct {
 
 	// Age controls age-specific attributes
 	Age *Age `json:"age,omitempty" yaml:"age,omitempty"`
+
+	// SealedSecrets converts secrets into Bitnami SealedSecrets instead of encrypting them with sops
+	SealedSecrets *SealedSecrets `json:"sealedSecrets,omitempty" yaml:"sealedSecrets,omitempty"`
+
+	// ExternalSecrets configures how secrets referencing external values are fetched by the cluster
+	ExternalSecrets *ExternalSecrets `json:"externalSecrets,omitempty" yaml:"externalSecrets,omitempty"`
 }
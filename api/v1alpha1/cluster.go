@@ -1,4 +1,4 @@
-package types
+package v1alpha1
 
 type Cluster struct {
 	MetaData *ObjectMeta `json:"metadata,omitempty" yaml:"metadata,omitempty"`
@@ -1,4 +1,4 @@
-package types
+package v1alpha1
 
 type Component struct {
 	// Name is the name of this component
@@ -0,0 +1,207 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/middlewaregruppen/banana/api/v1beta1"
+)
+
+// secretRefPrefix is the prefix of v1alpha1 secret values referencing an external secret store
+const secretRefPrefix = "ref+"
+
+// ConvertTo converts this banana file into the v1beta1 hub version
+func (src *BananaFile) ConvertTo(dst *v1beta1.BananaFile) error {
+	dst.Kind = src.Kind
+	dst.APIVersion = v1beta1.APIVersion
+	dst.MetaData = convertObjectMetaTo(src.MetaData)
+	dst.Name = src.Name
+	dst.Version = src.Version
+	dst.Age = (*v1beta1.Age)(src.Age)
+	dst.SealedSecrets = (*v1beta1.SealedSecrets)(src.SealedSecrets)
+	if src.ExternalSecrets != nil {
+		dst.ExternalSecrets = &v1beta1.ExternalSecrets{
+			SecretStoreRef:  v1beta1.SecretStoreRef(src.ExternalSecrets.SecretStoreRef),
+			RefreshInterval: src.ExternalSecrets.RefreshInterval,
+		}
+	}
+
+	dst.Clusters = nil
+	for _, c := range src.Clusters {
+		if c == nil {
+			continue
+		}
+		dst.Clusters = append(dst.Clusters, &v1beta1.Cluster{
+			MetaData: convertObjectMetaTo(c.MetaData),
+			Name:     c.Name,
+			Version:  c.Version,
+			Ingress:  (*v1beta1.Ingress)(c.Ingress),
+		})
+	}
+
+	dst.Modules = nil
+	for _, m := range src.Modules {
+		mod := v1beta1.Module{
+			MetaData:  convertObjectMetaTo(m.MetaData),
+			Name:      m.Name,
+			Version:   m.Version,
+			Ref:       m.Ref,
+			Namespace: m.Namespace,
+			Opts:      v1beta1.ModuleOpts(m.Opts),
+			Hosts:     (*v1beta1.Host)(m.Hosts),
+		}
+		for _, c := range m.Components {
+			mod.Components = append(mod.Components, v1beta1.Component{Name: c})
+		}
+		for _, s := range m.Secrets {
+			sec, err := ConvertSecret(s)
+			if err != nil {
+				return err
+			}
+			mod.Secrets = append(mod.Secrets, sec)
+		}
+		dst.Modules = append(dst.Modules, mod)
+	}
+	return nil
+}
+
+// ConvertFrom converts the v1beta1 hub version into this banana file. An error is returned
+// if the hub holds settings that cannot be represented in v1alpha1.
+func (dst *BananaFile) ConvertFrom(src *v1beta1.BananaFile) error {
+	if src.Export != nil {
+		return fmt.Errorf("export is not supported in %s", APIVersion)
+	}
+	if src.ImageRegistry != nil || len(src.ImageFieldSpecs) > 0 {
+		return fmt.Errorf("imageRegistry and imageFieldSpecs are not supported in %s", APIVersion)
+	}
+	if src.PinImageDigests {
+		return fmt.Errorf("pinImageDigests is not supported in %s", APIVersion)
+	}
+	if len(src.Namespaces) > 0 {
+		return fmt.Errorf("namespaces is not supported in %s", APIVersion)
+	}
+	if src.Conflicts != nil {
+		return fmt.Errorf("conflicts is not supported in %s", APIVersion)
+	}
+	if src.Dependencies != nil {
+		return fmt.Errorf("dependencies is not supported in %s", APIVersion)
+	}
+	dst.Kind = src.Kind
+	dst.APIVersion = APIVersion
+	meta, err := convertObjectMetaFrom(src.MetaData)
+	if err != nil {
+		return err
+	}
+	dst.MetaData = meta
+	dst.Name = src.Name
+	dst.Version = src.Version
+	dst.Age = (*Age)(src.Age)
+	dst.SealedSecrets = (*SealedSecrets)(src.SealedSecrets)
+	if src.ExternalSecrets != nil {
+		dst.ExternalSecrets = &ExternalSecrets{
+			SecretStoreRef:  SecretStoreRef(src.ExternalSecrets.SecretStoreRef),
+			RefreshInterval: src.ExternalSecrets.RefreshInterval,
+		}
+	}
+
+	dst.Clusters = nil
+	for _, c := range src.Clusters {
+		if c == nil {
+			continue
+		}
+		if len(c.Modules) > 0 {
+			return fmt.Errorf("cluster %s: module overrides are not supported in %s", c.Name, APIVersion)
+		}
+		meta, err := convertObjectMetaFrom(c.MetaData)
+		if err != nil {
+			return fmt.Errorf("cluster %s: %w", c.Name, err)
+		}
+		dst.Clusters = append(dst.Clusters, &Cluster{
+			MetaData: meta,
+			Name:     c.Name,
+			Version:  c.Version,
+			Ingress:  (*Ingress)(c.Ingress),
+		})
+	}
+
+	dst.Modules = nil
+	for _, m := range src.Modules {
+		meta, err := convertObjectMetaFrom(m.MetaData)
+		if err != nil {
+			return fmt.Errorf("module %s: %w", m.Name, err)
+		}
+		mod := Module{
+			MetaData:  meta,
+			Name:      m.Name,
+			Version:   m.Version,
+			Ref:       m.Ref,
+			Namespace: m.Namespace,
+			Opts:      ModuleOpts(m.Opts),
+			Hosts:     (*Host)(m.Hosts),
+		}
+		if len(m.Patches) > 0 {
+			return fmt.Errorf("module %s: patches are not supported in %s", m.Name, APIVersion)
+		}
+		if len(m.Images) > 0 {
+			return fmt.Errorf("module %s: images are not supported in %s", m.Name, APIVersion)
+		}
+		for _, c := range m.Components {
+			if len(c.Version) > 0 && c.Version != m.Version {
+				return fmt.Errorf("module %s: component versions are not supported in %s", m.Name, APIVersion)
+			}
+			mod.Components = append(mod.Components, c.Name)
+		}
+		for _, s := range m.Secrets {
+			v := s.Value
+			if len(s.Ref) > 0 {
+				v = secretRefPrefix + s.Ref
+			}
+			mod.Secrets = append(mod.Secrets, fmt.Sprintf("%s=%s", s.Key, v))
+		}
+		dst.Modules = append(dst.Modules, mod)
+	}
+	return nil
+}
+
+func convertObjectMetaTo(src *ObjectMeta) *v1beta1.ObjectMeta {
+	if src == nil {
+		return nil
+	}
+	return &v1beta1.ObjectMeta{
+		Name:        src.Name,
+		Namespace:   src.Namespace,
+		Labels:      src.Labels,
+		Annotations: src.Annotations,
+	}
+}
+
+func convertObjectMetaFrom(src *v1beta1.ObjectMeta) (*ObjectMeta, error) {
+	if src == nil {
+		return nil, nil
+	}
+	if len(src.NamePrefix) > 0 {
+		return nil, fmt.Errorf("metadata.namePrefix is not supported in %s", APIVersion)
+	}
+	if src.IncludeSelectors != nil {
+		return nil, fmt.Errorf("metadata.includeSelectors is not supported in %s", APIVersion)
+	}
+	return &ObjectMeta{
+		Name:        src.Name,
+		Namespace:   src.Namespace,
+		Labels:      src.Labels,
+		Annotations: src.Annotations,
+	}, nil
+}
+
+// ConvertSecret converts a secret in the form of KEY=VALUE into a structured v1beta1 secret.
+// Values prefixed with ref+ are converted into references.
+func ConvertSecret(s string) (v1beta1.Secret, error) {
+	key, val, ok := strings.Cut(s, "=")
+	if !ok {
+		return v1beta1.Secret{}, fmt.Errorf("secret %q must be in the form of KEY=VALUE", s)
+	}
+	if strings.HasPrefix(val, secretRefPrefix) {
+		return v1beta1.Secret{Key: key, Ref: strings.TrimPrefix(val, secretRefPrefix)}, nil
+	}
+	return v1beta1.Secret{Key: key, Value: val}, nil
+}
@@ -0,0 +1,61 @@
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/middlewaregruppen/banana/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConversion(t *testing.T) {
+	src := &BananaFile{
+		TypeMeta: TypeMeta{Kind: Kind, APIVersion: APIVersion},
+		Name:     "test",
+		Age:      &Age{Recipients: []string{"age1"}},
+		Clusters: []*Cluster{{Name: "dev"}},
+		Modules: []Module{
+			{
+				Name:       "ingress/nginx",
+				Version:    "v1.0.0",
+				Components: []string{"tls"},
+				Hosts:      &Host{Prefix: "infra"},
+				Secrets:    []string{"USERNAME=admin", "PASSWORD=pass=word", "TOKEN=ref+vault://kv/app#token"},
+			},
+		},
+	}
+
+	hub := &v1beta1.BananaFile{}
+	err := src.ConvertTo(hub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, v1beta1.APIVersion, hub.APIVersion)
+	assert.Equal(t, []v1beta1.Component{{Name: "tls"}}, hub.Modules[0].Components)
+	assert.Equal(t, []v1beta1.Secret{
+		{Key: "USERNAME", Value: "admin"},
+		{Key: "PASSWORD", Value: "pass=word"},
+		{Key: "TOKEN", Ref: "vault://kv/app#token"},
+	}, hub.Modules[0].Secrets)
+	assert.Equal(t, "infra", hub.Modules[0].Hosts.Prefix)
+
+	// Defaulting sets component versions to that of the module which v1alpha1 can still represent
+	v1beta1.SetDefaults(hub)
+	assert.Equal(t, "v1.0.0", hub.Modules[0].Components[0].Version)
+
+	dst := &BananaFile{}
+	err = dst.ConvertFrom(hub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, src, dst)
+
+	// Settings not representable in v1alpha1 results in an error
+	hub.Modules[0].Components[0].Version = "v2.0.0"
+	assert.Error(t, dst.ConvertFrom(hub))
+	hub.Modules[0].Components[0].Version = "v1.0.0"
+	hub.MetaData = &v1beta1.ObjectMeta{NamePrefix: "prod-"}
+	assert.Error(t, dst.ConvertFrom(hub))
+	includeSelectors := true
+	hub.MetaData = &v1beta1.ObjectMeta{IncludeSelectors: &includeSelectors}
+	assert.Error(t, dst.ConvertFrom(hub))
+}
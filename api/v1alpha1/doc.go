@@ -0,0 +1,3 @@
+// Package v1alpha1 contains the v1alpha1 version of the banana file format.
+// It is kept for reading older files and is converted into the latest version when read.
+package v1alpha1
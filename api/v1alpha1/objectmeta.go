@@ -1,4 +1,4 @@
-package types
+package v1alpha1
 
 // ObjectMeta partially copies apimachinery/pkg/apis/meta/v1.ObjectMeta
 // No need for a direct dependence; the fields are stable.
@@ -0,0 +1,19 @@
+package v1alpha1
+
+const (
+	// Kind is the kind of a banana file
+	Kind = "Banana"
+
+	// APIVersion is the api version of a banana file
+	APIVersion = "banana.io/v1alpha1"
+
+	// LegacyAPIVersion is an alias of APIVersion used by older banana files
+	LegacyAPIVersion = "konf.io/v1alpha1"
+)
+
+// TypeMeta partially copies apimachinery/pkg/apis/meta/v1.TypeMeta
+// No need for a direct dependence; the fields are stable.
+type TypeMeta struct {
+	Kind       string `json:"kind,omitempty" yaml:"kind,omitempty"`
+	APIVersion string `json:"apiVersion,omitempty" yaml:"apiVersion,omitempty"`
+}
@@ -1,4 +1,4 @@
-package types
+package v1beta1
 
 type Age struct {
 	// Recipients is a list of age recipients
@@ -0,0 +1,49 @@
+package v1beta1
+
+// ArgoCD generates Argo CD Applications deploying the exported modules
+type ArgoCD struct {
+	// RepoURL is the URL of the repository the export is committed to
+	RepoURL string `json:"repoURL,omitempty" yaml:"repoURL,omitempty"`
+
+	// TargetRevision is the revision of the repository to deploy. Defaults to HEAD
+	TargetRevision string `json:"targetRevision,omitempty" yaml:"targetRevision,omitempty"`
+
+	// Path is the path of the export directory within the repository. Defaults to src
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+
+	// Project is the Argo CD project of the Applications. Defaults to default
+	Project string `json:"project,omitempty" yaml:"project,omitempty"`
+
+	// Namespace is the namespace of the Applications, where Argo CD runs. Defaults to argocd
+	Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+
+	// Server is the API server modules declared at the top level are deployed to. Modules of a cluster are deployed
+	// to the Argo CD cluster named after it. Defaults to https://kubernetes.default.svc
+	Server string `json:"server,omitempty" yaml:"server,omitempty"`
+
+	// ApplicationSet generates one ApplicationSet for the top level and each cluster instead of an Application per module
+	ApplicationSet bool `json:"applicationSet,omitempty" yaml:"applicationSet,omitempty"`
+
+	// SyncPolicy is the sync policy of the Applications
+	SyncPolicy *ArgoCDSyncPolicy `json:"syncPolicy,omitempty" yaml:"syncPolicy,omitempty"`
+
+	// Plugin is the config management plugin decrypting sops encrypted secrets, used when age recipients are set.
+	// The plugin must be registered with Argo CD. Required when age recipients are set
+	Plugin string `json:"plugin,omitempty" yaml:"plugin,omitempty"`
+}
+
+type ArgoCDSyncPolicy struct {
+	// Automated syncs Applications automatically
+	Automated *ArgoCDAutomatedSync `json:"automated,omitempty" yaml:"automated,omitempty"`
+
+	// SyncOptions are options of the sync, for example ServerSideApply=true
+	SyncOptions []string `json:"syncOptions,omitempty" yaml:"syncOptions,omitempty"`
+}
+
+type ArgoCDAutomatedSync struct {
+	// Prune deletes resources no longer exported
+	Prune bool `json:"prune,omitempty" yaml:"prune,omitempty"`
+
+	// SelfHeal reverts changes made in the cluster
+	SelfHeal bool `json:"selfHeal,omitempty" yaml:"selfHeal,omitempty"`
+}
@@ -0,0 +1,48 @@
+package v1beta1
+
+type BananaFile struct {
+	TypeMeta `json:",inline" yaml:",inline"`
+	MetaData *ObjectMeta `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+
+	// Name is the name of this konfig
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+
+	// Version is the version of this konfig
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+
+	// Clusters is a list of clusters in this konf
+	Clusters []*Cluster `json:"clusters,omitempty" yaml:"clusters,omitempty"`
+
+	// Modules is a list of modules applied to this konfig
+	Modules []Module `json:"modules,omitempty" yaml:"modules,omitempty"`
+
+	// Age controls age-specific attributes
+	Age *Age `json:"age,omitempty" yaml:"age,omitempty"`
+
+	// SealedSecrets converts secrets into Bitnami SealedSecrets instead of encrypting them with sops
+	SealedSecrets *SealedSecrets `json:"sealedSecrets,omitempty" yaml:"sealedSecrets,omitempty"`
+
+	// ExternalSecrets configures how secrets referencing external values are fetched by the cluster
+	ExternalSecrets *ExternalSecrets `json:"externalSecrets,omitempty" yaml:"externalSecrets,omitempty"`
+
+	// Export controls how built modules are written to the export directory
+	Export *Export `json:"export,omitempty" yaml:"export,omitempty"`
+
+	// ImageRegistry rewrites the registry of the images of every module
+	ImageRegistry *ImageRegistry `json:"imageRegistry,omitempty" yaml:"imageRegistry,omitempty"`
+
+	// ImageFieldSpecs are fields holding images in addition to the containers of workloads, for example in custom resources
+	ImageFieldSpecs []FieldSpec `json:"imageFieldSpecs,omitempty" yaml:"imageFieldSpecs,omitempty"`
+
+	// PinImageDigests replaces the tag of every image with the digest it resolves to, recorded in the lock file
+	PinImageDigests bool `json:"pinImageDigests,omitempty" yaml:"pinImageDigests,omitempty"`
+
+	// Namespaces sets labels and annotations on the Namespaces created for the namespaces modules are deployed to
+	Namespaces []Namespace `json:"namespaces,omitempty" yaml:"namespaces,omitempty"`
+
+	// Conflicts controls how resources emitted by several modules are resolved
+	Conflicts *Conflicts `json:"conflicts,omitempty" yaml:"conflicts,omitempty"`
+
+	// Dependencies controls how dependencies between modules are resolved
+	Dependencies *Dependencies `json:"dependencies,omitempty" yaml:"dependencies,omitempty"`
+}
@@ -0,0 +1,23 @@
+package v1beta1
+
+type Cluster struct {
+	MetaData *ObjectMeta `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+
+	// Name is the name of this cluster
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+
+	// Version is the k8s version of this cluster
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+
+	// Ingress is the ingress configuration for services in this cluster
+	Ingress *Ingress `json:"ingress,omitempty" yaml:"ingress,omitempty"`
+
+	// Modules overrides modules for this cluster. Modules are matched by name and any
+	// field set here takes precedence over the module declared at the top level
+	Modules []Module `json:"modules,omitempty" yaml:"modules,omitempty"`
+}
+
+type Ingress struct {
+	// URLFormat is the format string for generating URL's to different services in the cluster
+	URLFormat string `json:"urlFormat,omitempty" yaml:"urlFormat,omitempty"`
+}
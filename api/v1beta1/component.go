@@ -0,0 +1,9 @@
+package v1beta1
+
+type Component struct {
+	// Name is the name of this component
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+
+	// Version is the version of this component. Defaults to the version of the module
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+}
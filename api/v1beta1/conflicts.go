@@ -0,0 +1,7 @@
+package v1beta1
+
+type Conflicts struct {
+	// Strategy resolves resources emitted by several modules deployed together, one of fail, first-wins or
+	// merge-if-identical. Defaults to merge-if-identical
+	Strategy string `json:"strategy,omitempty" yaml:"strategy,omitempty"`
+}
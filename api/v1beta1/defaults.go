@@ -0,0 +1,51 @@
+package v1beta1
+
+const (
+	defaultSealedSecretsScope = "strict"
+	defaultSecretStoreKind    = "SecretStore"
+	defaultRefreshInterval    = "1h"
+	defaultHostDelimiter      = "-"
+)
+
+// SetDefaults sets default values on every field of the banana file that is not set
+func SetDefaults(f *BananaFile) {
+	if len(f.Kind) == 0 {
+		f.Kind = Kind
+	}
+	if len(f.APIVersion) == 0 {
+		f.APIVersion = APIVersion
+	}
+	if f.SealedSecrets != nil && len(f.SealedSecrets.Scope) == 0 {
+		f.SealedSecrets.Scope = defaultSealedSecretsScope
+	}
+	if f.ExternalSecrets != nil {
+		if len(f.ExternalSecrets.SecretStoreRef.Kind) == 0 {
+			f.ExternalSecrets.SecretStoreRef.Kind = defaultSecretStoreKind
+		}
+		if len(f.ExternalSecrets.RefreshInterval) == 0 {
+			f.ExternalSecrets.RefreshInterval = defaultRefreshInterval
+		}
+	}
+	for i := range f.Modules {
+		setModuleDefaults(&f.Modules[i])
+	}
+	for _, c := range f.Clusters {
+		if c == nil {
+			continue
+		}
+		for i := range c.Modules {
+			setModuleDefaults(&c.Modules[i])
+		}
+	}
+}
+
+func setModuleDefaults(m *Module) {
+	if m.Hosts != nil && len(m.Hosts.Delimiter) == 0 {
+		m.Hosts.Delimiter = defaultHostDelimiter
+	}
+	for i := range m.Components {
+		if len(m.Components[i].Version) == 0 {
+			m.Components[i].Version = m.Version
+		}
+	}
+}
@@ -0,0 +1,6 @@
+package v1beta1
+
+type Dependencies struct {
+	// Missing is what is done about modules depended on but not declared, one of fail or add. Defaults to fail
+	Missing string `json:"missing,omitempty" yaml:"missing,omitempty"`
+}
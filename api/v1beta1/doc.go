@@ -0,0 +1,3 @@
+// Package v1beta1 contains the v1beta1 version of the banana file format.
+// It is the latest version and acts as the hub that other versions are converted to and from.
+package v1beta1
@@ -0,0 +1,16 @@
+package v1beta1
+
+type Export struct {
+	// Layout is how the files of each module are laid out, one of flat, by-kind or by-namespace/kind. Defaults to flat
+	Layout string `json:"layout,omitempty" yaml:"layout,omitempty"`
+
+	// Ordering is how the order modules are installed in is carried by the export, one of none, numbered or
+	// sync-waves. Defaults to none
+	Ordering string `json:"ordering,omitempty" yaml:"ordering,omitempty"`
+
+	// ArgoCD generates Argo CD Applications for the exported modules
+	ArgoCD *ArgoCD `json:"argocd,omitempty" yaml:"argocd,omitempty"`
+
+	// Flux generates Flux Kustomizations for the exported modules
+	Flux *Flux `json:"flux,omitempty" yaml:"flux,omitempty"`
+}
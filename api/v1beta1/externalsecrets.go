@@ -0,0 +1,17 @@
+package v1beta1
+
+type ExternalSecrets struct {
+	// SecretStoreRef is the SecretStore used to fetch referenced secrets
+	SecretStoreRef SecretStoreRef `json:"secretStoreRef,omitempty" yaml:"secretStoreRef,omitempty"`
+
+	// RefreshInterval is the amount of time before values are read again from the SecretStore. Defaults to 1h
+	RefreshInterval string `json:"refreshInterval,omitempty" yaml:"refreshInterval,omitempty"`
+}
+
+type SecretStoreRef struct {
+	// Name is the name of the SecretStore
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+
+	// Kind is either SecretStore or ClusterSecretStore. Defaults to SecretStore
+	Kind string `json:"kind,omitempty" yaml:"kind,omitempty"`
+}
@@ -0,0 +1,35 @@
+package v1beta1
+
+// Flux generates Flux Kustomizations deploying the exported modules
+type Flux struct {
+	// SourceRef is the source holding the export, such as the GitRepository the export is committed to.
+	// Defaults to the GitRepository flux-system
+	SourceRef *FluxSourceRef `json:"sourceRef,omitempty" yaml:"sourceRef,omitempty"`
+
+	// Path is the path of the export directory within the source. Defaults to src
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+
+	// Namespace is the namespace of the Kustomizations, where Flux runs. Defaults to flux-system
+	Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+
+	// Interval is the interval the Kustomizations are reconciled at. Defaults to 10m
+	Interval string `json:"interval,omitempty" yaml:"interval,omitempty"`
+
+	// Prune deletes resources no longer exported
+	Prune bool `json:"prune,omitempty" yaml:"prune,omitempty"`
+
+	// DecryptionSecret is the Secret holding the age key decrypting sops encrypted secrets, used when age recipients
+	// are set. Defaults to sops-age
+	DecryptionSecret string `json:"decryptionSecret,omitempty" yaml:"decryptionSecret,omitempty"`
+}
+
+type FluxSourceRef struct {
+	// Kind is the kind of the source. Defaults to GitRepository
+	Kind string `json:"kind,omitempty" yaml:"kind,omitempty"`
+
+	// Name is the name of the source
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+
+	// Namespace is the namespace of the source, if not that of the Kustomizations
+	Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+}
@@ -1,4 +1,4 @@
-package types
+package v1beta1
 
 type Host struct {
 	// Prefix is the prefix of this Host instance
@@ -0,0 +1,34 @@
+package v1beta1
+
+type Image struct {
+	// Name is the name of the image to replace, without tag or digest
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+
+	// NewName replaces the name of the image
+	NewName string `json:"newName,omitempty" yaml:"newName,omitempty"`
+
+	// NewTag replaces the tag of the image
+	NewTag string `json:"newTag,omitempty" yaml:"newTag,omitempty"`
+
+	// Digest replaces the tag of the image with a digest
+	Digest string `json:"digest,omitempty" yaml:"digest,omitempty"`
+}
+
+type ImageRegistry struct {
+	// Mirror is the registry, optionally followed by a path, that images are pulled from instead of their own registry
+	Mirror string `json:"mirror,omitempty" yaml:"mirror,omitempty"`
+
+	// Registries limits the rewrite to images of these registries. Images of every registry are rewritten when empty
+	Registries []string `json:"registries,omitempty" yaml:"registries,omitempty"`
+}
+
+// FieldSpec selects a field holding an image in resources of a kind, for example in a custom resource
+type FieldSpec struct {
+	Group   string `json:"group,omitempty" yaml:"group,omitempty"`
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+	Kind    string `json:"kind,omitempty" yaml:"kind,omitempty"`
+
+	// Path is the slash separated path of the field. Lists are traversed by suffixing a field with [],
+	// for example spec/template/spec/containers[]/image
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+}
@@ -0,0 +1,46 @@
+package v1beta1
+
+type Module struct {
+	MetaData *ObjectMeta `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+
+	// Name is the name of this module
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+
+	// Version is the version of this module, typically translates to a git tag
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+
+	// Ref is the git reference name of this module
+	Ref string `json:"ref,omitempty" yaml:"ref,omitempty"`
+
+	// Namespace is the namespace for this module
+	Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+
+	// Opt is options that can be passed to this module
+	Opts ModuleOpts `json:"opts,omitempty" yaml:"opts,omitempty"`
+
+	// Components is a list of components for this module
+	Components []Component `json:"components,omitempty" yaml:"components,omitempty"`
+
+	// Hosts is a list of Host types mapped to this module
+	Hosts *Host `json:"hosts,omitempty" yaml:"hosts,omitempty"`
+
+	// Secrets is a list of secrets mapped to this module
+	Secrets []Secret `json:"secrets,omitempty" yaml:"secrets,omitempty"`
+
+	// Patches is a list of kustomize patches applied to this module after its components
+	Patches []Patch `json:"patches,omitempty" yaml:"patches,omitempty"`
+
+	// Images overrides the name, tag or digest of images used by this module
+	Images []Image `json:"images,omitempty" yaml:"images,omitempty"`
+}
+
+type ModuleOpts map[string]interface{}
+
+// ComponentNames returns the names of the components of this module
+func (m *Module) ComponentNames() []string {
+	var names []string
+	for _, c := range m.Components {
+		names = append(names, c.Name)
+	}
+	return names
+}
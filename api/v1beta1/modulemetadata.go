@@ -0,0 +1,51 @@
+package v1beta1
+
+// ModuleMetadataKind is the kind of a module metadata file
+const ModuleMetadataKind = "BananaModule"
+
+// ModuleMetadata describes a module to its users. It is read from a banana-module.yaml file in the module directory.
+type ModuleMetadata struct {
+	TypeMeta `json:",inline" yaml:",inline"`
+
+	// Description is a short description of the module
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+
+	// Options is a list of options accepted by the module
+	Options []ModuleOption `json:"options,omitempty" yaml:"options,omitempty"`
+
+	// Secrets is a list of keys of the Secret resources of the module that are expected to be set
+	Secrets []ModuleSecret `json:"secrets,omitempty" yaml:"secrets,omitempty"`
+
+	// Dependencies is a list of modules that must be installed before the module
+	Dependencies []ModuleDependency `json:"dependencies,omitempty" yaml:"dependencies,omitempty"`
+}
+
+type ModuleOption struct {
+	// Name is the name of the option as given in the opts of a module
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+
+	// Description describes what the option does
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+
+	// Default is the value used when the option is not given
+	Default string `json:"default,omitempty" yaml:"default,omitempty"`
+}
+
+type ModuleSecret struct {
+	// Key is the key in the Secret resource of the module
+	Key string `json:"key,omitempty" yaml:"key,omitempty"`
+
+	// Description describes what the secret is used for
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+
+	// Required is true if the module does not work without the secret being set
+	Required bool `json:"required,omitempty" yaml:"required,omitempty"`
+}
+
+type ModuleDependency struct {
+	// Name is the name of the module depended on, for example ingress/nginx
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+
+	// Version is the version of the module added when the dependency is missing from the banana file
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+}
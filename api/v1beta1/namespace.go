@@ -0,0 +1,13 @@
+package v1beta1
+
+// Namespace holds labels and annotations of a namespace modules are deployed to, for example Pod Security admission levels
+type Namespace struct {
+	// Name is the name of the namespace
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+
+	// Labels are set on the Namespace, taking precedence over labels set by modules
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+
+	// Annotations are set on the Namespace, taking precedence over annotations set by modules
+	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+}
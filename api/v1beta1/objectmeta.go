@@ -0,0 +1,18 @@
+package v1beta1
+
+// ObjectMeta partially copies apimachinery/pkg/apis/meta/v1.ObjectMeta
+// No need for a direct dependence; the fields are stable.
+type ObjectMeta struct {
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+
+	// NamePrefix is prepended to the name of every resource, the same as the namePrefix of a kustomization
+	NamePrefix string `json:"namePrefix,omitempty" yaml:"namePrefix,omitempty"`
+
+	Namespace   string            `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+
+	// IncludeSelectors adds labels to selectors as well, not only to resources and pod templates.
+	// Selectors of existing workloads are immutable so this is disabled by default
+	IncludeSelectors *bool `json:"includeSelectors,omitempty" yaml:"includeSelectors,omitempty"`
+}
@@ -0,0 +1,23 @@
+package v1beta1
+
+type Patch struct {
+	// Path is the path of a file holding the patch, relative to the banana file
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+
+	// Patch is an inline patch, either a strategic merge patch or a JSON 6902 patch
+	Patch string `json:"patch,omitempty" yaml:"patch,omitempty"`
+
+	// Target selects the resources patched. Required for JSON 6902 patches
+	Target *PatchTarget `json:"target,omitempty" yaml:"target,omitempty"`
+}
+
+// PatchTarget selects resources the same way as the target of a kustomize patch
+type PatchTarget struct {
+	Group              string `json:"group,omitempty" yaml:"group,omitempty"`
+	Version            string `json:"version,omitempty" yaml:"version,omitempty"`
+	Kind               string `json:"kind,omitempty" yaml:"kind,omitempty"`
+	Name               string `json:"name,omitempty" yaml:"name,omitempty"`
+	Namespace          string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	LabelSelector      string `json:"labelSelector,omitempty" yaml:"labelSelector,omitempty"`
+	AnnotationSelector string `json:"annotationSelector,omitempty" yaml:"annotationSelector,omitempty"`
+}
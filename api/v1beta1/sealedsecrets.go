@@ -0,0 +1,9 @@
+package v1beta1
+
+type SealedSecrets struct {
+	// Certificate is the path to the PEM encoded public certificate of the sealed-secrets controller
+	Certificate string `json:"certificate,omitempty" yaml:"certificate,omitempty"`
+
+	// Scope is the sealing scope, one of strict, namespace-wide or cluster-wide. Defaults to strict
+	Scope string `json:"scope,omitempty" yaml:"scope,omitempty"`
+}
@@ -0,0 +1,13 @@
+package v1beta1
+
+type Secret struct {
+	// Key is the key in the Secret resource of the module
+	Key string `json:"key,omitempty" yaml:"key,omitempty"`
+
+	// Value is the plain text value of the secret
+	Value string `json:"value,omitempty" yaml:"value,omitempty"`
+
+	// Ref is a reference to a value in an external secret store in the form of <provider>://<key>[#<property>].
+	// Mutually exclusive with Value
+	Ref string `json:"ref,omitempty" yaml:"ref,omitempty"`
+}
@@ -1,4 +1,12 @@
-package types
+package v1beta1
+
+const (
+	// Kind is the kind of a banana file
+	Kind = "Banana"
+
+	// APIVersion is the api version of a banana file
+	APIVersion = "banana.io/v1beta1"
+)
 
 // TypeMeta partially copies apimachinery/pkg/apis/meta/v1.TypeMeta
 // No need for a direct dependence; the fields are stable.
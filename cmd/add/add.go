@@ -0,0 +1,79 @@
+package add
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/middlewaregruppen/banana/pkg/bananafile"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+var (
+	fileName   string
+	version    string
+	ref        string
+	namespace  string
+	components []string
+	secrets    []string
+)
+
+func NewCmdAdd(fs filesys.FileSystem, w io.Writer) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "add MODULE",
+		Args:  cobra.ExactArgs(1),
+		Short: "Adds a module to the banana specification",
+		Long: `Adds a module to the banana specification. If the module is already declared, its version, ref and namespace
+are updated and any components and secrets not already present are added. Comments and formatting of the file are preserved`,
+		Example: `banana add ingress/nginx --version v1.2.0 --component tls
+banana add networking/infoblox --secret INFOBLOX_PASSWORD=password`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !fs.Exists(fileName) {
+				return fmt.Errorf("banana file not found")
+			}
+			m := types.Module{
+				Name:      args[0],
+				Version:   version,
+				Ref:       ref,
+				Namespace: namespace,
+			}
+			for _, comp := range components {
+				m.Components = append(m.Components, types.Component{Name: comp})
+			}
+			for _, s := range secrets {
+				sec, err := bananafile.ParseSecret(s)
+				if err != nil {
+					return err
+				}
+				m.Secrets = append(m.Secrets, sec)
+			}
+
+			kf := bananafile.NewBananaFile(fs)
+			doc, err := kf.ReadDocument(fileName)
+			if err != nil {
+				return err
+			}
+			if err := doc.AddModule(m); err != nil {
+				return err
+			}
+			if err := kf.WriteDocument(doc, fileName); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "added %s to %s\n", m.Name, fileName)
+			return nil
+		},
+	}
+	c.Flags().StringVarP(
+		&fileName,
+		"filename",
+		"f",
+		"banana.yaml",
+		"The file that contain the configurations to edit.")
+	c.Flags().StringVar(&version, "version", "", "Version of the module, typically a git tag")
+	c.Flags().StringVar(&ref, "ref", "", "Git reference name of the module")
+	c.Flags().StringVar(&namespace, "namespace", "", "Namespace of the module")
+	c.Flags().StringArrayVar(&components, "component", []string{}, "Component of the module. May be given multiple times")
+	c.Flags().StringArrayVar(&secrets, "secret", []string{}, "Secret of the module in the form of KEY=VALUE or KEY=ref+<provider>://<key>#<property>. May be given multiple times")
+	return c
+}
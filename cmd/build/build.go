@@ -1,13 +1,18 @@
 package build
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"path"
+	"path/filepath"
+	"time"
 
+	"github.com/middlewaregruppen/banana/cmd/version"
 	"github.com/middlewaregruppen/banana/pkg/bananafile"
-	"github.com/middlewaregruppen/banana/pkg/git"
-	"github.com/middlewaregruppen/banana/pkg/module"
-	"github.com/sirupsen/logrus"
+	"github.com/middlewaregruppen/banana/pkg/builder"
+	"github.com/middlewaregruppen/banana/pkg/digest"
+	"github.com/middlewaregruppen/banana/pkg/inventory"
 	"github.com/spf13/cobra"
 
 	//"sigs.k8s.io/kustomize/api/krusty"
@@ -16,12 +21,20 @@ import (
 )
 
 var (
-	fileName string
-	output   string
+	fileName       string
+	output         string
+	noPrune        bool
+	dryRun         bool
+	stamp          bool
+	imagesReport   string
+	imagesFormat   string
+	updateLock     bool
+	format         string
+	chartPerModule bool
 	//age      []string
 )
 
-func NewCmdBuild(fs filesys.FileSystem, w io.Writer, prefix string) *cobra.Command {
+func NewCmdBuild(fs filesys.FileSystem, w io.Writer, prefix *string) *cobra.Command {
 	c := &cobra.Command{
 		Use: "build",
 		//Aliases: []string{""},
@@ -38,61 +51,87 @@ func NewCmdBuild(fs filesys.FileSystem, w io.Writer, prefix string) *cobra.Comma
 				return err
 			}
 
+			exportFormat, err := builder.ParseFormat(format)
+			if err != nil {
+				return err
+			}
+			exportDir := builder.ExportDir
+			if exportFormat == builder.FormatHelmChart {
+				exportDir = builder.ChartsDir
+			}
+
 			// Setup filesystem for exported bundles
 			outfs := filesys.MakeFsOnDisk()
 
-			// Init loader for loading modules
-			tmpfs := filesys.MakeFsInMemory()
-			l := module.NewLoader(tmpfs)
-
-			// Range over each module, loading them through the loader and building them
-			// to the provided writer
-			for _, m := range km.Modules {
-				logrus.Debugf("building module %s holding %d component(s) \n", m.Name, len(m.Components))
-				mod := l.Load(m, prefix)
-				logrus.Debugf("Will clone repo %s version %s using subdir %s into", mod.URL(), mod.Version(), mod.Name())
+			lockFile := filepath.Join(filepath.Dir(fileName), digest.LockFile)
+			bopts := []builder.BuilderOpts{
+				builder.WithVersion(version.VERSION),
+				builder.WithDir(filepath.Dir(fileName)),
+				builder.WithLockFile(lockFile),
+				builder.WithLockUpdate(updateLock),
+			}
 
-				// Setup the cloner and clone into temporary filesystem
-				err := git.NewCloner(mod).Clone(tmpfs)
+			// Images missing from the lock file are resolved using the credentials of the docker config
+			if km.PinImageDigests {
+				auths, err := digest.LoadDockerConfig()
 				if err != nil {
 					return err
 				}
+				bopts = append(bopts, builder.WithResolver(digest.NewResolver(digest.WithCredentials(auths))))
+			}
+			if stamp {
+				bopts = append(bopts, builder.WithBuildTime(time.Now()))
+			}
+			result, err := builder.NewBuilder(fs, *prefix, bopts...).Build(km)
+			if err != nil {
+				return err
+			}
 
-				// Init opts
-				opts := []module.BundleOpts{
-					module.WithSecrets(mod.Secrets()),
-					module.WithURLs(mod.Host()),
-				}
-
-				// Use sops encryption if age recipients is provided
-				if km.Age != nil && len(km.Age.Recipients) > 0 {
-					opts = append(opts, module.WithAgeRecipients(km.Age.Recipients))
-				}
-
-				// Bundle the module
-				bun, err := mod.Bundle(opts...)
+			if len(imagesReport) > 0 {
+				format, err := inventory.ParseFormat(imagesFormat)
 				if err != nil {
 					return err
 				}
-
-				// Write to disk
-				err = bun.Export(outfs, module.WithExportRootDir("src/"))
+				images, err := inventory.FromResult(result, km.ImageFieldSpecs)
 				if err != nil {
 					return err
 				}
+				var buf bytes.Buffer
+				if err := inventory.Write(&buf, images, format); err != nil {
+					return err
+				}
+				if !dryRun {
+					if err := outfs.WriteFile(imagesReport, buf.Bytes()); err != nil {
+						return err
+					}
+				}
+			}
 
-				// Build encrypted & flattened module to stdout
-				// if km.Age != nil && len(km.Age.Recipients) > 0 {
-				// 	if err = bun.FlattenSecure(km.Age.Recipients, os.Stdout); err != nil {
-				// 		return err
-				// 	}
-				// 	return nil
-				// }
-
-				// // Build flattened module to stdout
-				// if err = bun.Flatten(os.Stdout); err != nil {
-				// 	return err
-				// }
+			// Write to disk
+			report, err := result.Export(outfs, exportDir,
+				builder.WithPrune(!noPrune),
+				builder.WithDryRun(dryRun),
+				builder.WithFormat(exportFormat),
+				builder.WithChartPerModule(chartPerModule),
+			)
+			if err != nil {
+				return err
+			}
+			if result.Lock != nil && !dryRun {
+				if err := result.Lock.Write(fs, lockFile); err != nil {
+					return err
+				}
+			}
+			if dryRun {
+				for _, f := range report.Written {
+					fmt.Fprintf(w, "write %s\n", path.Join(exportDir, f))
+				}
+				for _, f := range report.Removed {
+					fmt.Fprintf(w, "remove %s\n", path.Join(exportDir, f))
+				}
+				if len(imagesReport) > 0 {
+					fmt.Fprintf(w, "write %s\n", imagesReport)
+				}
 			}
 			return err
 		},
@@ -110,5 +149,13 @@ func NewCmdBuild(fs filesys.FileSystem, w io.Writer, prefix string) *cobra.Comma
 		"stdout",
 		"build banana specifiction to either stdout or filesystem",
 	)
+	c.Flags().BoolVar(&noPrune, "no-prune", false, "Keep files written by a previous build that are no longer built")
+	c.Flags().BoolVar(&dryRun, "dry-run", false, "List the files that would be written and removed without changing anything")
+	c.Flags().StringVar(&imagesReport, "images-report", "", "Write the container images of the build to this file")
+	c.Flags().StringVar(&imagesFormat, "images-format", "cyclonedx", "Format of the images report, one of text, json or cyclonedx")
+	c.Flags().BoolVar(&updateLock, "update-lock", false, "Resolve the digest of every pinned image again instead of using those of the lock file")
+	c.Flags().StringVar(&format, "format", "kustomize", "Format of the export, either kustomize into src or helm-chart into charts")
+	c.Flags().BoolVar(&chartPerModule, "chart-per-module", false, "Export a chart per module instead of one for the top level and each cluster, with --format helm-chart")
+	c.Flags().BoolVar(&stamp, "timestamp", false, "Annotate resources with the time of the build. Builds are no longer reproducible when set")
 	return c
 }
@@ -1,46 +1,91 @@
 package create
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
 
 	"github.com/middlewaregruppen/banana/api/types"
 	"github.com/middlewaregruppen/banana/pkg/bananafile"
+	"github.com/middlewaregruppen/banana/pkg/catalog"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 	"sigs.k8s.io/kustomize/kyaml/filesys"
 )
 
 var (
-	fileName string
+	fileName      string
+	modules       []string
+	components    []string
+	clusters      []string
+	ageRecipients []string
+	noInteractive bool
 )
 
-func NewCmdCreate(fs filesys.FileSystem) *cobra.Command {
+// examples is written at the end of created files to show how modules are customized
+const examples = `# Secrets override values of Secret resources in a module, for example
+#   secrets:
+#   - key: PASSWORD
+#     value: mypassword
+#   - key: TOKEN
+#     ref: vault://kv/app#token
+#
+# Hosts rewrites the host of Ingress resources in a module, for example
+#   hosts:
+#     prefix: infra
+#     wildcard: example.com`
+
+func NewCmdCreate(fs filesys.FileSystem, w io.Writer, prefix *string) *cobra.Command {
 	c := &cobra.Command{
 		Use:     "create",
 		Aliases: []string{"init"},
 		Short:   "Initialize a new banana configuration in the current directory",
-		Long:    "",
+		Long: `Initialize a new banana configuration in the current directory. Modules are either given with flags or,
+when stdin is a terminal, selected interactively from the modules available in the builtin module repository`,
+		Example: `banana create
+banana create --module ingress/nginx@v1.0.0 --component tls --cluster dev
+banana create --module ingress/nginx --module auth/dex@v3.1.14 --component ingress/nginx:tls`,
 		RunE: func(cmd *cobra.Command, args []string) (err error) {
 			if fs.Exists(fileName) {
 				return fmt.Errorf("banana file already exists")
 			}
-			f, err := fs.Create(fileName)
+			km := &types.BananaFile{
+				TypeMeta: types.TypeMeta{
+					Kind:       types.Kind,
+					APIVersion: types.APIVersion,
+				},
+			}
+
+			km.Modules, err = modulesFromFlags(modules, components)
 			if err != nil {
 				return err
 			}
-			f.Close()
+			for _, name := range clusters {
+				km.Clusters = append(km.Clusters, &types.Cluster{Name: name})
+			}
+			if len(ageRecipients) > 0 {
+				km.Age = &types.Age{Recipients: ageRecipients}
+			}
+
+			if len(modules) == 0 && !noInteractive && isTerminal(cmd.InOrStdin()) {
+				if err := interact(newPrompter(cmd.InOrStdin(), w), km, *prefix); err != nil {
+					return err
+				}
+			}
+
 			kf := bananafile.NewBananaFile(fs)
-			km, err := kf.Read(fileName)
+			doc, err := bananafile.NewDocument(fileName, km)
 			if err != nil {
 				return err
 			}
-			km.Kind = "Banana"
-			km.APIVersion = "banana.io/v1alpha1"
-			km.Name = ""
-			km.Modules = []types.Module{}
-			err = kf.Write(km, fileName)
-			if err != nil {
-				return nil
+			doc.SetFootComment(examples)
+			if err := kf.WriteDocument(doc, fileName); err != nil {
+				return err
 			}
+			fmt.Fprintf(w, "created %s\n", fileName)
 			return nil
 		},
 	}
@@ -50,5 +95,185 @@ func NewCmdCreate(fs filesys.FileSystem) *cobra.Command {
 		"f",
 		"banana.yaml",
 		"The files that contain the configurations to apply.")
+	c.Flags().StringArrayVar(&modules, "module", []string{}, "Module to add in the form of NAME[@VERSION]. May be given multiple times")
+	c.Flags().StringArrayVar(&components, "component", []string{}, "Component to add in the form of [MODULE:]COMPONENT. The module may be omitted if only one module is given")
+	c.Flags().StringArrayVar(&clusters, "cluster", []string{}, "Name of a cluster to add. May be given multiple times")
+	c.Flags().StringArrayVar(&ageRecipients, "age-recipient", []string{}, "Age recipient used to encrypt secrets. May be given multiple times")
+	c.Flags().BoolVar(&noInteractive, "no-interactive", false, "Never prompt for modules, even if stdin is a terminal")
 	return c
 }
+
+// modulesFromFlags returns modules given as NAME[@VERSION] with their components given as [MODULE:]COMPONENT.
+// Names may be URLs such as https://example.com:8443/modules or git@example.com:org/modules, so versions and
+// modules are split from the last separator.
+func modulesFromFlags(mods, comps []string) ([]types.Module, error) {
+	var result []types.Module
+	for _, m := range mods {
+		name, version := splitVersion(m)
+		if len(name) == 0 || (len(version) == 0 && strings.HasSuffix(m, "@")) {
+			return nil, fmt.Errorf("invalid module %q, expected NAME[@VERSION]", m)
+		}
+		result = append(result, types.Module{Name: name, Version: version})
+	}
+	for _, c := range comps {
+		i := strings.LastIndex(c, ":")
+		modName, comp, qualified := "", c, i >= 0
+		if qualified {
+			modName, comp = c[:i], c[i+1:]
+		}
+		if len(comp) == 0 {
+			return nil, fmt.Errorf("invalid component %q, expected [MODULE:]COMPONENT", c)
+		}
+		if !qualified {
+			if len(result) != 1 {
+				return nil, fmt.Errorf("component %q must be in the form of MODULE:COMPONENT when not exactly one module is given", c)
+			}
+			result[0].Components = append(result[0].Components, types.Component{Name: c})
+			continue
+		}
+		found := false
+		for i := range result {
+			if result[i].Name == modName {
+				result[i].Components = append(result[i].Components, types.Component{Name: comp})
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("component %q refers to module %s which is not given with --module", c, modName)
+		}
+	}
+	return result, nil
+}
+
+// splitVersion splits s into a module name and the version following its last '@'. The '@' of a user in a URL such
+// as git@example.com:org/modules is part of the name, told apart by the host and path that follow it.
+func splitVersion(s string) (string, string) {
+	i := strings.LastIndex(s, "@")
+	if i < 0 || strings.ContainsAny(s[i+1:], ":/") {
+		return s, ""
+	}
+	return s[:i], s[i+1:]
+}
+
+// interact prompts for modules available at the module repository prefix, their components and versions,
+// as well as clusters and age recipients
+func interact(p *prompter, km *types.BananaFile, prefix string) error {
+	fmt.Fprintf(p.w, "Fetching modules from %s\n", prefix)
+	cat, err := catalog.Fetch(prefix, "")
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, m := range cat.Modules {
+		names = append(names, m.Name)
+	}
+	selected, err := p.choose("Available modules", "Select modules", names)
+	if err != nil {
+		return err
+	}
+	for _, i := range selected {
+		mod := types.Module{Name: cat.Modules[i].Name}
+		if comps := cat.Modules[i].Components; len(comps) > 0 {
+			sel, err := p.choose(fmt.Sprintf("Available components of %s", mod.Name), "Select components", comps)
+			if err != nil {
+				return err
+			}
+			for _, j := range sel {
+				mod.Components = append(mod.Components, types.Component{Name: comps[j]})
+			}
+		}
+		mod.Version, err = p.ask(fmt.Sprintf("Version of %s (empty for latest): ", mod.Name))
+		if err != nil {
+			return err
+		}
+		km.Modules = append(km.Modules, mod)
+	}
+
+	clusterNames, err := p.askList("Clusters (comma separated names, empty for none): ")
+	if err != nil {
+		return err
+	}
+	for _, name := range clusterNames {
+		km.Clusters = append(km.Clusters, &types.Cluster{Name: name})
+	}
+
+	recipients, err := p.askList("Age recipients used to encrypt secrets (comma separated, empty for none): ")
+	if err != nil {
+		return err
+	}
+	if len(recipients) > 0 {
+		km.Age = &types.Age{Recipients: recipients}
+	}
+	return nil
+}
+
+type prompter struct {
+	s *bufio.Scanner
+	w io.Writer
+}
+
+func newPrompter(r io.Reader, w io.Writer) *prompter {
+	return &prompter{s: bufio.NewScanner(r), w: w}
+}
+
+// ask prints the question and returns the trimmed answer
+func (p *prompter) ask(question string) (string, error) {
+	fmt.Fprint(p.w, question)
+	if !p.s.Scan() {
+		if err := p.s.Err(); err != nil {
+			return "", err
+		}
+		return "", io.ErrUnexpectedEOF
+	}
+	return strings.TrimSpace(p.s.Text()), nil
+}
+
+// askList asks the question and returns the comma separated answer as a list
+func (p *prompter) askList(question string) ([]string, error) {
+	a, err := p.ask(question)
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, s := range strings.Split(a, ",") {
+		if s = strings.TrimSpace(s); len(s) > 0 {
+			result = append(result, s)
+		}
+	}
+	return result, nil
+}
+
+// choose lists the numbered options and returns the indexes of the options selected. Asks again on invalid input.
+func (p *prompter) choose(title, question string, options []string) ([]int, error) {
+	fmt.Fprintf(p.w, "%s:\n", title)
+	for i, o := range options {
+		fmt.Fprintf(p.w, "  %d) %s\n", i+1, o)
+	}
+	for {
+		answers, err := p.askList(fmt.Sprintf("%s (comma separated numbers, empty for none): ", question))
+		if err != nil {
+			return nil, err
+		}
+		var selected []int
+		valid := true
+		for _, a := range answers {
+			i, err := strconv.Atoi(a)
+			if err != nil || i < 1 || i > len(options) {
+				fmt.Fprintf(p.w, "%q is not a number between 1 and %d\n", a, len(options))
+				valid = false
+				break
+			}
+			selected = append(selected, i-1)
+		}
+		if valid {
+			return selected, nil
+		}
+	}
+}
+
+// isTerminal returns true if r is a terminal
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
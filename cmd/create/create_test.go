@@ -0,0 +1,128 @@
+package create
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/middlewaregruppen/banana/pkg/bananafile"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+func TestModulesFromFlags(t *testing.T) {
+	var tests = []struct {
+		name       string
+		modules    []string
+		components []string
+		want       []types.Module
+		err        string
+	}{
+		{
+			"names and versions",
+			[]string{"ingress/nginx@v1.0.0", "auth/dex"},
+			[]string{"ingress/nginx:tls", "auth/dex:tls"},
+			[]types.Module{
+				{Name: "ingress/nginx", Version: "v1.0.0", Components: []types.Component{{Name: "tls"}}},
+				{Name: "auth/dex", Components: []types.Component{{Name: "tls"}}},
+			},
+			"",
+		},
+		{
+			"component of the only module",
+			[]string{"ingress/nginx"},
+			[]string{"tls", "metrics"},
+			[]types.Module{{Name: "ingress/nginx", Components: []types.Component{{Name: "tls"}, {Name: "metrics"}}}},
+			"",
+		},
+		{
+			"url with a port",
+			[]string{"https://example.com:8443/modules//ingress/nginx@v1.0.0"},
+			[]string{"https://example.com:8443/modules//ingress/nginx:tls"},
+			[]types.Module{{Name: "https://example.com:8443/modules//ingress/nginx", Version: "v1.0.0", Components: []types.Component{{Name: "tls"}}}},
+			"",
+		},
+		{
+			"scp-like url",
+			[]string{"git@example.com:org/modules//ingress/nginx", "git@example.com:org/modules//auth/dex@v3.1.14"},
+			[]string{"git@example.com:org/modules//ingress/nginx:tls"},
+			[]types.Module{
+				{Name: "git@example.com:org/modules//ingress/nginx", Components: []types.Component{{Name: "tls"}}},
+				{Name: "git@example.com:org/modules//auth/dex", Version: "v3.1.14"},
+			},
+			"",
+		},
+		{
+			"empty version",
+			[]string{"ingress/nginx@"},
+			nil,
+			nil,
+			`invalid module "ingress/nginx@", expected NAME[@VERSION]`,
+		},
+		{
+			"unqualified component of several modules",
+			[]string{"ingress/nginx", "auth/dex"},
+			[]string{"tls"},
+			nil,
+			`component "tls" must be in the form of MODULE:COMPONENT when not exactly one module is given`,
+		},
+		{
+			"component of an unknown module",
+			[]string{"ingress/nginx"},
+			[]string{"auth/dex:tls"},
+			nil,
+			`component "auth/dex:tls" refers to module auth/dex which is not given with --module`,
+		},
+		{
+			"empty component",
+			[]string{"ingress/nginx"},
+			[]string{"ingress/nginx:"},
+			nil,
+			`invalid component "ingress/nginx:", expected [MODULE:]COMPONENT`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := modulesFromFlags(tt.modules, tt.components)
+			if len(tt.err) > 0 {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCreate(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	prefix := "https://github.com/middlewaregruppen/banana-modules"
+	var out bytes.Buffer
+	cmd := NewCmdCreate(fs, &out, &prefix)
+	cmd.SetIn(&bytes.Buffer{})
+	cmd.SetArgs([]string{
+		"--module", "ingress/nginx@v1.0.0",
+		"--component", "tls",
+		"--cluster", "dev",
+		"--age-recipient", "age1example",
+	})
+	assert.NoError(t, cmd.Execute())
+	assert.Equal(t, "created banana.yaml\n", out.String())
+
+	// Modules given with flags are written without prompting
+	km, err := bananafile.NewBananaFile(fs).Read("banana.yaml")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []types.Module{{Name: "ingress/nginx", Version: "v1.0.0", Components: []types.Component{{Name: "tls", Version: "v1.0.0"}}}}, km.Modules)
+	assert.Equal(t, []*types.Cluster{{Name: "dev"}}, km.Clusters)
+	assert.Equal(t, &types.Age{Recipients: []string{"age1example"}}, km.Age)
+
+	// Existing files are never overwritten
+	cmd = NewCmdCreate(fs, &out, &prefix)
+	cmd.SetIn(&bytes.Buffer{})
+	cmd.SetArgs([]string{"--no-interactive"})
+	cmd.SilenceUsage = true
+	assert.EqualError(t, cmd.Execute(), "banana file already exists")
+}
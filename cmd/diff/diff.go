@@ -0,0 +1,160 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/middlewaregruppen/banana/cmd/version"
+	"github.com/middlewaregruppen/banana/pkg/bananafile"
+	"github.com/middlewaregruppen/banana/pkg/builder"
+	"github.com/middlewaregruppen/banana/pkg/diff"
+	"github.com/middlewaregruppen/banana/pkg/digest"
+	"github.com/middlewaregruppen/banana/pkg/git"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+const (
+	colorReset = "\033[0m"
+	colorBold  = "\033[1m"
+	colorRed   = "\033[31m"
+	colorGreen = "\033[32m"
+	colorCyan  = "\033[36m"
+)
+
+var (
+	fileName string
+	revision string
+	output   string
+	color    string
+)
+
+func NewCmdDiff(fs filesys.FileSystem, w io.Writer, prefix *string) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "diff",
+		Args:  cobra.ExactArgs(0),
+		Short: "Shows what changes between the exported sources and a new build",
+		Long: `Builds the banana specification in memory and compares it resource by resource with the exported sources,
+or with the exported sources as of a git revision. Values of Secrets are never shown, only whether they changed. Sops encrypted
+files are decrypted using the keys available to sops, for example through SOPS_AGE_KEY_FILE`,
+		Example: `banana diff
+banana diff --revision HEAD~1
+banana diff -o json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !fs.Exists(fileName) {
+				return fmt.Errorf("banana file not found")
+			}
+			if output != "text" && output != "json" {
+				return fmt.Errorf("unknown output format %q, must be one of text or json", output)
+			}
+			colored, err := useColor(w)
+			if err != nil {
+				return err
+			}
+
+			km, err := bananafile.NewBananaFile(fs).Read(fileName)
+			if err != nil {
+				return err
+			}
+			result, err := builder.NewBuilder(fs, *prefix,
+				builder.WithVersion(version.VERSION),
+				builder.WithDir(filepath.Dir(fileName)),
+				builder.WithLockFile(filepath.Join(filepath.Dir(fileName), digest.LockFile)),
+			).Build(km)
+			if err != nil {
+				return err
+			}
+			current, err := diff.FromResult(result)
+			if err != nil {
+				return err
+			}
+
+			// Read the exported sources either from disk or from the revision. Sources are exported relative to
+			// the working directory, the same as build.
+			oldfs := fs
+			if len(revision) > 0 {
+				oldfs = filesys.MakeFsInMemory()
+				if err := git.ReadRevision(".", revision, builder.ExportDir, oldfs); err != nil {
+					return err
+				}
+			}
+			exported, err := diff.ReadDir(oldfs, builder.ExportDir)
+			if err != nil {
+				return err
+			}
+
+			changes, err := diff.Compare(exported, current)
+			if err != nil {
+				return err
+			}
+
+			if output == "json" {
+				if changes == nil {
+					changes = []diff.Change{}
+				}
+				e := json.NewEncoder(w)
+				e.SetIndent("", "  ")
+				return e.Encode(changes)
+			}
+			for _, c := range changes {
+				d := c.Diff
+				if colored {
+					d = colorize(d)
+				}
+				fmt.Fprint(w, d)
+			}
+			return nil
+		},
+	}
+	c.Flags().StringVarP(
+		&fileName,
+		"filename",
+		"f",
+		"banana.yaml",
+		"The files that contain the configurations to apply.")
+	c.Flags().StringVar(&revision, "revision", "", "Compare with the exported sources as of this git revision instead of those on disk, for example HEAD")
+	c.Flags().StringVarP(&output, "output", "o", "text", "Output format. One of text, a unified diff, or json, a summary of changed resources")
+	c.Flags().StringVar(&color, "color", "auto", "Color the diff. One of auto, always or never")
+	return c
+}
+
+// useColor returns true if the diff written to w should be colored
+func useColor(w io.Writer) (bool, error) {
+	switch color {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		f, ok := w.(*os.File)
+		return ok && term.IsTerminal(int(f.Fd())), nil
+	}
+	return false, fmt.Errorf("unknown color mode %q, must be one of auto, always or never", color)
+}
+
+// colorize colors the lines of the unified diff d
+func colorize(d string) string {
+	var b strings.Builder
+	for _, l := range strings.SplitAfter(d, "\n") {
+		switch {
+		case len(l) == 0:
+			continue
+		case strings.HasPrefix(l, "---"), strings.HasPrefix(l, "+++"):
+			b.WriteString(colorBold + strings.TrimSuffix(l, "\n") + colorReset + "\n")
+		case strings.HasPrefix(l, "@@"):
+			b.WriteString(colorCyan + strings.TrimSuffix(l, "\n") + colorReset + "\n")
+		case strings.HasPrefix(l, "-"):
+			b.WriteString(colorRed + strings.TrimSuffix(l, "\n") + colorReset + "\n")
+		case strings.HasPrefix(l, "+"):
+			b.WriteString(colorGreen + strings.TrimSuffix(l, "\n") + colorReset + "\n")
+		default:
+			b.WriteString(l)
+		}
+	}
+	return b.String()
+}
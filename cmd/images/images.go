@@ -0,0 +1,68 @@
+package images
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/middlewaregruppen/banana/cmd/version"
+	"github.com/middlewaregruppen/banana/pkg/bananafile"
+	"github.com/middlewaregruppen/banana/pkg/builder"
+	"github.com/middlewaregruppen/banana/pkg/digest"
+	"github.com/middlewaregruppen/banana/pkg/inventory"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+var (
+	fileName string
+	output   string
+)
+
+func NewCmdImages(fs filesys.FileSystem, w io.Writer, prefix *string) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "images",
+		Args:  cobra.ExactArgs(0),
+		Short: "Lists the container images deployed by the banana specification",
+		Long: `Builds the banana specification in memory and lists every image of the containers, init containers and
+ephemeral containers of workloads, along with the module and resource referencing it. Images of custom resources are
+found through the imageFieldSpecs of the banana file`,
+		Example: `banana images
+banana images -o json
+banana images -o cyclonedx > sbom.json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !fs.Exists(fileName) {
+				return fmt.Errorf("banana file not found")
+			}
+			format, err := inventory.ParseFormat(output)
+			if err != nil {
+				return err
+			}
+			km, err := bananafile.NewBananaFile(fs).Read(fileName)
+			if err != nil {
+				return err
+			}
+			result, err := builder.NewBuilder(fs, *prefix,
+				builder.WithVersion(version.VERSION),
+				builder.WithDir(filepath.Dir(fileName)),
+				builder.WithLockFile(filepath.Join(filepath.Dir(fileName), digest.LockFile)),
+			).Build(km)
+			if err != nil {
+				return err
+			}
+			images, err := inventory.FromResult(result, km.ImageFieldSpecs)
+			if err != nil {
+				return err
+			}
+			return inventory.Write(w, images, format)
+		},
+	}
+	c.Flags().StringVarP(
+		&fileName,
+		"filename",
+		"f",
+		"banana.yaml",
+		"The files that contain the configurations to apply.")
+	c.Flags().StringVarP(&output, "output", "o", "text", "Output format, one of text, json or cyclonedx")
+	return c
+}
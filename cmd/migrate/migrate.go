@@ -0,0 +1,74 @@
+package migrate
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/middlewaregruppen/banana/pkg/bananafile"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+var (
+	fileName string
+	dryRun   bool
+)
+
+func NewCmdMigrate(fs filesys.FileSystem, w io.Writer) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "migrate",
+		Args:  cobra.ExactArgs(0),
+		Short: "Migrates a banana specification to the latest api version",
+		Long:  "Migrates a banana specification to the latest api version. Comments, ordering and formatting of the file are preserved",
+		Example: `banana migrate
+banana migrate --dry-run`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !fs.Exists(fileName) {
+				return fmt.Errorf("banana file not found")
+			}
+			kf := bananafile.NewBananaFile(fs)
+			doc, err := kf.ReadDocument(fileName)
+			if err != nil {
+				return err
+			}
+			from := doc.APIVersion()
+			migrated, err := doc.Migrate()
+			if err != nil {
+				return err
+			}
+			if !migrated {
+				fmt.Fprintf(w, "%s is already at %s\n", fileName, types.APIVersion)
+				return nil
+			}
+			if dryRun {
+				if errs := doc.Validate(); len(errs) > 0 {
+					return errs
+				}
+				data, err := doc.Bytes()
+				if err != nil {
+					return err
+				}
+				_, err = w.Write(data)
+				return err
+			}
+			if err := kf.WriteDocument(doc, fileName); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "migrated %s from %s to %s\n", fileName, from, types.APIVersion)
+			return nil
+		},
+	}
+	c.Flags().StringVarP(
+		&fileName,
+		"filename",
+		"f",
+		"banana.yaml",
+		"The file that contain the configurations to migrate.")
+	c.Flags().BoolVar(
+		&dryRun,
+		"dry-run",
+		false,
+		"Print the migrated file instead of writing it")
+	return c
+}
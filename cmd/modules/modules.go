@@ -0,0 +1,278 @@
+package modules
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/middlewaregruppen/banana/pkg/catalog"
+	"github.com/middlewaregruppen/banana/pkg/moduletest"
+	"github.com/middlewaregruppen/banana/pkg/scaffold"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+var (
+	output  string
+	version string
+	dir     string
+	update  bool
+)
+
+func NewCmdModules(fs filesys.FileSystem, w io.Writer, prefix *string) *cobra.Command {
+	c := &cobra.Command{
+		Use:     "modules",
+		Aliases: []string{"module"},
+		Short:   "Discover modules available in the builtin module repository and author new modules",
+		Long: `Discover modules available in the builtin module repository given by --builtin-module-prefix.
+The catalog index file of the repository is used if present, otherwise the repository is searched for modules`,
+	}
+	c.PersistentFlags().StringVarP(&output, "output", "o", outputTable, "Output format. One of table or json")
+	c.PersistentFlags().StringVar(&version, "version", "", "Tag of the module repository to read modules from. Defaults to the latest commit")
+
+	c.AddCommand(newCmdList(w, prefix))
+	c.AddCommand(newCmdSearch(w, prefix))
+	c.AddCommand(newCmdShow(w, prefix))
+	c.AddCommand(newCmdInit(fs, w))
+	c.AddCommand(newCmdTest(fs, w))
+	return c
+}
+
+func newCmdTest(fs filesys.FileSystem, w io.Writer) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "test [MODULE...]",
+		Short: "Run the golden file tests of modules in a module repository",
+		Long: `Run the golden file tests of modules in a module repository. Each directory in the tests directory of a module
+is a test case holding a module entry in module.yaml and the flattened output expected from building it in expected.yaml.
+Every module in the repository is tested unless modules are given`,
+		Example: `banana module test
+banana module test monitoring/grafana --dir path/to/banana-modules
+banana module test monitoring/grafana --update`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			names := args
+			if len(names) == 0 {
+				cat, err := catalog.Discover(fs, dir)
+				if err != nil {
+					return err
+				}
+				for _, m := range cat.Modules {
+					names = append(names, m.Name)
+				}
+			}
+
+			r := moduletest.NewRunner(fs, dir, moduletest.WithUpdate(update))
+			total, failed := 0, 0
+			for _, name := range names {
+				results, err := r.Run(name)
+				if err != nil {
+					return err
+				}
+				for _, res := range results {
+					total++
+					switch {
+					case res.Updated:
+						fmt.Fprintf(w, "--- UPDATED %s/%s\n", name, res.Case.Name)
+					case res.Passed:
+						fmt.Fprintf(w, "--- PASS %s/%s\n", name, res.Case.Name)
+					default:
+						failed++
+						fmt.Fprintf(w, "--- FAIL %s/%s\n%s", name, res.Case.Name, res.Diff)
+					}
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d test(s) failed", failed, total)
+			}
+			fmt.Fprintf(w, "ok %d test(s)\n", total)
+			return nil
+		},
+	}
+	c.Flags().StringVar(&dir, "dir", ".", "Root directory of the module repository")
+	c.Flags().BoolVar(&update, "update", false, "Rewrite the expected output of test cases with the output built")
+	return c
+}
+
+func newCmdInit(fs filesys.FileSystem, w io.Writer) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "init CATEGORY/NAME",
+		Args:  cobra.ExactArgs(1),
+		Short: "Create a new module in a module repository",
+		Long: `Create a new module in a module repository. The module is generated with a Deployment, Service, Ingress
+and Secret, an example component, a metadata file and a golden test case. Values marked with CHANGE_ME are placeholders
+to replace`,
+		Example: `banana module init monitoring/grafana
+banana module init ingress/traefik --dir path/to/banana-modules`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			created, err := scaffold.Init(fs, dir, args[0])
+			if err != nil {
+				return err
+			}
+			for _, f := range created {
+				fmt.Fprintf(w, "created %s\n", f)
+			}
+			return nil
+		},
+	}
+	c.Flags().StringVar(&dir, "dir", ".", "Root directory of the module repository")
+	return c
+}
+
+func newCmdList(w io.Writer, prefix *string) *cobra.Command {
+	return &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Args:    cobra.ExactArgs(0),
+		Short:   "List available modules",
+		Example: `banana modules list
+banana modules list --version v1.2.0 -o json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cat, err := fetch(*prefix)
+			if err != nil {
+				return err
+			}
+			return printModules(w, cat.Modules)
+		},
+	}
+}
+
+func newCmdSearch(w io.Writer, prefix *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "search QUERY",
+		Args:  cobra.ExactArgs(1),
+		Short: "Search modules by name, description and components",
+		Example: `banana modules search ingress
+banana modules search tls -o json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cat, err := fetch(*prefix)
+			if err != nil {
+				return err
+			}
+			return printModules(w, cat.Search(args[0]))
+		},
+	}
+}
+
+// shown is the output of the show command
+type shown struct {
+	catalog.Module
+	Versions []string     `json:"versions,omitempty"`
+	Example  types.Module `json:"example"`
+}
+
+func newCmdShow(w io.Writer, prefix *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "show MODULE",
+		Args:  cobra.ExactArgs(1),
+		Short: "Show the description, versions, components and options of a module along with an example banana.yaml entry",
+		Example: `banana modules show ingress/nginx
+banana modules show auth/dex -o json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cat, err := fetch(*prefix)
+			if err != nil {
+				return err
+			}
+			m := cat.Get(args[0])
+			if m == nil {
+				return fmt.Errorf("module %s not found in %s", args[0], *prefix)
+			}
+			// Use the version read from, or else the latest tag, in the example
+			v := version
+			if len(v) == 0 && len(cat.Versions) > 0 {
+				v = cat.Versions[0]
+			}
+			s := shown{Module: *m, Versions: cat.Versions, Example: m.Example(v)}
+
+			if output == outputJSON {
+				return printJSON(w, s)
+			}
+			return printShown(w, s)
+		},
+	}
+}
+
+// fetch returns the catalog of the module repository at prefix after checking the output flag
+func fetch(prefix string) (*catalog.Catalog, error) {
+	if output != outputTable && output != outputJSON {
+		return nil, fmt.Errorf("unknown output format %q, must be one of %s or %s", output, outputTable, outputJSON)
+	}
+	return catalog.Fetch(prefix, version)
+}
+
+func printModules(w io.Writer, modules []catalog.Module) error {
+	if output == outputJSON {
+		if modules == nil {
+			modules = []catalog.Module{}
+		}
+		return printJSON(w, modules)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tCOMPONENTS\tDESCRIPTION")
+	for _, m := range modules {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", m.Name, strings.Join(m.Components, ","), m.Description)
+	}
+	return tw.Flush()
+}
+
+func printShown(w io.Writer, s shown) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Name:\t%s\n", s.Name)
+	fmt.Fprintf(tw, "Description:\t%s\n", s.Description)
+	fmt.Fprintf(tw, "Versions:\t%s\n", strings.Join(s.Versions, ", "))
+	fmt.Fprintf(tw, "Components:\t%s\n", strings.Join(s.Components, ", "))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(s.Options) > 0 {
+		fmt.Fprintln(w, "\nOptions:")
+		tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "  NAME\tDEFAULT\tDESCRIPTION")
+		for _, o := range s.Options {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\n", o.Name, o.Default, o.Description)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(s.Dependencies) > 0 {
+		fmt.Fprintln(w, "\nDependencies:")
+		for _, d := range s.Dependencies {
+			fmt.Fprintf(w, "  %s\n", d.Name)
+		}
+	}
+
+	if len(s.Secrets) > 0 {
+		fmt.Fprintln(w, "\nSecrets:")
+		tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "  KEY\tREQUIRED\tDESCRIPTION")
+		for _, sec := range s.Secrets {
+			fmt.Fprintf(tw, "  %s\t%t\t%s\n", sec.Key, sec.Required, sec.Description)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	example, err := kyaml.Marshal(map[string][]types.Module{"modules": {s.Example}})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "\nExample:\n%s", example)
+	return nil
+}
+
+func printJSON(w io.Writer, v interface{}) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(v)
+}
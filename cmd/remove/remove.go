@@ -0,0 +1,49 @@
+package remove
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/middlewaregruppen/banana/pkg/bananafile"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+var (
+	fileName string
+)
+
+func NewCmdRemove(fs filesys.FileSystem, w io.Writer) *cobra.Command {
+	c := &cobra.Command{
+		Use:     "remove MODULE",
+		Aliases: []string{"rm"},
+		Args:    cobra.ExactArgs(1),
+		Short:   "Removes a module from the banana specification",
+		Example: `banana remove auth/dex`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !fs.Exists(fileName) {
+				return fmt.Errorf("banana file not found")
+			}
+			kf := bananafile.NewBananaFile(fs)
+			doc, err := kf.ReadDocument(fileName)
+			if err != nil {
+				return err
+			}
+			if err := doc.RemoveModule(args[0]); err != nil {
+				return err
+			}
+			if err := kf.WriteDocument(doc, fileName); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "removed %s from %s\n", args[0], fileName)
+			return nil
+		},
+	}
+	c.Flags().StringVarP(
+		&fileName,
+		"filename",
+		"f",
+		"banana.yaml",
+		"The file that contain the configurations to edit.")
+	return c
+}
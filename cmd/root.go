@@ -3,8 +3,16 @@ package cmd
 import (
 	"os"
 
+	"github.com/middlewaregruppen/banana/cmd/add"
 	"github.com/middlewaregruppen/banana/cmd/build"
 	"github.com/middlewaregruppen/banana/cmd/create"
+	"github.com/middlewaregruppen/banana/cmd/diff"
+	"github.com/middlewaregruppen/banana/cmd/images"
+	"github.com/middlewaregruppen/banana/cmd/migrate"
+	"github.com/middlewaregruppen/banana/cmd/modules"
+	"github.com/middlewaregruppen/banana/cmd/remove"
+	"github.com/middlewaregruppen/banana/cmd/set"
+	"github.com/middlewaregruppen/banana/cmd/validate"
 	"github.com/middlewaregruppen/banana/cmd/vendor"
 	"github.com/middlewaregruppen/banana/cmd/version"
 	"github.com/sirupsen/logrus"
@@ -56,9 +64,17 @@ func NewDefaultCommand() *cobra.Command {
 
 	// Setup sub-commands
 	c.AddCommand(version.NewCmdVersion(stdOut))
-	c.AddCommand(create.NewCmdCreate(fs))
-	c.AddCommand(build.NewCmdBuild(fs, stdOut, builtinModulePrefix))
-	c.AddCommand(vendor.NewCmdVendor(fs, stdOut, builtinModulePrefix))
+	c.AddCommand(create.NewCmdCreate(fs, stdOut, &builtinModulePrefix))
+	c.AddCommand(build.NewCmdBuild(fs, stdOut, &builtinModulePrefix))
+	c.AddCommand(vendor.NewCmdVendor(fs, stdOut, &builtinModulePrefix))
+	c.AddCommand(diff.NewCmdDiff(fs, stdOut, &builtinModulePrefix))
+	c.AddCommand(images.NewCmdImages(fs, stdOut, &builtinModulePrefix))
+	c.AddCommand(validate.NewCmdValidate(fs, stdOut))
+	c.AddCommand(migrate.NewCmdMigrate(fs, stdOut))
+	c.AddCommand(add.NewCmdAdd(fs, stdOut))
+	c.AddCommand(remove.NewCmdRemove(fs, stdOut))
+	c.AddCommand(set.NewCmdSet(fs, stdOut))
+	c.AddCommand(modules.NewCmdModules(fs, stdOut, &builtinModulePrefix))
 
 	return c
 }
@@ -0,0 +1,54 @@
+package set
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/middlewaregruppen/banana/pkg/bananafile"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+var (
+	fileName string
+)
+
+func NewCmdSet(fs filesys.FileSystem, w io.Writer) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "set PATH=VALUE...",
+		Args:  cobra.MinimumNArgs(1),
+		Short: "Sets fields in the banana specification",
+		Long: `Sets fields in the banana specification. Paths starting with the name of a module followed by a '.' are set on that module,
+other paths are set from the top level of the file. An empty value removes the field. Comments and formatting of the file are preserved`,
+		Example: `banana set auth/dex.namespace=infra
+banana set auth/dex.hosts.prefix=infra
+banana set version=v1.0.0`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !fs.Exists(fileName) {
+				return fmt.Errorf("banana file not found")
+			}
+			kf := bananafile.NewBananaFile(fs)
+			doc, err := kf.ReadDocument(fileName)
+			if err != nil {
+				return err
+			}
+			for _, expr := range args {
+				if err := doc.Set(expr); err != nil {
+					return err
+				}
+			}
+			if err := kf.WriteDocument(doc, fileName); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "updated %s\n", fileName)
+			return nil
+		},
+	}
+	c.Flags().StringVarP(
+		&fileName,
+		"filename",
+		"f",
+		"banana.yaml",
+		"The file that contain the configurations to edit.")
+	return c
+}
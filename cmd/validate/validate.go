@@ -0,0 +1,65 @@
+package validate
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/middlewaregruppen/banana/pkg/bananafile"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+var (
+	fileName    string
+	printSchema bool
+)
+
+func NewCmdValidate(fs filesys.FileSystem, w io.Writer) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "validate",
+		Args:  cobra.ExactArgs(0),
+		Short: "Validates a banana specification",
+		Long:  "Validates a banana specification, reporting every problem found with its line and column",
+		Example: `banana validate
+banana validate -f path/to/banana.yaml
+banana validate --print-schema > banana.schema.json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if printSchema {
+				s, err := bananafile.JSONSchema()
+				if err != nil {
+					return err
+				}
+				_, err = w.Write(s)
+				return err
+			}
+
+			if !fs.Exists(fileName) {
+				return fmt.Errorf("banana file not found")
+			}
+			errs, err := bananafile.NewBananaFile(fs).Validate(fileName)
+			if err != nil {
+				return err
+			}
+			for _, e := range errs {
+				fmt.Fprintln(w, e.Error())
+			}
+			if len(errs) > 0 {
+				return fmt.Errorf("%s is invalid, found %d problem(s)", fileName, len(errs))
+			}
+			fmt.Fprintf(w, "%s is valid\n", fileName)
+			return nil
+		},
+	}
+	c.Flags().StringVarP(
+		&fileName,
+		"filename",
+		"f",
+		"banana.yaml",
+		"The file that contain the configurations to validate.")
+	c.Flags().BoolVar(
+		&printSchema,
+		"print-schema",
+		false,
+		"Print the JSON Schema of the banana specification instead of validating")
+	return c
+}
@@ -2,8 +2,10 @@ package bananafile
 
 import (
 	"github.com/middlewaregruppen/banana/api/types"
-	"gopkg.in/yaml.v3"
+	"github.com/middlewaregruppen/banana/api/v1alpha1"
+	"github.com/middlewaregruppen/banana/api/v1beta1"
 	"sigs.k8s.io/kustomize/kyaml/filesys"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
 )
 
 type BananaFile struct {
@@ -15,29 +17,52 @@ func NewBananaFile(fs filesys.FileSystem) *BananaFile {
 	return &BananaFile{fs: fs}
 }
 
-// // BananaFile returns a new instance.
+// Read reads and strictly decodes the banana file at path, converting it into the latest version.
+// If the file is invalid then ValidationErrors is returned holding every problem found.
 func (k *BananaFile) Read(path string) (*types.BananaFile, error) {
+	errs, err := k.Validate(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
 	data, err := k.fs.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
 
-	var kf types.BananaFile
-	if err := yaml.Unmarshal(data, &kf); err != nil {
+	var meta types.TypeMeta
+	if err := kyaml.Unmarshal(data, &meta); err != nil {
 		return nil, err
 	}
 
+	// Decode the version declared in the file and convert it into the latest
+	var kf types.BananaFile
+	switch meta.APIVersion {
+	case v1alpha1.APIVersion, v1alpha1.LegacyAPIVersion:
+		var old v1alpha1.BananaFile
+		if err := kyaml.Unmarshal(data, &old); err != nil {
+			return nil, err
+		}
+		if err := old.ConvertTo(&kf); err != nil {
+			return nil, err
+		}
+	default:
+		if err := kyaml.Unmarshal(data, &kf); err != nil {
+			return nil, err
+		}
+	}
+	v1beta1.SetDefaults(&kf)
+
 	return &kf, nil
 }
 
 func (k *BananaFile) Write(kf *types.BananaFile, path string) error {
-	d, err := yaml.Marshal(kf)
+	d, err := kyaml.Marshal(kf)
 	if err != nil {
 		return err
 	}
-	err = k.fs.WriteFile(path, d)
-	if err != nil {
-		return nil
-	}
-	return nil
+	return k.fs.WriteFile(path, d)
 }
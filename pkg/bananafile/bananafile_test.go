@@ -0,0 +1,380 @@
+package bananafile
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+func TestValidate(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			"valid",
+			`kind: Banana
+apiVersion: banana.io/v1alpha1
+modules:
+- name: ingress/nginx
+  components:
+  - tls
+  secrets:
+  - PASSWORD=pass=word
+  hosts:
+    prefix: infra
+    wildcard: example.com
+`,
+			nil,
+		},
+		{
+			"unknown fields and wrong api version",
+			`kind: Banana
+apiVersion: banana.io/v1
+modules:
+- name: logging/loki
+  component:
+  - minio
+`,
+			[]string{
+				`banana.yaml:2:13: unsupported apiVersion "banana.io/v1", expected "banana.io/v1beta1"`,
+				`banana.yaml:5:3: unknown field "component" in modules[0], did you mean "components"?`,
+			},
+		},
+		{
+			"legacy api version and secrets from files",
+			`kind: Banana
+apiVersion: konf.io/v1alpha1
+modules:
+- name: logging/loki
+  components:
+  - minio
+  secrets:
+  - "@config.json=files/config.json"
+  - "@token=ref+vault://kv/app#token"
+`,
+			[]string{
+				`banana.yaml:9:5: secret @token must have the path of the file to read as value`,
+			},
+		},
+		{
+			"secrets, hosts and types",
+			`kind: Banana
+apiVersion: banana.io/v1alpha1
+modules:
+- name: auth/dex
+  components: tls
+  secrets:
+  - PASSWORD
+  - BAD KEY=value
+  - TOKEN=ref+vault://
+  hosts:
+    hostname: Dex_Example
+    prefix: infra
+- name: auth/dex
+`,
+			[]string{
+				`banana.yaml:1:1: externalSecrets.secretStoreRef.name is required when secrets reference an external secret store`,
+				`banana.yaml:5:15: modules[0].components must be a list`,
+				`banana.yaml:7:5: secret "PASSWORD" must be in the form of KEY=VALUE`,
+				`banana.yaml:8:5: secret key "BAD KEY" must consist of alphanumeric characters, '-', '_' or '.', optionally prefixed with '@'`,
+				`banana.yaml:9:5: invalid reference for secret TOKEN: expected the form ref+<provider>://<key>[#<property>]`,
+				`banana.yaml:11:15: hostname "Dex_Example" is not a valid DNS name`,
+				`banana.yaml:12:13: prefix is ignored when hostname is set`,
+				`banana.yaml:13:9: module "auth/dex" is already declared at line 4`,
+			},
+		},
+		{
+			"patches",
+			`kind: Banana
+apiVersion: banana.io/v1beta1
+modules:
+- name: ingress/nginx
+  patches:
+  - path: patches/replicas.yaml
+  - target:
+      kind: Deployment
+  - path: patches/probes.yaml
+    patch: |
+      - op: remove
+        path: /spec/template/spec/containers/0/livenessProbe
+`,
+			[]string{
+				`banana.yaml:7:5: patch requires either path or patch`,
+				`banana.yaml:10:12: patch can't be given along with path`,
+			},
+		},
+		{
+			"component versions",
+			`kind: Banana
+apiVersion: banana.io/v1beta1
+modules:
+- name: ingress/nginx
+  version: v1.0.0
+  components:
+  - name: tls
+    version: v1.1.0
+  - name: metrics
+    version: ""
+- name: auth/dex
+  ref: refs/heads/main
+  components:
+  - name: tls
+    version: v1.1.0
+`,
+			[]string{
+				`banana.yaml:10:14: component metrics version must not be empty`,
+				`banana.yaml:15:14: component tls can't be pinned to a version when the module is pinned to a ref`,
+			},
+		},
+		{
+			"images",
+			`kind: Banana
+apiVersion: banana.io/v1beta1
+imageRegistry:
+  registries:
+  - docker.io
+imageFieldSpecs:
+- kind: Rollout
+modules:
+- name: ingress/nginx
+  images:
+  - newTag: v1.10.0
+`,
+			[]string{
+				`banana.yaml:4:3: imageRegistry.mirror is required`,
+				`banana.yaml:7:3: field spec path is required`,
+				`banana.yaml:11:5: image name is required`,
+			},
+		},
+		{
+			"namespaces",
+			`kind: Banana
+apiVersion: banana.io/v1beta1
+namespaces:
+- name: ingress-nginx
+  labels:
+    pod-security.kubernetes.io/enforce: baseline
+- labels:
+    pod-security.kubernetes.io/enforce: restricted
+- name: ingress-nginx
+`,
+			[]string{
+				`banana.yaml:7:3: namespace name is required`,
+				`banana.yaml:9:9: namespace "ingress-nginx" is already declared at line 4`,
+			},
+		},
+		{
+			"conflict strategy",
+			`kind: Banana
+apiVersion: banana.io/v1beta1
+conflicts:
+  strategy: last-wins
+`,
+			[]string{
+				`banana.yaml:4:13: unknown conflict strategy "last-wins", must be one of fail, first-wins or merge-if-identical`,
+			},
+		},
+		{
+			"export layout",
+			`kind: Banana
+apiVersion: banana.io/v1beta1
+export:
+  layout: by-name
+  ordering: alphabetical
+dependencies:
+  missing: ignore
+`,
+			[]string{
+				`banana.yaml:4:11: unknown layout "by-name", must be one of flat, by-kind or by-namespace/kind`,
+				`banana.yaml:5:13: unknown ordering "alphabetical", must be one of none, numbered or sync-waves`,
+				`banana.yaml:7:12: unknown strategy for missing dependencies "ignore", must be one of fail or add`,
+			},
+		},
+		{
+			"argocd without repo url",
+			`kind: Banana
+apiVersion: banana.io/v1beta1
+export:
+  argocd:
+    targetRevision: main
+`,
+			[]string{
+				`banana.yaml:5:5: export.argocd.repoURL is required`,
+			},
+		},
+		{
+			"argocd with age recipients but no plugin",
+			`kind: Banana
+apiVersion: banana.io/v1beta1
+age:
+  recipients:
+  - age1geawfzgrvdv5v8kd28wq8a34vvqg3zcztx76h9du95d5m62s0qhsgkrqlg
+export:
+  argocd:
+    repoURL: https://github.com/example/deploy.git
+`,
+			[]string{
+				`banana.yaml:8:5: export.argocd.plugin is required when age recipients are set, so that Argo CD decrypts secrets before applying them`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := filesys.MakeFsInMemory()
+			err := fs.WriteFile("banana.yaml", []byte(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			errs, err := NewBananaFile(fs).Validate("banana.yaml")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range errs {
+				got = append(got, e.Error())
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestJSONSchemaUpToDate(t *testing.T) {
+	want, err := JSONSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile("../../api/banana.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, string(want), string(got), "api/banana.schema.json is out of date, run make schema")
+}
+
+func TestMigrate(t *testing.T) {
+	input := `# The banana file
+kind: Banana
+apiVersion: %s
+externalSecrets:
+  secretStoreRef:
+    name: vault
+modules:
+# Ingress controller
+- name: ingress/nginx
+  components:
+  - tls # terminate tls
+  secrets:
+  # Credentials
+  - USERNAME=admin
+  - PASSWORD=ref+vault://kv/app#password
+`
+	want := `# The banana file
+kind: Banana
+apiVersion: banana.io/v1beta1
+externalSecrets:
+  secretStoreRef:
+    name: vault
+modules:
+# Ingress controller
+- name: ingress/nginx
+  components:
+  - name: tls # terminate tls
+  secrets:
+  # Credentials
+  - key: USERNAME
+    value: admin
+  - key: PASSWORD
+    ref: vault://kv/app#password
+`
+	for _, apiVersion := range []string{"banana.io/v1alpha1", "konf.io/v1alpha1"} {
+		t.Run(apiVersion, func(t *testing.T) {
+			fs := filesys.MakeFsInMemory()
+			err := fs.WriteFile("banana.yaml", []byte(fmt.Sprintf(input, apiVersion)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			kf := NewBananaFile(fs)
+			doc, err := kf.ReadDocument("banana.yaml")
+			if err != nil {
+				t.Fatal(err)
+			}
+			migrated, err := doc.Migrate()
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.True(t, migrated)
+			err = kf.WriteDocument(doc, "banana.yaml")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := fs.ReadFile("banana.yaml")
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, want, string(got))
+		})
+	}
+}
+
+func TestDocumentEdit(t *testing.T) {
+	input := `kind: Banana
+apiVersion: banana.io/v1beta1
+modules:
+# Identity provider
+- name: auth/dex # pinned
+  version: v1.0.0 # upgrade later
+- name: logging/loki
+`
+	want := `kind: Banana
+apiVersion: banana.io/v1beta1
+modules:
+# Identity provider
+- name: auth/dex # pinned
+  version: v1.1.0 # upgrade later
+  components:
+  - name: tls
+  namespace: infra
+- name: ingress/nginx
+  version: v1.2.0
+  components:
+  - name: tls
+`
+	fs := filesys.MakeFsInMemory()
+	err := fs.WriteFile("banana.yaml", []byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kf := NewBananaFile(fs)
+	doc, err := kf.ReadDocument("banana.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, doc.AddModule(types.Module{Name: "ingress/nginx", Version: "v1.2.0", Components: []types.Component{{Name: "tls"}}}))
+	assert.NoError(t, doc.AddModule(types.Module{Name: "auth/dex", Components: []types.Component{{Name: "tls"}}}))
+	assert.NoError(t, doc.RemoveModule("logging/loki"))
+	assert.Error(t, doc.RemoveModule("logging/loki"))
+	assert.NoError(t, doc.Set("auth/dex.namespace=infra"))
+	assert.NoError(t, doc.Set("auth/dex.version=v1.1.0"))
+	assert.Error(t, doc.Set("auth/dex.components=tls"))
+
+	err = kf.WriteDocument(doc, "banana.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := fs.ReadFile("banana.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, want, string(got))
+
+	// Invalid edits are never written
+	assert.NoError(t, doc.Set("auth/dex.hosts.hostname=Not_Valid"))
+	assert.Error(t, kf.WriteDocument(doc, "banana.yaml"))
+}
@@ -0,0 +1,98 @@
+package bananafile
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// Document is a banana file kept as a yaml node tree. Editing the document rather than
+// the decoded types preserves comments, ordering and formatting of the file.
+type Document struct {
+	path      string
+	node      *kyaml.Node
+	seqIndent kyaml.SequenceIndentStyle
+}
+
+// ReadDocument reads the banana file at path into a Document
+func (k *BananaFile) ReadDocument(path string) (*Document, error) {
+	data, err := k.fs.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if doc.Kind != kyaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != kyaml.MappingNode {
+		return nil, fmt.Errorf("%s: expected a mapping at the top level", path)
+	}
+	return &Document{
+		path:      path,
+		node:      doc,
+		seqIndent: kyaml.SequenceIndentStyle(kyaml.DeriveSeqIndentStyle(string(data))),
+	}, nil
+}
+
+// WriteDocument validates the document and writes it to path. Nothing is written if the document is invalid.
+func (k *BananaFile) WriteDocument(d *Document, path string) error {
+	if errs := d.Validate(); len(errs) > 0 {
+		return errs
+	}
+	data, err := d.Bytes()
+	if err != nil {
+		return err
+	}
+	return k.fs.WriteFile(path, data)
+}
+
+// Root returns the top level mapping node of the document
+func (d *Document) Root() *kyaml.Node {
+	return d.node.Content[0]
+}
+
+// APIVersion returns the api version of the document
+func (d *Document) APIVersion() string {
+	if n := field(d.Root(), "apiVersion"); n != nil {
+		return n.Value
+	}
+	return ""
+}
+
+// Validate returns every problem found in the document
+func (d *Document) Validate() ValidationErrors {
+	return validate(d.path, d.node)
+}
+
+// Bytes encodes the document using the sequence indentation style of the original file
+func (d *Document) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	e := kyaml.NewEncoderWithOptions(&buf, &kyaml.EncoderOptions{SeqIndent: d.seqIndent})
+	if err := e.Encode(d.node); err != nil {
+		return nil, err
+	}
+	if err := e.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// NewDocument returns a new document for the banana file kf which is written to path
+func NewDocument(path string, kf *types.BananaFile) (*Document, error) {
+	n := &kyaml.Node{}
+	if err := n.Encode(kf); err != nil {
+		return nil, err
+	}
+	return &Document{
+		path:      path,
+		node:      &kyaml.Node{Kind: kyaml.DocumentNode, Content: []*kyaml.Node{n}},
+		seqIndent: kyaml.CompactSequenceStyle,
+	}, nil
+}
+
+// SetFootComment sets the comment written at the end of the document. Each line of s must start with '#'.
+func (d *Document) SetFootComment(s string) {
+	d.node.FootComment = s
+}
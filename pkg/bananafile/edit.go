@@ -0,0 +1,209 @@
+package bananafile
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/middlewaregruppen/banana/api/v1alpha1"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// ensureLatest returns an error if the document is not of the latest api version since
+// edits are always made using the structure of the latest version
+func (d *Document) ensureLatest() error {
+	if v := d.APIVersion(); v != types.APIVersion {
+		return fmt.Errorf("%s is of version %s, run banana migrate to upgrade it to %s before editing", d.path, v, types.APIVersion)
+	}
+	return nil
+}
+
+// modules returns the sequence node holding the modules of the document, creating it if create is true
+func (d *Document) modules(create bool) *kyaml.Node {
+	root := d.Root()
+	if n := field(root, "modules"); n != nil && n.Kind == kyaml.SequenceNode {
+		return n
+	}
+	if !create {
+		return nil
+	}
+	n := &kyaml.Node{Kind: kyaml.SequenceNode, Tag: "!!seq"}
+	setField(root, "modules", n)
+	return n
+}
+
+// findModule returns the index and node of the module with the given name, or -1 if not found
+func (d *Document) findModule(name string) (int, *kyaml.Node) {
+	modules := d.modules(false)
+	if modules == nil {
+		return -1, nil
+	}
+	for i, m := range modules.Content {
+		if n := field(m, "name"); n != nil && n.Value == name {
+			return i, m
+		}
+	}
+	return -1, nil
+}
+
+// AddModule adds the module to the document. If the module is already declared then its version,
+// ref and namespace are updated if set on m, and components and secrets not already present are added.
+func (d *Document) AddModule(m types.Module) error {
+	if err := d.ensureLatest(); err != nil {
+		return err
+	}
+	if len(m.Name) == 0 {
+		return fmt.Errorf("module name is required")
+	}
+
+	_, existing := d.findModule(m.Name)
+	if existing == nil {
+		n := &kyaml.Node{}
+		if err := n.Encode(m); err != nil {
+			return err
+		}
+		modules := d.modules(true)
+		modules.Content = append(modules.Content, n)
+		return nil
+	}
+
+	for _, kv := range [][2]string{{"version", m.Version}, {"ref", m.Ref}, {"namespace", m.Namespace}} {
+		if len(kv[1]) > 0 {
+			setField(existing, kv[0], scalar(kv[1]))
+		}
+	}
+	for _, c := range m.Components {
+		if err := appendUnique(existing, "components", "name", c.Name, c); err != nil {
+			return err
+		}
+	}
+	for _, s := range m.Secrets {
+		if err := appendUnique(existing, "secrets", "key", s.Key, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveModule removes the module with the given name from the document along with its comments
+func (d *Document) RemoveModule(name string) error {
+	i, m := d.findModule(name)
+	if m == nil {
+		return fmt.Errorf("module %s is not declared in %s", name, d.path)
+	}
+	modules := d.modules(false)
+	modules.Content = append(modules.Content[:i], modules.Content[i+1:]...)
+	return nil
+}
+
+// Set sets a scalar field of the document using an expression in the form of path=value. If the path
+// starts with the name of a declared module followed by a '.', the remainder of the path is set on that module.
+// For example auth/dex.namespace=infra or auth/dex.hosts.prefix=infra. Other paths are set from the top level
+// of the document, for example version=v1.0.0. An empty value removes the field.
+func (d *Document) Set(expr string) error {
+	if err := d.ensureLatest(); err != nil {
+		return err
+	}
+	path, value, ok := strings.Cut(expr, "=")
+	if !ok || len(path) == 0 {
+		return fmt.Errorf("%q must be in the form of path=value", expr)
+	}
+
+	node, fieldPath := d.Root(), path
+	if modules := d.modules(false); modules != nil {
+		// Pick the longest matching module name since names may contain dots
+		best := ""
+		for _, m := range modules.Content {
+			n := field(m, "name")
+			if n != nil && strings.HasPrefix(path, n.Value+".") && len(n.Value) > len(best) {
+				best, node = n.Value, m
+			}
+		}
+		if len(best) > 0 {
+			fieldPath = strings.TrimPrefix(path, best+".")
+		}
+	}
+
+	keys := strings.Split(fieldPath, ".")
+	for _, k := range keys[:len(keys)-1] {
+		next := field(node, k)
+		if next == nil {
+			if len(value) == 0 {
+				return nil
+			}
+			next = &kyaml.Node{Kind: kyaml.MappingNode, Tag: "!!map"}
+			setField(node, k, next)
+		}
+		if next.Kind != kyaml.MappingNode {
+			return fmt.Errorf("unable to set %s, %s is not a mapping", path, k)
+		}
+		node = next
+	}
+
+	last := keys[len(keys)-1]
+	if existing := field(node, last); existing != nil && existing.Kind != kyaml.ScalarNode {
+		return fmt.Errorf("unable to set %s, only scalar values can be set", path)
+	}
+	if len(value) == 0 {
+		removeField(node, last)
+		return nil
+	}
+	setField(node, last, scalar(value))
+	return nil
+}
+
+// appendUnique encodes v and appends it to the sequence in field seqKey of the mapping node m,
+// unless an item with the same value at idKey already exists
+func appendUnique(m *kyaml.Node, seqKey, idKey, id string, v interface{}) error {
+	seq := field(m, seqKey)
+	if seq == nil {
+		seq = &kyaml.Node{Kind: kyaml.SequenceNode, Tag: "!!seq"}
+		setField(m, seqKey, seq)
+	}
+	for _, item := range seq.Content {
+		if n := field(item, idKey); n != nil && n.Value == id {
+			return nil
+		}
+	}
+	n := &kyaml.Node{}
+	if err := n.Encode(v); err != nil {
+		return err
+	}
+	seq.Content = append(seq.Content, n)
+	return nil
+}
+
+// setField sets the value of key in the mapping node m, keeping the position and comments of an existing key
+func setField(m *kyaml.Node, key string, value *kyaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			value.LineComment = m.Content[i+1].LineComment
+			m.Content[i+1] = value
+			return
+		}
+	}
+	m.Content = append(m.Content, scalar(key), value)
+}
+
+// removeField removes key from the mapping node m
+func removeField(m *kyaml.Node, key string) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content = append(m.Content[:i], m.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+// scalar returns a scalar node holding s with its tag resolved the same way as when parsing
+func scalar(s string) *kyaml.Node {
+	n := &kyaml.Node{Kind: kyaml.ScalarNode, Value: s}
+	n.Tag = n.ShortTag()
+	return n
+}
+
+// ParseSecret parses a secret in the form of KEY=VALUE. Values prefixed with ref+ are parsed as
+// references to an external secret store, for example KEY=ref+vault://kv/app#password
+func ParseSecret(s string) (types.Secret, error) {
+	return v1alpha1.ConvertSecret(s)
+}
@@ -0,0 +1,86 @@
+package bananafile
+
+import (
+	"fmt"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/middlewaregruppen/banana/api/v1alpha1"
+	"github.com/middlewaregruppen/banana/api/v1beta1"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// Migrate rewrites the document to the latest api version in place. Comments, ordering and formatting
+// are preserved. Returns false if the document already is of the latest version.
+func (d *Document) Migrate() (bool, error) {
+	switch d.APIVersion() {
+	case types.APIVersion:
+		return false, nil
+	case v1alpha1.APIVersion, v1alpha1.LegacyAPIVersion:
+		if err := migrateV1alpha1(d.Root()); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	return false, fmt.Errorf("unable to migrate from unsupported apiVersion %q", d.APIVersion())
+}
+
+// migrateV1alpha1 converts a v1alpha1 root node into v1beta1
+func migrateV1alpha1(root *kyaml.Node) error {
+	if n := field(root, "apiVersion"); n != nil {
+		n.Value = v1beta1.APIVersion
+	}
+
+	modules := field(root, "modules")
+	if modules == nil || modules.Kind != kyaml.SequenceNode {
+		return nil
+	}
+	for _, m := range modules.Content {
+		if components := field(m, "components"); components != nil && components.Kind == kyaml.SequenceNode {
+			for i, c := range components.Content {
+				if c.Kind != kyaml.ScalarNode {
+					continue
+				}
+				components.Content[i] = mappingFromScalar(c, "name", c.Value)
+			}
+		}
+		if secrets := field(m, "secrets"); secrets != nil && secrets.Kind == kyaml.SequenceNode {
+			for i, s := range secrets.Content {
+				if s.Kind != kyaml.ScalarNode {
+					continue
+				}
+				sec, err := v1alpha1.ConvertSecret(s.Value)
+				if err != nil {
+					return fmt.Errorf("line %d: %w", s.Line, err)
+				}
+				if len(sec.Ref) > 0 {
+					secrets.Content[i] = mappingFromScalar(s, "key", sec.Key, "ref", sec.Ref)
+				} else {
+					secrets.Content[i] = mappingFromScalar(s, "key", sec.Key, "value", sec.Value)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// mappingFromScalar returns a mapping node holding the given key value pairs which replaces the scalar node n.
+// Comments of n are moved onto the mapping.
+func mappingFromScalar(n *kyaml.Node, kv ...string) *kyaml.Node {
+	m := &kyaml.Node{
+		Kind:        kyaml.MappingNode,
+		Tag:         "!!map",
+		HeadComment: n.HeadComment,
+		FootComment: n.FootComment,
+		Line:        n.Line,
+		Column:      n.Column,
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		m.Content = append(m.Content,
+			&kyaml.Node{Kind: kyaml.ScalarNode, Tag: "!!str", Value: kv[i]},
+			&kyaml.Node{Kind: kyaml.ScalarNode, Tag: "!!str", Value: kv[i+1]},
+		)
+	}
+	// Keep a trailing comment at the end of the line of the last value
+	m.Content[len(m.Content)-1].LineComment = n.LineComment
+	return m
+}
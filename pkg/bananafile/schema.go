@@ -0,0 +1,65 @@
+package bananafile
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/middlewaregruppen/banana/api/types"
+)
+
+const schemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// JSONSchema returns a JSON Schema describing the banana file, suitable for editor integration
+func JSONSchema() ([]byte, error) {
+	s := schemaFor(reflect.TypeOf(types.BananaFile{}))
+	s["$schema"] = schemaDraft
+	s["title"] = "banana.yaml"
+	props := s["properties"].(map[string]interface{})
+	props["kind"] = map[string]interface{}{"const": types.Kind}
+	props["apiVersion"] = map[string]interface{}{"enum": []string{types.APIVersion}}
+	s["required"] = []string{"apiVersion", "kind"}
+
+	d, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(d, '\n'), nil
+}
+
+// schemaFor returns the JSON schema of the type t using its yaml field names
+func schemaFor(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		props := map[string]interface{}{}
+		for name, ft := range yamlFields(t) {
+			props[name] = schemaFor(ft)
+		}
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           props,
+			"additionalProperties": false,
+		}
+	case reflect.Slice:
+		return map[string]interface{}{
+			"type":  "array",
+			"items": schemaFor(t.Elem()),
+		}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": schemaFor(t.Elem()),
+		}
+	case reflect.Interface:
+		return map[string]interface{}{}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	}
+	return map[string]interface{}{"type": "integer"}
+}
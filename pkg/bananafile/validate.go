@@ -0,0 +1,565 @@
+package bananafile
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/middlewaregruppen/banana/api/v1alpha1"
+	"github.com/middlewaregruppen/banana/api/v1beta1"
+	"github.com/middlewaregruppen/banana/pkg/module"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+var (
+	// versions maps every supported api version to the type of its banana file
+	versions = map[string]reflect.Type{
+		v1alpha1.APIVersion:       reflect.TypeOf(v1alpha1.BananaFile{}),
+		v1alpha1.LegacyAPIVersion: reflect.TypeOf(v1alpha1.BananaFile{}),
+		v1beta1.APIVersion:        reflect.TypeOf(v1beta1.BananaFile{}),
+	}
+
+	// secretKeyRegexp matches valid keys of a Kubernetes Secret, optionally prefixed with @ for secrets read from a file
+	secretKeyRegexp = regexp.MustCompile(`^@?[-._a-zA-Z0-9]+$`)
+
+	// dnsLabelRegexp matches a RFC 1123 DNS label
+	dnsLabelRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+)
+
+// ValidationError is a problem found in a banana file at a specific line and column
+type ValidationError struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Message)
+}
+
+// ValidationErrors is a list of problems found in a banana file
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+type validator struct {
+	file string
+	errs ValidationErrors
+}
+
+func (v *validator) errorf(n *kyaml.Node, format string, args ...interface{}) {
+	v.errs = append(v.errs, ValidationError{
+		File:    v.file,
+		Line:    n.Line,
+		Column:  n.Column,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// Validate reads the banana file at path and returns every problem found in it.
+// The returned error is only non-nil if the file could not be read or parsed as YAML.
+func (k *BananaFile) Validate(path string) (ValidationErrors, error) {
+	data, err := k.fs.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return validate(path, doc), nil
+}
+
+// parse parses data into a yaml document node
+func parse(data []byte) (*kyaml.Node, error) {
+	var doc kyaml.Node
+	if err := kyaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// validate returns every problem found in the given yaml document
+func validate(file string, doc *kyaml.Node) ValidationErrors {
+	v := &validator{file: file}
+	if doc.Kind != kyaml.DocumentNode || len(doc.Content) == 0 {
+		v.errorf(doc, "file is empty")
+		return v.errs
+	}
+	root := doc.Content[0]
+	if root.Kind != kyaml.MappingNode {
+		v.errorf(root, "document must be a mapping")
+		return v.errs
+	}
+
+	// Check the structure against the version declared in the file, falling back to the latest
+	t := reflect.TypeOf(types.BananaFile{})
+	if apiVersion := field(root, "apiVersion"); apiVersion != nil {
+		if vt, ok := versions[apiVersion.Value]; ok {
+			t = vt
+		}
+	}
+	v.checkStructure(root, t, "")
+	v.checkBananaFile(root)
+	sort.SliceStable(v.errs, func(i, j int) bool {
+		if v.errs[i].Line != v.errs[j].Line {
+			return v.errs[i].Line < v.errs[j].Line
+		}
+		return v.errs[i].Column < v.errs[j].Column
+	})
+	return v.errs
+}
+
+// checkStructure strictly checks the node against the type t, reporting unknown fields and mismatching node kinds
+func (v *validator) checkStructure(n *kyaml.Node, t reflect.Type, path string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if n.Kind == kyaml.AliasNode {
+		n = n.Alias
+	}
+	if n.Kind == kyaml.ScalarNode && n.Tag == "!!null" {
+		return
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if n.Kind != kyaml.MappingNode {
+			v.errorf(n, "%s must be a mapping", describe(path))
+			return
+		}
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, val := n.Content[i], n.Content[i+1]
+			ft, ok := fields[key.Value]
+			if !ok {
+				v.errorf(key, "unknown field %q in %s%s", key.Value, describe(path), suggest(key.Value, fields))
+				continue
+			}
+			v.checkStructure(val, ft, join(path, key.Value))
+		}
+	case reflect.Slice:
+		if n.Kind != kyaml.SequenceNode {
+			v.errorf(n, "%s must be a list", describe(path))
+			return
+		}
+		for i, item := range n.Content {
+			v.checkStructure(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))
+		}
+	case reflect.Map:
+		if n.Kind != kyaml.MappingNode {
+			v.errorf(n, "%s must be a mapping", describe(path))
+			return
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			v.checkStructure(n.Content[i+1], t.Elem(), join(path, n.Content[i].Value))
+		}
+	case reflect.Interface:
+		return
+	default:
+		if n.Kind != kyaml.ScalarNode {
+			v.errorf(n, "%s must be a %s", describe(path), scalarName(t.Kind()))
+			return
+		}
+		var out = reflect.New(t)
+		if err := n.Decode(out.Interface()); err != nil {
+			v.errorf(n, "%s must be a %s", describe(path), scalarName(t.Kind()))
+		}
+	}
+}
+
+// checkBananaFile performs semantic checks of the root node of a banana file
+func (v *validator) checkBananaFile(root *kyaml.Node) {
+	kind := field(root, "kind")
+	switch {
+	case kind == nil:
+		v.errorf(root, "kind is required, expected %q", types.Kind)
+	case kind.Value != types.Kind:
+		v.errorf(kind, "unsupported kind %q, expected %q", kind.Value, types.Kind)
+	}
+
+	apiVersion := field(root, "apiVersion")
+	if apiVersion == nil {
+		v.errorf(root, "apiVersion is required, expected %q", types.APIVersion)
+	} else if _, ok := versions[apiVersion.Value]; !ok {
+		v.errorf(apiVersion, "unsupported apiVersion %q, expected %q", apiVersion.Value, types.APIVersion)
+	}
+
+	if ss := field(root, "sealedSecrets"); ss != nil && ss.Kind == kyaml.MappingNode {
+		if cert := field(ss, "certificate"); cert == nil || len(cert.Value) == 0 {
+			v.errorf(ss, "sealedSecrets.certificate is required")
+		}
+		if scope := field(ss, "scope"); scope != nil {
+			if _, err := module.ParseSealedSecretScope(scope.Value); err != nil {
+				v.errorf(scope, "%s", err)
+			}
+		}
+	}
+
+	if export := field(root, "export"); export != nil && export.Kind == kyaml.MappingNode {
+		if layout := field(export, "layout"); layout != nil {
+			if _, err := module.ParseLayout(layout.Value); err != nil {
+				v.errorf(layout, "%s", err)
+			}
+		}
+		if ordering := field(export, "ordering"); ordering != nil {
+			if _, err := types.ParseOrdering(ordering.Value); err != nil {
+				v.errorf(ordering, "%s", err)
+			}
+		}
+		if argocd := field(export, "argocd"); argocd != nil && argocd.Kind == kyaml.MappingNode {
+			if repoURL := field(argocd, "repoURL"); repoURL == nil || len(repoURL.Value) == 0 {
+				v.errorf(argocd, "export.argocd.repoURL is required")
+			}
+			if recipients := field(field(root, "age"), "recipients"); recipients != nil && len(recipients.Content) > 0 {
+				if plugin := field(argocd, "plugin"); plugin == nil || len(plugin.Value) == 0 {
+					v.errorf(argocd, "export.argocd.plugin is required when age recipients are set, so that Argo CD decrypts secrets before applying them")
+				}
+			}
+		}
+	}
+
+	if deps := field(root, "dependencies"); deps != nil && deps.Kind == kyaml.MappingNode {
+		if missing := field(deps, "missing"); missing != nil {
+			if _, err := types.ParseMissingDependencies(missing.Value); err != nil {
+				v.errorf(missing, "%s", err)
+			}
+		}
+	}
+
+	if conflicts := field(root, "conflicts"); conflicts != nil && conflicts.Kind == kyaml.MappingNode {
+		if strategy := field(conflicts, "strategy"); strategy != nil {
+			if _, err := types.ParseConflictStrategy(strategy.Value); err != nil {
+				v.errorf(strategy, "%s", err)
+			}
+		}
+	}
+
+	if ir := field(root, "imageRegistry"); ir != nil && ir.Kind == kyaml.MappingNode {
+		if mirror := field(ir, "mirror"); mirror == nil || len(mirror.Value) == 0 {
+			v.errorf(ir, "imageRegistry.mirror is required")
+		}
+	}
+	if specs := field(root, "imageFieldSpecs"); specs != nil && specs.Kind == kyaml.SequenceNode {
+		for _, s := range specs.Content {
+			if s.Kind == kyaml.MappingNode && field(s, "path") == nil {
+				v.errorf(s, "field spec path is required")
+			}
+		}
+	}
+
+	if namespaces := field(root, "namespaces"); namespaces != nil && namespaces.Kind == kyaml.SequenceNode {
+		seen := map[string]*kyaml.Node{}
+		for _, ns := range namespaces.Content {
+			if ns.Kind != kyaml.MappingNode {
+				continue
+			}
+			name := field(ns, "name")
+			if name == nil || len(name.Value) == 0 {
+				v.errorf(ns, "namespace name is required")
+			} else if prev, ok := seen[name.Value]; ok {
+				v.errorf(name, "namespace %q is already declared at line %d", name.Value, prev.Line)
+			} else {
+				seen[name.Value] = name
+			}
+		}
+	}
+
+	modules := field(root, "modules")
+	if modules == nil || modules.Kind != kyaml.SequenceNode {
+		return
+	}
+	seen := map[string]*kyaml.Node{}
+	hasRefs := false
+	for _, m := range modules.Content {
+		if m.Kind != kyaml.MappingNode {
+			continue
+		}
+		name := field(m, "name")
+		if name == nil || len(name.Value) == 0 {
+			v.errorf(m, "module name is required")
+		} else if prev, ok := seen[name.Value]; ok {
+			v.errorf(name, "module %q is already declared at line %d", name.Value, prev.Line)
+		} else {
+			seen[name.Value] = name
+		}
+
+		if components := field(m, "components"); components != nil && components.Kind == kyaml.SequenceNode {
+			for _, c := range components.Content {
+				v.checkComponent(c, field(m, "ref"))
+			}
+		}
+
+		if secrets := field(m, "secrets"); secrets != nil && secrets.Kind == kyaml.SequenceNode {
+			for _, s := range secrets.Content {
+				if v.checkSecret(s) {
+					hasRefs = true
+				}
+			}
+		}
+
+		if hosts := field(m, "hosts"); hosts != nil && hosts.Kind == kyaml.MappingNode {
+			v.checkHosts(hosts)
+		}
+
+		if images := field(m, "images"); images != nil && images.Kind == kyaml.SequenceNode {
+			for _, img := range images.Content {
+				if img.Kind == kyaml.MappingNode && field(img, "name") == nil {
+					v.errorf(img, "image name is required")
+				}
+			}
+		}
+
+		if patches := field(m, "patches"); patches != nil && patches.Kind == kyaml.SequenceNode {
+			for _, p := range patches.Content {
+				v.checkPatch(p)
+			}
+		}
+	}
+
+	if hasRefs {
+		es := field(root, "externalSecrets")
+		if es == nil || field(es, "secretStoreRef") == nil || field(field(es, "secretStoreRef"), "name") == nil {
+			v.errorf(root, "externalSecrets.secretStoreRef.name is required when secrets reference an external secret store")
+		}
+	}
+}
+
+// checkComponent checks a component which is either a name or, since v1beta1, a mapping with a name and version.
+// Components are pinned to tags, so a version can't be given when the module is pinned to a ref.
+func (v *validator) checkComponent(n, moduleRef *kyaml.Node) {
+	name := n
+	if n.Kind == kyaml.MappingNode {
+		name = field(n, "name")
+		if name == nil {
+			v.errorf(n, "component name is required")
+			return
+		}
+		if version := field(n, "version"); version != nil {
+			if len(version.Value) == 0 {
+				v.errorf(version, "component %s version must not be empty", name.Value)
+			} else if moduleRef != nil {
+				v.errorf(version, "component %s can't be pinned to a version when the module is pinned to a ref", name.Value)
+			}
+		}
+	}
+	if name.Kind == kyaml.ScalarNode && len(name.Value) == 0 {
+		v.errorf(name, "component name must not be empty")
+	}
+}
+
+// checkSecret checks a secret which is either in the form of KEY=VALUE or, since v1beta1, a mapping
+// with a key and either a value or a ref. Returns true if the secret is a reference.
+func (v *validator) checkSecret(n *kyaml.Node) bool {
+	var s module.Secret
+	switch n.Kind {
+	case kyaml.ScalarNode:
+		key, val, ok := strings.Cut(n.Value, "=")
+		if !ok {
+			v.errorf(n, "secret %q must be in the form of KEY=VALUE", n.Value)
+			return false
+		}
+		s = module.Secret{Key: key, Value: val}
+	case kyaml.MappingNode:
+		key, val, ref := field(n, "key"), field(n, "value"), field(n, "ref")
+		if key == nil {
+			v.errorf(n, "secret key is required")
+			return false
+		}
+		s.Key = key.Value
+		if val != nil && ref != nil {
+			v.errorf(ref, "secret %s must have either a value or a ref, not both", key.Value)
+		}
+		if val != nil {
+			s.Value = val.Value
+		}
+		if ref != nil {
+			s.Value = "ref+" + ref.Value
+		}
+	default:
+		return false
+	}
+	if !secretKeyRegexp.MatchString(s.Key) {
+		v.errorf(n, "secret key %q must consist of alphanumeric characters, '-', '_' or '.', optionally prefixed with '@'", s.Key)
+	}
+	if s.IsFile() && (s.IsRef() || len(s.Value) == 0) {
+		v.errorf(n, "secret %s must have the path of the file to read as value", s.Key)
+		return false
+	}
+	if !s.IsRef() {
+		return false
+	}
+	if _, _, err := s.RemoteRef(); err != nil {
+		v.errorf(n, "%s", err)
+	}
+	return true
+}
+
+// checkHosts checks the host settings of a module
+func (v *validator) checkHosts(n *kyaml.Node) {
+	hostName := field(n, "hostname")
+	if hostName != nil && !isDNSSubdomain(hostName.Value) {
+		v.errorf(hostName, "hostname %q is not a valid DNS name", hostName.Value)
+	}
+	for _, f := range []string{"prefix", "wildcard"} {
+		val := field(n, f)
+		if val == nil {
+			continue
+		}
+		if hostName != nil {
+			v.errorf(val, "%s is ignored when hostname is set", f)
+		}
+		if f == "prefix" && !dnsLabelRegexp.MatchString(val.Value) {
+			v.errorf(val, "prefix %q is not a valid DNS label", val.Value)
+		}
+		if f == "wildcard" && !isDNSSubdomain(val.Value) {
+			v.errorf(val, "wildcard %q is not a valid DNS name", val.Value)
+		}
+	}
+	if delim := field(n, "delimiter"); delim != nil && delim.Value != "-" && delim.Value != "." {
+		v.errorf(delim, "delimiter %q is not supported, must be either '-' or '.'", delim.Value)
+	}
+}
+
+// checkPatch checks that a patch is either read from a file or given inline
+func (v *validator) checkPatch(n *kyaml.Node) {
+	if n.Kind != kyaml.MappingNode {
+		return
+	}
+	path, patch := field(n, "path"), field(n, "patch")
+	switch {
+	case path == nil && patch == nil:
+		v.errorf(n, "patch requires either path or patch")
+	case path != nil && patch != nil:
+		v.errorf(patch, "patch can't be given along with path")
+	}
+}
+
+// field returns the value node of the field with the given key in the mapping node n, or nil if not found
+func field(n *kyaml.Node, key string) *kyaml.Node {
+	if n == nil || n.Kind != kyaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// yamlFields returns the yaml field names of the struct type t mapped to their types, including inlined structs
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("yaml")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if opts == "inline" {
+			for k, v := range yamlFields(f.Type) {
+				fields[k] = v
+			}
+			continue
+		}
+		if len(name) == 0 {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// suggest returns a hint about the closest known field to s
+func suggest(s string, fields map[string]reflect.Type) string {
+	best, bestDist := "", len(s)/2+1
+	for f := range fields {
+		if d := levenshtein(s, f); d < bestDist || (d == bestDist && f < best) {
+			best, bestDist = f, d
+		}
+	}
+	if len(best) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(", did you mean %q?", best)
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func minInt(vals ...int) int {
+	m := vals[0]
+	for _, v := range vals[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+func isDNSSubdomain(s string) bool {
+	if len(s) == 0 || len(s) > 253 {
+		return false
+	}
+	for _, l := range strings.Split(s, ".") {
+		if !dnsLabelRegexp.MatchString(l) {
+			return false
+		}
+	}
+	return true
+}
+
+func describe(path string) string {
+	if len(path) == 0 {
+		return "document"
+	}
+	return path
+}
+
+func join(path, key string) string {
+	if len(path) == 0 {
+		return key
+	}
+	return path + "." + key
+}
+
+func scalarName(k reflect.Kind) string {
+	switch k {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	}
+	return "number"
+}
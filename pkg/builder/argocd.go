@@ -0,0 +1,224 @@
+package builder
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+const (
+	// ArgoCDDir is the directory, within the export directory and the root of each cluster, holding Argo CD Applications
+	ArgoCDDir = "_argocd"
+
+	argoCDAPIVersion = "argoproj.io/v1alpha1"
+	defaultServer    = "https://kubernetes.default.svc"
+)
+
+// app is a module deployed by Argo CD
+type app struct {
+	// name is the name of the Application
+	name string
+	// path is the path of the module within the repository
+	path string
+	// namespace is the namespace the module is deployed to, if any
+	namespace string
+	wave      int
+}
+
+type objectMeta struct {
+	Name        string            `yaml:"name"`
+	Namespace   string            `yaml:"namespace,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+type application struct {
+	APIVersion string          `yaml:"apiVersion"`
+	Kind       string          `yaml:"kind"`
+	Metadata   objectMeta      `yaml:"metadata"`
+	Spec       applicationSpec `yaml:"spec"`
+}
+
+type applicationSpec struct {
+	Project     string                  `yaml:"project"`
+	Source      applicationSource       `yaml:"source"`
+	Destination applicationDestination  `yaml:"destination"`
+	SyncPolicy  *types.ArgoCDSyncPolicy `yaml:"syncPolicy,omitempty"`
+}
+
+type applicationSource struct {
+	RepoURL        string             `yaml:"repoURL"`
+	Path           string             `yaml:"path"`
+	TargetRevision string             `yaml:"targetRevision"`
+	Plugin         *applicationPlugin `yaml:"plugin,omitempty"`
+}
+
+type applicationPlugin struct {
+	Name string `yaml:"name"`
+}
+
+type applicationDestination struct {
+	Server    string `yaml:"server,omitempty"`
+	Name      string `yaml:"name,omitempty"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+type applicationSet struct {
+	APIVersion string             `yaml:"apiVersion"`
+	Kind       string             `yaml:"kind"`
+	Metadata   objectMeta         `yaml:"metadata"`
+	Spec       applicationSetSpec `yaml:"spec"`
+}
+
+type applicationSetSpec struct {
+	Generators []applicationSetGenerator `yaml:"generators"`
+	Template   applicationSetTemplate    `yaml:"template"`
+}
+
+type applicationSetGenerator struct {
+	List struct {
+		Elements []map[string]string `yaml:"elements"`
+	} `yaml:"list"`
+}
+
+type applicationSetTemplate struct {
+	Metadata objectMeta      `yaml:"metadata"`
+	Spec     applicationSpec `yaml:"spec"`
+}
+
+// stageArgoCD writes Argo CD Applications, or ApplicationSets, for the modules of the top level and of each cluster
+func (r *Result) stageArgoCD(fs filesys.FileSystem) error {
+	cfg := *r.ArgoCD
+	if len(cfg.Path) == 0 {
+		cfg.Path = ExportDir
+	}
+	if len(cfg.TargetRevision) == 0 {
+		cfg.TargetRevision = "HEAD"
+	}
+	if len(cfg.Project) == 0 {
+		cfg.Project = "default"
+	}
+	if len(cfg.Namespace) == 0 {
+		cfg.Namespace = "argocd"
+	}
+	if len(cfg.Server) == 0 {
+		cfg.Server = defaultServer
+	}
+
+	var apps []app
+	for _, m := range r.deployed() {
+		apps = append(apps, app{
+			name:      appName("", m.name),
+			path:      path.Join(cfg.Path, m.path),
+			namespace: m.namespace,
+			wave:      m.wave,
+		})
+	}
+	if err := r.writeApplications(fs, ArgoCDDir, cfg, applicationDestination{Server: cfg.Server}, "", apps); err != nil {
+		return err
+	}
+
+	for _, c := range r.Clusters {
+		dir := path.Join(ClustersDir, c.Name, ArgoCDDir)
+		apps = nil
+		for _, m := range r.deployedTo(c) {
+			apps = append(apps, app{
+				name:      appName(c.Name, m.name),
+				path:      path.Join(cfg.Path, m.path),
+				namespace: m.namespace,
+				wave:      m.wave,
+			})
+		}
+		if err := r.writeApplications(fs, dir, cfg, applicationDestination{Name: c.Name}, c.Name, apps); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeApplications writes an Application per app into dir along with a kustomization.yaml listing them, or a single
+// ApplicationSet generating them if enabled by cfg
+func (r *Result) writeApplications(fs filesys.FileSystem, dir string, cfg types.ArgoCD, dest applicationDestination, cluster string, apps []app) error {
+	if len(apps) == 0 {
+		return nil
+	}
+	spec := func(a app) applicationSpec {
+		s := applicationSpec{
+			Project: cfg.Project,
+			Source: applicationSource{
+				RepoURL:        cfg.RepoURL,
+				Path:           a.path,
+				TargetRevision: cfg.TargetRevision,
+			},
+			Destination: dest,
+			SyncPolicy:  cfg.SyncPolicy,
+		}
+		s.Destination.Namespace = a.namespace
+		if r.Encrypted && len(cfg.Plugin) > 0 {
+			s.Source.Plugin = &applicationPlugin{Name: cfg.Plugin}
+		}
+		return s
+	}
+	annotations := func(wave string) map[string]string {
+		if r.Ordering != types.OrderingSyncWaves {
+			return nil
+		}
+		return map[string]string{AnnotationSyncWave: wave}
+	}
+
+	var files []string
+	if cfg.ApplicationSet {
+		set := applicationSet{
+			APIVersion: argoCDAPIVersion,
+			Kind:       "ApplicationSet",
+			Metadata:   objectMeta{Name: appName(cluster, "modules"), Namespace: cfg.Namespace},
+		}
+		var gen applicationSetGenerator
+		for _, a := range apps {
+			gen.List.Elements = append(gen.List.Elements, map[string]string{
+				"name":      a.name,
+				"path":      a.path,
+				"namespace": a.namespace,
+				"wave":      strconv.Itoa(a.wave),
+			})
+		}
+		set.Spec.Generators = []applicationSetGenerator{gen}
+		set.Spec.Template = applicationSetTemplate{
+			Metadata: objectMeta{Name: "{{name}}", Annotations: annotations("{{wave}}")},
+			Spec:     spec(app{path: "{{path}}", namespace: "{{namespace}}"}),
+		}
+		if err := writeYAML(fs, path.Join(dir, "applicationset.yaml"), set); err != nil {
+			return err
+		}
+		files = append(files, "applicationset.yaml")
+	} else {
+		for _, a := range apps {
+			application := application{
+				APIVersion: argoCDAPIVersion,
+				Kind:       "Application",
+				Metadata:   objectMeta{Name: a.name, Namespace: cfg.Namespace, Annotations: annotations(strconv.Itoa(a.wave))},
+				Spec:       spec(a),
+			}
+			f := a.name + ".yaml"
+			if err := writeYAML(fs, path.Join(dir, f), application); err != nil {
+				return err
+			}
+			files = append(files, f)
+		}
+	}
+	sort.Strings(files)
+	return writeKustomization(fs, dir, files)
+}
+
+// appName returns the name of the Application of module, prefixed with the cluster if any
+func appName(cluster, module string) string {
+	name := strings.ReplaceAll(module, "/", "-")
+	if len(cluster) > 0 {
+		name = fmt.Sprintf("%s-%s", cluster, name)
+	}
+	return name
+}
@@ -0,0 +1,129 @@
+package builder
+
+import (
+	"testing"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/middlewaregruppen/banana/pkg/module"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+func argoResult(t *testing.T, cfg *types.ArgoCD) *Result {
+	meta := &types.ObjectMeta{Labels: map[string]string{"cluster": "dev"}}
+	return &Result{
+		Ordering: types.OrderingSyncWaves,
+		ArgoCD:   cfg,
+		Bundles: []*module.Bundle{
+			bundle(t, types.Module{Name: "auth/dex", Namespace: "auth"}),
+			bundle(t, types.Module{Name: "ingress/nginx", Namespace: "ingress"}),
+		},
+		Waves: map[string]int{"auth/dex": 1, "ingress/nginx": 0},
+		Clusters: []*ClusterResult{{
+			Name:     "dev",
+			MetaData: meta,
+			Modules:  []string{"auth/dex", "ingress/nginx"},
+			Bundles: []*module.Bundle{
+				bundle(t, types.Module{Name: "auth/dex", Namespace: "auth"}, module.WithClusterMetaData(meta)),
+				bundle(t, types.Module{Name: "ingress/nginx", Namespace: "dev-ingress"}, module.WithClusterMetaData(meta)),
+			},
+			Waves: map[string]int{"auth/dex": 1, "ingress/nginx": 0},
+		}},
+	}
+}
+
+func readApplication(t *testing.T, fs filesys.FileSystem, p string) application {
+	data, err := fs.ReadFile(p)
+	assert.NoError(t, err)
+	var app application
+	assert.NoError(t, yaml.Unmarshal(data, &app))
+	return app
+}
+
+func TestExport_ArgoCD(t *testing.T) {
+	r := argoResult(t, &types.ArgoCD{
+		RepoURL:    "https://github.com/example/deploy.git",
+		Plugin:     "sops",
+		SyncPolicy: &types.ArgoCDSyncPolicy{Automated: &types.ArgoCDAutomatedSync{Prune: true}},
+	})
+	r.Encrypted = true
+	fs := filesys.MakeFsInMemory()
+	report, err := r.Export(fs, "src")
+	assert.NoError(t, err)
+	assert.Subset(t, report.Written, []string{
+		"_argocd/auth-dex.yaml",
+		"_argocd/ingress-nginx.yaml",
+		"_argocd/kustomization.yaml",
+		"clusters/dev/_argocd/dev-auth-dex.yaml",
+		"clusters/dev/_argocd/dev-ingress-nginx.yaml",
+		"clusters/dev/_argocd/kustomization.yaml",
+	})
+
+	app := readApplication(t, fs, "src/_argocd/auth-dex.yaml")
+	assert.Equal(t, "auth-dex", app.Metadata.Name)
+	assert.Equal(t, "argocd", app.Metadata.Namespace)
+	assert.Equal(t, map[string]string{AnnotationSyncWave: "1"}, app.Metadata.Annotations)
+	assert.Equal(t, applicationSource{
+		RepoURL:        "https://github.com/example/deploy.git",
+		Path:           "src/auth/dex",
+		TargetRevision: "HEAD",
+		Plugin:         &applicationPlugin{Name: "sops"},
+	}, app.Spec.Source)
+	assert.Equal(t, applicationDestination{Server: defaultServer, Namespace: "auth"}, app.Spec.Destination)
+	assert.True(t, app.Spec.SyncPolicy.Automated.Prune)
+
+	app = readApplication(t, fs, "src/clusters/dev/_argocd/dev-ingress-nginx.yaml")
+	assert.Equal(t, "src/clusters/dev/ingress/nginx", app.Spec.Source.Path)
+	assert.Equal(t, applicationDestination{Name: "dev", Namespace: "dev-ingress"}, app.Spec.Destination)
+
+	// Modules deployed to a cluster with metadata are built for the cluster, with its metadata applied
+	for p, ns := range map[string]string{"src/clusters/dev/ingress/nginx": "dev-ingress", "src/clusters/dev/auth/dex": "auth"} {
+		rm, err := krusty.MakeKustomizer(module.DefaultKustomizerOptions).Run(fs, p)
+		assert.NoError(t, err)
+		assert.Len(t, rm.Resources(), 1)
+		assert.Equal(t, ns, rm.Resources()[0].GetNamespace())
+		assert.Equal(t, "dev", rm.Resources()[0].GetLabels()["cluster"])
+	}
+}
+
+func TestExport_ArgoCDApplicationSet(t *testing.T) {
+	r := argoResult(t, &types.ArgoCD{RepoURL: "https://github.com/example/deploy.git", ApplicationSet: true})
+	// Without metadata, modules the cluster doesn't override are deployed from the top level
+	r.Clusters[0].MetaData = nil
+	r.Clusters[0].Bundles = r.Clusters[0].Bundles[1:]
+	fs := filesys.MakeFsInMemory()
+	_, err := r.Export(fs, "src")
+	assert.NoError(t, err)
+
+	data, err := fs.ReadFile("src/clusters/dev/_argocd/applicationset.yaml")
+	assert.NoError(t, err)
+	var set applicationSet
+	assert.NoError(t, yaml.Unmarshal(data, &set))
+	assert.Equal(t, "dev-modules", set.Metadata.Name)
+	assert.Equal(t, []map[string]string{
+		{"name": "dev-auth-dex", "path": "src/auth/dex", "namespace": "auth", "wave": "1"},
+		{"name": "dev-ingress-nginx", "path": "src/clusters/dev/ingress/nginx", "namespace": "dev-ingress", "wave": "0"},
+	}, set.Spec.Generators[0].List.Elements)
+	assert.Equal(t, "{{path}}", set.Spec.Template.Spec.Source.Path)
+	assert.Equal(t, map[string]string{AnnotationSyncWave: "{{wave}}"}, set.Spec.Template.Metadata.Annotations)
+	assert.Nil(t, set.Spec.Template.Spec.Source.Plugin)
+	assert.True(t, fs.Exists("src/_argocd/applicationset.yaml"))
+}
+
+func TestBuild_ArgoCDPlugin(t *testing.T) {
+	km := &types.BananaFile{
+		Age:    &types.Age{Recipients: []string{"age1geawfzgrvdv5v8kd28wq8a34vvqg3zcztx76h9du95d5m62s0qhsgkrqlg"}},
+		Export: &types.Export{ArgoCD: &types.ArgoCD{RepoURL: "https://github.com/example/deploy.git"}},
+	}
+
+	// Applications would apply encrypted secrets as is without a plugin decrypting them
+	_, err := NewBuilder(filesys.MakeFsInMemory(), "").Build(km)
+	assert.EqualError(t, err, "export.argocd.plugin is required when age recipients are set, so that Argo CD decrypts secrets before applying them")
+
+	km.Export.ArgoCD.Plugin = "sops"
+	r, err := NewBuilder(filesys.MakeFsInMemory(), "").Build(km)
+	assert.NoError(t, err)
+	assert.True(t, r.Encrypted)
+}
@@ -0,0 +1,593 @@
+// Package builder builds the modules declared in a banana file into bundles
+package builder
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/middlewaregruppen/banana/pkg/catalog"
+	"github.com/middlewaregruppen/banana/pkg/digest"
+	"github.com/middlewaregruppen/banana/pkg/git"
+	"github.com/middlewaregruppen/banana/pkg/module"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+// ExportDir is the directory, relative to the banana file, that modules are exported to
+const ExportDir = "src"
+
+type Builder struct {
+	// fs is the filesystem files referenced by the banana file, such as certificates, are read from
+	fs filesys.FileSystem
+
+	// dir is the directory of the banana file which paths of patches are relative to
+	dir string
+
+	// prefix is the prefix used for builtin modules
+	prefix string
+
+	// version is the version of banana, recorded on every resource built
+	version string
+
+	// buildTime is the time recorded on every resource built. Left out if zero.
+	buildTime time.Time
+
+	// resolver resolves images missing from the lock file to digests when images are pinned
+	resolver *digest.Resolver
+
+	// lockFile is the path of the lock file holding the digests of pinned images
+	lockFile string
+
+	// updateLock resolves every image again instead of using the digests of the lock file
+	updateLock bool
+}
+
+// BuilderOpts is options for the builder
+type BuilderOpts func(b *Builder)
+
+// WithDir returns a BuilderOpts reading patches relative to dir, the directory of the banana file
+func WithDir(dir string) BuilderOpts {
+	return func(b *Builder) {
+		b.dir = dir
+	}
+}
+
+// WithVersion returns a BuilderOpts recording version as the version of banana on every resource built
+func WithVersion(version string) BuilderOpts {
+	return func(b *Builder) {
+		b.version = version
+	}
+}
+
+// WithBuildTime returns a BuilderOpts recording t as the time of the build on every resource built.
+// Builds are only reproducible without it.
+func WithBuildTime(t time.Time) BuilderOpts {
+	return func(b *Builder) {
+		b.buildTime = t
+	}
+}
+
+// WithResolver returns a BuilderOpts resolving images missing from the lock file using r. Without it, builds
+// pinning images fail unless every image is in the lock file.
+func WithResolver(r *digest.Resolver) BuilderOpts {
+	return func(b *Builder) {
+		b.resolver = r
+	}
+}
+
+// WithLockFile returns a BuilderOpts reading the digests of pinned images from the lock file at path
+func WithLockFile(path string) BuilderOpts {
+	return func(b *Builder) {
+		b.lockFile = path
+	}
+}
+
+// WithLockUpdate returns a BuilderOpts resolving every pinned image again if update is true
+func WithLockUpdate(update bool) BuilderOpts {
+	return func(b *Builder) {
+		b.updateLock = update
+	}
+}
+
+// NewBuilder returns a builder reading referenced files from fs and resolving builtin modules using prefix
+func NewBuilder(fs filesys.FileSystem, prefix string, opts ...BuilderOpts) *Builder {
+	b := &Builder{
+		fs:       fs,
+		prefix:   prefix,
+		lockFile: digest.LockFile,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Result holds the bundles built from a banana file
+type Result struct {
+	// Name is the name of the banana file, naming the charts exported
+	Name string
+
+	// Version is the version of the banana file, versioning the charts exported
+	Version string
+
+	// ImageFieldSpecs are the fields holding images in addition to the containers of workloads
+	ImageFieldSpecs []types.FieldSpec
+
+	// Layout is how the files of each module are laid out when exported
+	Layout module.Layout
+
+	// Ordering is how the order modules are installed in is carried by the export
+	Ordering types.Ordering
+
+	// Waves holds the wave of each module declared at the top level. Modules are installed after those of earlier waves.
+	Waves map[string]int
+
+	// Bundles holds a bundle of each module declared at the top level of the banana file, in the order declared
+	Bundles []*module.Bundle
+
+	// Clusters holds the modules of each cluster of the banana file
+	Clusters []*ClusterResult
+
+	// Lock holds the digest of every image pinned, nil unless the banana file pins images
+	Lock *digest.Lock
+
+	// ArgoCD configures the Argo CD Applications generated for the modules, nil unless enabled by the banana file
+	ArgoCD *types.ArgoCD
+
+	// Flux configures the Flux Kustomizations generated for the modules, nil unless enabled by the banana file
+	Flux *types.Flux
+
+	// Encrypted is whether secrets are encrypted with sops, and so must be decrypted when deployed
+	Encrypted bool
+}
+
+// ClusterResult holds the modules of a cluster
+type ClusterResult struct {
+	// Name is the name of the cluster
+	Name string
+
+	// MetaData is the metadata of the cluster, applied on top of the metadata of each module deployed to the cluster
+	// when it is built
+	MetaData *types.ObjectMeta
+
+	// Modules is the names of every module deployed to the cluster
+	Modules []string
+
+	// Bundles holds a bundle of each module overridden for the cluster, or of every module if the cluster has
+	// metadata. Modules not overridden are the same as those built at the top level.
+	Bundles []*module.Bundle
+
+	// Waves holds the wave of each module deployed to the cluster
+	Waves map[string]int
+}
+
+// Build clones every module of km into memory and bundles them. Modules overridden by clusters are built once per cluster.
+func (b *Builder) Build(km *types.BananaFile) (*Result, error) {
+	// Init loader for loading modules
+	tmpfs := filesys.MakeFsInMemory()
+	l := module.NewLoader(tmpfs)
+
+	r := &Result{
+		Name:            km.Name,
+		Version:         km.Version,
+		ImageFieldSpecs: km.ImageFieldSpecs,
+		Layout:          module.LayoutFlat,
+		Ordering:        types.OrderingNone,
+	}
+	if km.Export != nil {
+		layout, err := module.ParseLayout(km.Export.Layout)
+		if err != nil {
+			return nil, err
+		}
+		r.Layout = layout
+		if r.Ordering, err = types.ParseOrdering(km.Export.Ordering); err != nil {
+			return nil, err
+		}
+		r.ArgoCD = km.Export.ArgoCD
+		r.Flux = km.Export.Flux
+	}
+	r.Encrypted = km.Age != nil && len(km.Age.Recipients) > 0
+	if r.Encrypted && r.ArgoCD != nil && len(r.ArgoCD.Plugin) == 0 {
+		return nil, fmt.Errorf("export.argocd.plugin is required when age recipients are set, so that Argo CD decrypts secrets before applying them")
+	}
+	missing := types.MissingFail
+	if km.Dependencies != nil {
+		var err error
+		if missing, err = types.ParseMissingDependencies(km.Dependencies.Missing); err != nil {
+			return nil, err
+		}
+	}
+	var strategy string
+	if km.Conflicts != nil {
+		strategy = km.Conflicts.Strategy
+	}
+	conflicts, err := types.ParseConflictStrategy(strategy)
+	if err != nil {
+		return nil, err
+	}
+	var pinner *digest.Pinner
+	if km.PinImageDigests {
+		lock, err := digest.ReadLock(b.fs, b.lockFile)
+		if err != nil {
+			return nil, err
+		}
+		pinner = digest.NewPinner(lock, b.resolver, b.updateLock)
+	}
+
+	// Modules depended on but not declared are added as they are found
+	modules := append([]types.Module{}, km.Modules...)
+	declared := map[string]bool{}
+	for _, m := range modules {
+		declared[m.Name] = true
+	}
+	for i := 0; i < len(modules); i++ {
+		bun, deps, err := b.bundle(km, l, tmpfs, modules[i], nil, pinner)
+		if err != nil {
+			return nil, err
+		}
+		r.Bundles = append(r.Bundles, bun)
+		added, err := missingModules(modules[i].Name, deps, declared, missing)
+		if err != nil {
+			return nil, err
+		}
+		modules = append(modules, added...)
+	}
+
+	for _, c := range km.Clusters {
+		if c == nil {
+			continue
+		}
+		cr := &ClusterResult{
+			Name:     c.Name,
+			MetaData: c.MetaData,
+		}
+		merged, overridden := mergeModules(modules, c.Modules)
+
+		// The metadata of a cluster is applied to the resources of every module deployed to it, so with metadata
+		// every module is built for the cluster
+		if c.MetaData != nil {
+			for _, m := range merged {
+				overridden[m.Name] = true
+			}
+		}
+		declared := map[string]bool{}
+		for _, m := range merged {
+			declared[m.Name] = true
+		}
+		for i := 0; i < len(merged); i++ {
+			m := merged[i]
+			mod := l.Load(m, b.prefix)
+			cr.Modules = append(cr.Modules, mod.Name())
+			if !overridden[m.Name] {
+				continue
+			}
+			bun, deps, err := b.bundle(km, l, tmpfs, m, c.MetaData, pinner)
+			if err != nil {
+				return nil, fmt.Errorf("cluster %s: %w", c.Name, err)
+			}
+			cr.Bundles = append(cr.Bundles, bun)
+
+			// Modules added for the cluster are built for the cluster only
+			added, err := missingModules(m.Name, deps, declared, missing)
+			if err != nil {
+				return nil, fmt.Errorf("cluster %s: %w", c.Name, err)
+			}
+			for _, a := range added {
+				overridden[a.Name] = true
+			}
+			merged = append(merged, added...)
+		}
+		r.Clusters = append(r.Clusters, cr)
+	}
+
+	// Modules are bundled in isolation, so namespaces and resources emitted by several modules are reconciled
+	// across the build
+	for i, d := range r.deployments() {
+		if err := d.ensureNamespaces(km.Namespaces); err != nil {
+			return nil, err
+		}
+		if err := d.resolveConflicts(conflicts); err != nil {
+			return nil, err
+		}
+
+		waves, err := d.waves()
+		if err != nil {
+			return nil, err
+		}
+		if r.Ordering == types.OrderingSyncWaves {
+			if err := d.annotateWaves(waves); err != nil {
+				return nil, err
+			}
+		}
+		if i == 0 {
+			r.Waves = waves
+		} else {
+			r.Clusters[i-1].Waves = waves
+		}
+	}
+	if pinner != nil {
+		r.Lock = pinner.Lock()
+	}
+	return r, nil
+}
+
+// bundle clones the module m into tmpfs and bundles it. The metadata of the cluster the module is built for, if any,
+// is applied on top of that of the module. Images are pinned to digests using pinner, unless nil.
+// The dependencies declared in the metadata of the module are returned along with the bundle.
+func (b *Builder) bundle(km *types.BananaFile, l *module.Loader, tmpfs filesys.FileSystem, m types.Module, cluster *types.ObjectMeta, pinner *digest.Pinner) (*module.Bundle, []types.ModuleDependency, error) {
+	logrus.Debugf("building module %s holding %d component(s) \n", m.Name, len(m.Components))
+	m, err := b.readPatches(m)
+	if err != nil {
+		return nil, nil, err
+	}
+	m, err = b.readSecrets(m)
+	if err != nil {
+		return nil, nil, err
+	}
+	mod := l.Load(m, b.prefix)
+	logrus.Debugf("Will clone repo %s version %s using subdir %s into", mod.URL(), mod.Version(), mod.Name())
+
+	// Setup the cloner and clone into temporary filesystem
+	cloner := git.NewCloner(mod)
+	err = cloner.Clone(tmpfs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Components pinned to another version are read from a clone of that version
+	for _, v := range mod.ComponentVersions() {
+		logrus.Debugf("Will clone repo %s version %s for the components of %s", mod.URL(), v, mod.Name())
+		err = git.NewURLCloner(mod.URL(), v, git.WithTargetPath(path.Join(module.ComponentVersionsDir, v))).Clone(tmpfs)
+		if err != nil {
+			return nil, nil, fmt.Errorf("module %s: unable to clone components at version %s: %w", mod.Name(), v, err)
+		}
+	}
+
+	meta, err := catalog.ReadMetadata(tmpfs, mod.Name())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Metadata is applied first so that every other option sees the final names and namespaces of resources.
+	// Metadata of the module takes precedence over that of the file, and that of the cluster is applied on top.
+	opts := []module.BundleOpts{
+		module.WithMetaData(mergeMetaData(km.MetaData, m.MetaData)),
+		module.WithClusterMetaData(cluster),
+	}
+	bopts, err := b.bundleOpts(km, mod)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts = append(opts, bopts...)
+	var deps []string
+	for _, dep := range meta.Dependencies {
+		deps = append(deps, dep.Name)
+	}
+	opts = append(opts, module.WithDependencies(deps))
+
+	// Images are pinned after being rewritten to a mirror, so that the digest is that of the image pulled
+	if pinner != nil {
+		opts = append(opts, module.WithImageDigests(pinner.Pin, km.ImageFieldSpecs))
+	}
+
+	// Provenance is recorded last so that resources added by other options are annotated as well
+	opts = append(opts, module.WithProvenance(module.Provenance{
+		BananaVersion: b.version,
+		Commit:        cloner.Commit(),
+		BuildTime:     b.buildTime,
+	}))
+
+	// Bundle the module
+	bun, err := mod.Bundle(opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return bun, meta.Dependencies, nil
+}
+
+// readPatches returns m with the patches read from files inlined. Relative paths are relative to the directory of the
+// banana file.
+func (b *Builder) readPatches(m types.Module) (types.Module, error) {
+	if len(m.Patches) == 0 {
+		return m, nil
+	}
+	patches := make([]types.Patch, len(m.Patches))
+	for i, p := range m.Patches {
+		if len(p.Path) > 0 {
+			file := p.Path
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(b.dir, file)
+			}
+			data, err := b.fs.ReadFile(file)
+			if err != nil {
+				return m, fmt.Errorf("module %s: unable to read patch: %w", m.Name, err)
+			}
+			p.Patch = string(data)
+			p.Path = ""
+		}
+		patches[i] = p
+	}
+	m.Patches = patches
+	return m, nil
+}
+
+// readSecrets returns m with the secrets read from files inlined. Such secrets have their key prefixed with '@' and
+// the path of the file as value, which becomes the content of the key without the prefix. Relative paths are relative
+// to the directory of the banana file.
+func (b *Builder) readSecrets(m types.Module) (types.Module, error) {
+	if len(m.Secrets) == 0 {
+		return m, nil
+	}
+	secrets := make([]types.Secret, len(m.Secrets))
+	for i, s := range m.Secrets {
+		sec := module.Secret{Key: s.Key, Value: s.Value}
+		if sec.IsFile() {
+			file := s.Value
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(b.dir, file)
+			}
+			data, err := b.fs.ReadFile(file)
+			if err != nil {
+				return m, fmt.Errorf("module %s: unable to read secret %s: %w", m.Name, strings.TrimPrefix(s.Key, "@"), err)
+			}
+			s.Key = strings.TrimPrefix(s.Key, "@")
+			s.Value = string(data)
+		}
+		secrets[i] = s
+	}
+	m.Secrets = secrets
+	return m, nil
+}
+
+// mergeModules returns modules with the overrides of a cluster applied. Overrides are matched by name and every field
+// set on an override takes precedence. Overrides of modules not declared in modules are added. The names of the modules
+// changed by overrides are returned as well.
+func mergeModules(modules, overrides []types.Module) ([]types.Module, map[string]bool) {
+	result := make([]types.Module, len(modules))
+	copy(result, modules)
+	overridden := map[string]bool{}
+
+	for _, o := range overrides {
+		overridden[o.Name] = true
+		found := false
+		for i := range result {
+			if result[i].Name == o.Name {
+				result[i] = mergeModule(result[i], o)
+				found = true
+			}
+		}
+		if !found {
+			result = append(result, o)
+		}
+	}
+	return result, overridden
+}
+
+func mergeModule(m, o types.Module) types.Module {
+	if o.MetaData != nil {
+		m.MetaData = o.MetaData
+	}
+	if len(o.Version) > 0 {
+		// Components following the version of the module keep following it unless overridden as well
+		components := append([]types.Component{}, m.Components...)
+		for i, c := range components {
+			if c.Version == m.Version {
+				components[i].Version = o.Version
+			}
+		}
+		if m.Components != nil {
+			m.Components = components
+		}
+		m.Version = o.Version
+	}
+	if len(o.Ref) > 0 {
+		m.Ref = o.Ref
+	}
+	if len(o.Namespace) > 0 {
+		m.Namespace = o.Namespace
+	}
+	if o.Opts != nil {
+		m.Opts = o.Opts
+	}
+	if o.Components != nil {
+		m.Components = o.Components
+	}
+	if o.Hosts != nil {
+		m.Hosts = o.Hosts
+	}
+	if o.Secrets != nil {
+		m.Secrets = o.Secrets
+	}
+	if o.Patches != nil {
+		m.Patches = o.Patches
+	}
+	if o.Images != nil {
+		m.Images = o.Images
+	}
+	return m
+}
+
+// mergeMetaData returns meta with the fields set in override taking precedence. Labels and annotations are merged.
+func mergeMetaData(meta, override *types.ObjectMeta) *types.ObjectMeta {
+	if meta == nil {
+		return override
+	}
+	if override == nil {
+		return meta
+	}
+	result := &types.ObjectMeta{
+		Name:             meta.Name,
+		NamePrefix:       meta.NamePrefix,
+		Namespace:        meta.Namespace,
+		Labels:           map[string]string{},
+		Annotations:      map[string]string{},
+		IncludeSelectors: meta.IncludeSelectors,
+	}
+	if len(override.Name) > 0 {
+		result.Name = override.Name
+	}
+	if len(override.NamePrefix) > 0 {
+		result.NamePrefix = override.NamePrefix
+	}
+	if len(override.Namespace) > 0 {
+		result.Namespace = override.Namespace
+	}
+	if override.IncludeSelectors != nil {
+		result.IncludeSelectors = override.IncludeSelectors
+	}
+	for _, m := range []map[string]string{meta.Labels, override.Labels} {
+		for k, v := range m {
+			result.Labels[k] = v
+		}
+	}
+	for _, m := range []map[string]string{meta.Annotations, override.Annotations} {
+		for k, v := range m {
+			result.Annotations[k] = v
+		}
+	}
+	return result
+}
+
+// bundleOpts returns the options used to bundle mod
+func (b *Builder) bundleOpts(km *types.BananaFile, mod module.Module) ([]module.BundleOpts, error) {
+	opts := []module.BundleOpts{
+		module.WithSecrets(mod.Secrets()),
+		module.WithURLs(mod.Host()),
+	}
+
+	// Pull images from a registry mirror
+	if km.ImageRegistry != nil {
+		opts = append(opts, module.WithImageRegistry(*km.ImageRegistry, km.ImageFieldSpecs))
+	}
+
+	// Use sops encryption if age recipients is provided
+	if km.Age != nil && len(km.Age.Recipients) > 0 {
+		opts = append(opts, module.WithAgeRecipients(km.Age.Recipients))
+	}
+
+	// Emit ExternalSecrets for secrets referencing an external secret store
+	var externalSecrets types.ExternalSecrets
+	if km.ExternalSecrets != nil {
+		externalSecrets = *km.ExternalSecrets
+	}
+	opts = append(opts, module.WithExternalSecrets(mod.Secrets(), externalSecrets))
+
+	// Convert secrets into SealedSecrets if a controller certificate is provided. A relative path is relative to the
+	// directory of the banana file, the same as patches.
+	if km.SealedSecrets != nil && len(km.SealedSecrets.Certificate) > 0 {
+		scope, err := module.ParseSealedSecretScope(km.SealedSecrets.Scope)
+		if err != nil {
+			return nil, err
+		}
+		cert := km.SealedSecrets.Certificate
+		if !filepath.IsAbs(cert) {
+			cert = filepath.Join(b.dir, cert)
+		}
+		opts = append(opts, module.WithSealedSecrets(b.fs, cert, scope))
+	}
+	return opts, nil
+}
@@ -0,0 +1,363 @@
+package builder
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/middlewaregruppen/banana/pkg/module"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+func bundle(t *testing.T, mod types.Module, opts ...module.BundleOpts) *module.Bundle {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		mod.Name + "/kustomization.yaml": "resources:\n- configmap.yaml\n",
+		mod.Name + "/configmap.yaml":     "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\ndata:\n  LOG_LEVEL: info\n",
+	}
+	for p, data := range files {
+		assert.NoError(t, fs.WriteFile(p, []byte(data)))
+	}
+	b, err := module.NewKustomizeModule(fs, mod, "").Bundle(opts...)
+	assert.NoError(t, err)
+	return b
+}
+
+// secretBundleFs returns a filesystem holding the module mod with a ConfigMap and a Secret holding the keys PASSWORD
+// and TOKEN
+func secretBundleFs(t *testing.T, mod types.Module) filesys.FileSystem {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		mod.Name + "/kustomization.yaml": "resources:\n- configmap.yaml\n- secret.yaml\n",
+		mod.Name + "/configmap.yaml":     "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\ndata:\n  LOG_LEVEL: info\n",
+		mod.Name + "/secret.yaml":        "apiVersion: v1\nkind: Secret\nmetadata:\n  name: credentials\nstringData:\n  PASSWORD: changeme\n  TOKEN: changeme\n",
+	}
+	for p, data := range files {
+		assert.NoError(t, fs.WriteFile(p, []byte(data)))
+	}
+	return fs
+}
+
+// writeSealedSecretsCert writes a self-signed certificate to p of fs
+func writeSealedSecretsCert(t *testing.T, fs filesys.FileSystem, p string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sealed-secret"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, fs.WriteFile(p, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})))
+}
+
+func TestMergeModules(t *testing.T) {
+	modules := []types.Module{
+		{Name: "ingress/nginx", Version: "v1.0.0", Components: []types.Component{{Name: "tls"}}},
+		{Name: "auth/dex", Version: "v1.0.0", Namespace: "auth"},
+	}
+	merged, overridden := mergeModules(modules, []types.Module{
+		{Name: "auth/dex", Version: "v2.0.0"},
+		{Name: "monitoring/grafana"},
+	})
+	assert.Equal(t, []types.Module{
+		{Name: "ingress/nginx", Version: "v1.0.0", Components: []types.Component{{Name: "tls"}}},
+		{Name: "auth/dex", Version: "v2.0.0", Namespace: "auth"},
+		{Name: "monitoring/grafana"},
+	}, merged)
+	assert.Equal(t, map[string]bool{"auth/dex": true, "monitoring/grafana": true}, overridden)
+	// The modules given are left as is
+	assert.Equal(t, "v1.0.0", modules[1].Version)
+
+	// Components following the version of the module follow that of the override, others keep theirs
+	m := types.Module{Name: "ingress/nginx", Version: "v1.0.0", Components: []types.Component{{Name: "tls", Version: "v1.0.0"}, {Name: "metrics", Version: "v0.9.0"}}}
+	assert.Equal(t, []types.Component{{Name: "tls", Version: "v2.0.0"}, {Name: "metrics", Version: "v0.9.0"}},
+		mergeModule(m, types.Module{Version: "v2.0.0"}).Components)
+	assert.Equal(t, "v1.0.0", m.Components[0].Version)
+
+	assert.Equal(t, &types.ObjectMeta{
+		NamePrefix:  "acme-",
+		Namespace:   "dev",
+		Labels:      map[string]string{"team": "platform", "env": "dev"},
+		Annotations: map[string]string{},
+	}, mergeMetaData(
+		&types.ObjectMeta{NamePrefix: "acme-", Namespace: "default", Labels: map[string]string{"team": "platform"}},
+		&types.ObjectMeta{Namespace: "dev", Labels: map[string]string{"env": "dev"}},
+	))
+}
+
+func TestExport(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	meta := module.WithMetaData(&types.ObjectMeta{NamePrefix: "acme-", Labels: map[string]string{"team": "platform"}})
+	dev := &types.ObjectMeta{NamePrefix: "dev-"}
+	r := &Result{
+		Bundles: []*module.Bundle{
+			bundle(t, types.Module{Name: "ingress/nginx", Namespace: "ingress"}, meta),
+			bundle(t, types.Module{Name: "auth/dex", Namespace: "auth"}, meta),
+		},
+		Clusters: []*ClusterResult{{
+			Name:     "dev",
+			MetaData: dev,
+			Modules:  []string{"ingress/nginx", "auth/dex"},
+			Bundles: []*module.Bundle{
+				bundle(t, types.Module{Name: "ingress/nginx", Namespace: "ingress"}, meta, module.WithClusterMetaData(dev)),
+				bundle(t, types.Module{Name: "auth/dex", Namespace: "dev-auth"}, meta, module.WithClusterMetaData(dev)),
+			},
+		}},
+	}
+	report, err := r.Export(fs, "src")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"auth/dex/configmap_acme-config.yaml",
+		"auth/dex/kustomization.yaml",
+		"clusters/dev/auth/dex/configmap_dev-acme-config.yaml",
+		"clusters/dev/auth/dex/kustomization.yaml",
+		"clusters/dev/ingress/nginx/configmap_dev-acme-config.yaml",
+		"clusters/dev/ingress/nginx/kustomization.yaml",
+		"clusters/dev/kustomization.yaml",
+		"ingress/nginx/configmap_acme-config.yaml",
+		"ingress/nginx/kustomization.yaml",
+		"kustomization.yaml",
+	}, report.Written)
+	assert.Empty(t, report.Removed)
+
+	k := krusty.MakeKustomizer(module.DefaultKustomizerOptions)
+	rm, err := k.Run(fs, "src")
+	assert.NoError(t, err)
+	var ids []string
+	for _, res := range rm.Resources() {
+		ids = append(ids, res.GetNamespace()+"/"+res.GetName()+" "+res.GetLabels()["team"])
+	}
+	assert.Equal(t, []string{"ingress/acme-config platform", "auth/acme-config platform"}, ids)
+
+	rm, err = k.Run(fs, "src/clusters/dev")
+	assert.NoError(t, err)
+	ids = nil
+	for _, res := range rm.Resources() {
+		ids = append(ids, res.GetNamespace()+"/"+res.GetName())
+	}
+	assert.Equal(t, []string{"ingress/dev-acme-config", "dev-auth/dev-acme-config"}, ids)
+
+	// Files not written by the export are left as is
+	assert.NoError(t, fs.WriteFile("src/README.md", []byte("# src")))
+
+	// A dry run only reports files no longer built
+	r.Bundles = r.Bundles[:1]
+	r.Clusters = nil
+	removed := []string{
+		"auth/dex/configmap_acme-config.yaml",
+		"auth/dex/kustomization.yaml",
+		"clusters/dev/auth/dex/configmap_dev-acme-config.yaml",
+		"clusters/dev/auth/dex/kustomization.yaml",
+		"clusters/dev/ingress/nginx/configmap_dev-acme-config.yaml",
+		"clusters/dev/ingress/nginx/kustomization.yaml",
+		"clusters/dev/kustomization.yaml",
+	}
+	report, err = r.Export(fs, "src", WithDryRun(true))
+	assert.NoError(t, err)
+	assert.Equal(t, removed, report.Removed)
+	assert.True(t, fs.Exists("src/auth/dex/configmap_acme-config.yaml"))
+
+	// Files are kept but still owned when not pruning
+	report, err = r.Export(fs, "src", WithPrune(false))
+	assert.NoError(t, err)
+	assert.Empty(t, report.Removed)
+	assert.True(t, fs.Exists("src/auth/dex/configmap_acme-config.yaml"))
+
+	// Modules and clusters no longer built are removed along with their empty directories
+	report, err = r.Export(fs, "src")
+	assert.NoError(t, err)
+	assert.Equal(t, removed, report.Removed)
+	assert.True(t, fs.Exists("src/ingress/nginx/configmap_acme-config.yaml"))
+	assert.True(t, fs.Exists("src/README.md"))
+	assert.False(t, fs.Exists("src/auth"))
+	assert.False(t, fs.Exists("src/clusters"))
+
+	m, err := readManifest(fs, "src")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ingress/nginx/configmap_acme-config.yaml", "ingress/nginx/kustomization.yaml", "kustomization.yaml"}, m.Files)
+}
+
+func TestExport_ManifestOutsideDir(t *testing.T) {
+	for _, f := range []string{"/etc/passwd", "../banana.yaml", "ingress/../../banana.yaml", "."} {
+		t.Run(f, func(t *testing.T) {
+			fs := filesys.MakeFsInMemory()
+			assert.NoError(t, fs.WriteFile("banana.yaml", []byte("kind: Banana\n")))
+			assert.NoError(t, writeManifest(fs, "src", &Manifest{Files: []string{f}}))
+
+			r := &Result{Bundles: []*module.Bundle{bundle(t, types.Module{Name: "ingress/nginx", Namespace: "ingress"})}}
+			_, err := r.Export(fs, "src")
+			assert.EqualError(t, err, fmt.Sprintf("src/.banana-manifest.yaml: file %q is outside of the export directory", f))
+			assert.True(t, fs.Exists("banana.yaml"))
+		})
+	}
+}
+
+func TestReadPatches(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	assert.NoError(t, fs.WriteFile("patches/replicas.yaml", []byte("spec:\n  replicas: 3\n")))
+	b := NewBuilder(fs, "")
+
+	m := types.Module{Name: "ingress/nginx", Patches: []types.Patch{
+		{Path: "patches/replicas.yaml", Target: &types.PatchTarget{Kind: "Deployment"}},
+		{Patch: "- op: remove\n  path: /spec/strategy\n"},
+	}}
+	got, err := b.readPatches(m)
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Patch{
+		{Patch: "spec:\n  replicas: 3\n", Target: &types.PatchTarget{Kind: "Deployment"}},
+		{Patch: "- op: remove\n  path: /spec/strategy\n"},
+	}, got.Patches)
+	// The module given is left as is
+	assert.Equal(t, "patches/replicas.yaml", m.Patches[0].Path)
+
+	_, err = b.readPatches(types.Module{Name: "ingress/nginx", Patches: []types.Patch{{Path: "patches/missing.yaml"}}})
+	assert.Error(t, err)
+
+	// Paths are relative to the directory of the banana file rather than the working directory
+	assert.NoError(t, fs.WriteFile("platform/patches/probes.yaml", []byte("spec:\n  minReadySeconds: 5\n")))
+	b = NewBuilder(fs, "", WithDir("platform"))
+	got, err = b.readPatches(types.Module{Name: "ingress/nginx", Patches: []types.Patch{{Path: "patches/probes.yaml"}}})
+	assert.NoError(t, err)
+	assert.Equal(t, "spec:\n  minReadySeconds: 5\n", got.Patches[0].Patch)
+}
+
+func TestReadSecrets(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	assert.NoError(t, fs.WriteFile("platform/files/config.json", []byte(`{"debug":true}`)))
+	b := NewBuilder(fs, "", WithDir("platform"))
+
+	m := types.Module{Name: "auth/dex", Secrets: []types.Secret{
+		{Key: "@config.json", Value: "files/config.json"},
+		{Key: "PASSWORD", Value: "secret"},
+	}}
+	got, err := b.readSecrets(m)
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Secret{
+		{Key: "config.json", Value: `{"debug":true}`},
+		{Key: "PASSWORD", Value: "secret"},
+	}, got.Secrets)
+	// The module given is left as is
+	assert.Equal(t, "@config.json", m.Secrets[0].Key)
+
+	_, err = b.readSecrets(types.Module{Name: "auth/dex", Secrets: []types.Secret{{Key: "@missing.json", Value: "files/missing.json"}}})
+	assert.Error(t, err)
+}
+
+func TestExport_HelmChart(t *testing.T) {
+	r := &Result{
+		Name:    "platform",
+		Version: "v1.2.0",
+		Bundles: []*module.Bundle{
+			bundle(t, types.Module{Name: "auth/dex", Namespace: "auth"}),
+			bundle(t, types.Module{Name: "ingress/nginx", Namespace: "ingress"}),
+		},
+		Clusters: []*ClusterResult{{
+			Name:     "dev",
+			MetaData: &types.ObjectMeta{Namespace: "dev"},
+			Modules:  []string{"auth/dex"},
+			Bundles: []*module.Bundle{
+				bundle(t, types.Module{Name: "auth/dex", Namespace: "auth"}, module.WithClusterMetaData(&types.ObjectMeta{Namespace: "dev"})),
+			},
+		}},
+	}
+	fs := filesys.MakeFsInMemory()
+	report, err := r.Export(fs, ChartsDir, WithFormat(FormatHelmChart))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"platform-1.2.0.tgz",
+		"platform-dev-1.2.0.tgz",
+		"platform-dev/Chart.yaml",
+		"platform-dev/templates/auth-dex.yaml",
+		"platform-dev/values.yaml",
+		"platform/Chart.yaml",
+		"platform/templates/auth-dex.yaml",
+		"platform/templates/ingress-nginx.yaml",
+		"platform/values.yaml",
+	}, report.Written)
+
+	// Charts of clusters deploy the resources of the cluster
+	data, err := fs.ReadFile("charts/platform-dev/templates/auth-dex.yaml")
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "namespace: dev")
+
+	report, err = r.Export(filesys.MakeFsInMemory(), ChartsDir, WithFormat(FormatHelmChart), WithChartPerModule(true))
+	assert.NoError(t, err)
+	assert.Contains(t, report.Written, "dev-auth-dex/templates/auth-dex.yaml")
+	assert.Contains(t, report.Written, "ingress-nginx-1.2.0.tgz")
+}
+
+func TestBundleOpts_SealedSecretsCertificate(t *testing.T) {
+	m := types.Module{Name: "auth/dex", Namespace: "auth", Secrets: []types.Secret{{Key: "PASSWORD", Value: "secret"}}}
+	fs := secretBundleFs(t, m)
+	writeSealedSecretsCert(t, fs, "platform/sealed-secrets.pem")
+	km := &types.BananaFile{SealedSecrets: &types.SealedSecrets{Certificate: "sealed-secrets.pem"}}
+
+	// The certificate is relative to the directory of the banana file rather than the working directory
+	b := NewBuilder(fs, "", WithDir("platform"))
+	mod := module.NewKustomizeModule(fs, m, "")
+	opts, err := b.bundleOpts(km, mod)
+	assert.NoError(t, err)
+	bun, err := mod.Bundle(opts...)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Len(t, bun.FindByGVK(module.GroupVersionKind{Group: "bitnami.com", Version: "v1alpha1", Kind: "SealedSecret"}), 1)
+
+	opts, err = NewBuilder(fs, "").bundleOpts(km, mod)
+	assert.NoError(t, err)
+	_, err = mod.Bundle(opts...)
+	assert.Error(t, err)
+}
+
+func TestBundleOpts_GeneratedMetaData(t *testing.T) {
+	m := types.Module{Name: "auth/dex", Namespace: "auth", Secrets: []types.Secret{
+		{Key: "PASSWORD", Value: "secret"},
+		{Key: "TOKEN", Ref: "vault://kv/dex#token"},
+	}}
+	fs := secretBundleFs(t, m)
+	writeSealedSecretsCert(t, fs, "sealed-secrets.pem")
+	km := &types.BananaFile{
+		MetaData:        &types.ObjectMeta{Labels: map[string]string{"team": "platform"}, Annotations: map[string]string{"cost": "42"}},
+		ExternalSecrets: &types.ExternalSecrets{SecretStoreRef: types.SecretStoreRef{Name: "vault"}},
+		SealedSecrets:   &types.SealedSecrets{Certificate: "sealed-secrets.pem"},
+	}
+
+	// Options are given in the order the builder gives them
+	mod := module.NewKustomizeModule(fs, m, "")
+	bopts, err := NewBuilder(fs, "").bundleOpts(km, mod)
+	assert.NoError(t, err)
+	opts := append([]module.BundleOpts{module.WithMetaData(mergeMetaData(km.MetaData, m.MetaData))}, bopts...)
+	opts = append(opts, module.WithProvenance(module.Provenance{BananaVersion: "v1.0.0"}))
+	bun, err := mod.Bundle(opts...)
+	if !assert.NoError(t, err) {
+		return
+	}
+	d := deployment{bundles: []*module.Bundle{bun}}
+	assert.NoError(t, d.ensureNamespaces(nil))
+
+	// Resources generated by banana carry the metadata and provenance the same as those of the module
+	kinds := map[string]bool{}
+	for _, res := range bun.Resources() {
+		kinds[res.GetKind()] = true
+		assert.Equal(t, "platform", res.GetLabels()["team"], res.GetKind())
+		assert.Equal(t, "42", res.GetAnnotations()["cost"], res.GetKind())
+		assert.Equal(t, "auth/dex", res.GetAnnotations()[module.AnnotationModule], res.GetKind())
+	}
+	assert.Equal(t, map[string]bool{"ConfigMap": true, "ExternalSecret": true, "SealedSecret": true, "Namespace": true}, kinds)
+}
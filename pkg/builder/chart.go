@@ -0,0 +1,101 @@
+package builder
+
+import (
+	"fmt"
+
+	"github.com/middlewaregruppen/banana/pkg/helm"
+	"github.com/middlewaregruppen/banana/pkg/module"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+const (
+	// ChartsDir is the directory, relative to the banana file, that charts are exported to
+	ChartsDir = "charts"
+
+	// defaultChartName is the name of the chart of banana files without a name
+	defaultChartName = "banana"
+)
+
+// Format is the format of an export
+type Format string
+
+const (
+	// FormatKustomize exports a tree of kustomizations
+	FormatKustomize Format = "kustomize"
+	// FormatHelmChart exports Helm charts, both as a chart directory and packaged
+	FormatHelmChart Format = "helm-chart"
+)
+
+// ParseFormat returns the format matching s. An empty string returns FormatKustomize.
+func ParseFormat(s string) (Format, error) {
+	switch Format(s) {
+	case "":
+		return FormatKustomize, nil
+	case FormatKustomize, FormatHelmChart:
+		return Format(s), nil
+	}
+	return "", fmt.Errorf("unknown format %q, must be one of %s or %s", s, FormatKustomize, FormatHelmChart)
+}
+
+// stageCharts writes a chart of the top level and of each cluster into the root of fs, or a chart per module if
+// perModule is set. Charts are built from the kustomize export so that they deploy the same resources.
+func (r *Result) stageCharts(fs filesys.FileSystem, perModule bool) error {
+	src := filesys.MakeFsInMemory()
+	if err := r.stage(src); err != nil {
+		return err
+	}
+	name := r.Name
+	if len(name) == 0 {
+		name = defaultChartName
+	}
+
+	if err := r.writeCharts(fs, src, name, "", r.deployed(), perModule); err != nil {
+		return err
+	}
+	for _, c := range r.Clusters {
+		if err := r.writeCharts(fs, src, fmt.Sprintf("%s-%s", name, c.Name), c.Name, r.deployedTo(c), perModule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeCharts builds modules from the export in src and writes them as the chart name into fs, or as a chart per
+// module if perModule is set
+func (r *Result) writeCharts(fs, src filesys.FileSystem, name, cluster string, modules []deployedModule, perModule bool) error {
+	if len(modules) == 0 {
+		return nil
+	}
+	var charts []*helm.Chart
+	for _, m := range modules {
+		if perModule || len(charts) == 0 {
+			chartName := name
+			if perModule {
+				chartName = appName(cluster, m.name)
+			}
+			chart, err := helm.NewChart(chartName, r.Version, r.ImageFieldSpecs)
+			if err != nil {
+				return err
+			}
+			charts = append(charts, chart)
+		}
+
+		rm, err := krusty.MakeKustomizer(module.DefaultKustomizerOptions).Run(src, m.path)
+		if err != nil {
+			return fmt.Errorf("module %s: %w", m.name, err)
+		}
+		if err := charts[len(charts)-1].AddTemplate(appName("", m.name)+".yaml", rm.Resources()); err != nil {
+			return fmt.Errorf("module %s: %w", m.name, err)
+		}
+	}
+	for _, chart := range charts {
+		if err := chart.Write(fs, "."); err != nil {
+			return err
+		}
+		if err := chart.Package(fs, "."); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package builder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/middlewaregruppen/banana/pkg/module"
+)
+
+// AnnotationSyncWave is the annotation Argo CD orders resources by
+const AnnotationSyncWave = "argocd.argoproj.io/sync-wave"
+
+// missingModules returns a module for every dependency of name not in declared. Fails unless missing is types.MissingAdd.
+func missingModules(name string, deps []types.ModuleDependency, declared map[string]bool, missing types.MissingDependencies) ([]types.Module, error) {
+	var added []types.Module
+	for _, dep := range deps {
+		if declared[dep.Name] {
+			continue
+		}
+		if missing != types.MissingAdd {
+			return nil, fmt.Errorf("module %s depends on %s, which is not declared", name, dep.Name)
+		}
+		declared[dep.Name] = true
+		added = append(added, types.Module{Name: dep.Name, Version: dep.Version})
+	}
+	return added, nil
+}
+
+// waves returns the wave of every module of d, the number of modules it transitively depends on in sequence.
+// Modules without dependencies are in wave 0, and every module is in a wave after those it depends on.
+func (d deployment) waves() (map[string]int, error) {
+	deps := map[string][]string{}
+	var names []string
+	for _, bun := range append(append([]*module.Bundle{}, d.shared...), d.bundles...) {
+		name := bun.Module().Name()
+		if _, ok := deps[name]; !ok {
+			names = append(names, name)
+		}
+		deps[name] = bun.Dependencies()
+	}
+
+	waves := map[string]int{}
+	var visit func(name string, path []string) (int, error)
+	visit = func(name string, path []string) (int, error) {
+		for i, p := range path {
+			if p == name {
+				return 0, d.errorf("dependency cycle: %s", strings.Join(append(path[i:], name), " -> "))
+			}
+		}
+		if w, ok := waves[name]; ok {
+			return w, nil
+		}
+		wave := 0
+		next := append(append([]string{}, path...), name)
+		for _, dep := range deps[name] {
+			if _, ok := deps[dep]; !ok {
+				return 0, d.errorf("module %s depends on %s, which is not declared", name, dep)
+			}
+			w, err := visit(dep, next)
+			if err != nil {
+				return 0, err
+			}
+			if w+1 > wave {
+				wave = w + 1
+			}
+		}
+		waves[name] = wave
+		return wave, nil
+	}
+	for _, name := range names {
+		if _, err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return waves, nil
+}
+
+// annotateWaves annotates every resource of the bundles of d with the wave of its module as an Argo CD sync wave
+func (d deployment) annotateWaves(waves map[string]int) error {
+	for _, bun := range d.bundles {
+		wave := strconv.Itoa(waves[bun.Module().Name()])
+		for _, res := range bun.Resources() {
+			a := res.GetAnnotations()
+			a[AnnotationSyncWave] = wave
+			if err := res.SetAnnotations(a); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// numbered returns the export path of the module name in the given wave
+func numbered(name string, wave int) string {
+	return fmt.Sprintf("%02d-%s", wave, name)
+}
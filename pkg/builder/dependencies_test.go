@@ -0,0 +1,102 @@
+package builder
+
+import (
+	"testing"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/middlewaregruppen/banana/pkg/module"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+func TestMissingModules(t *testing.T) {
+	deps := []types.ModuleDependency{{Name: "ingress/nginx", Version: "v1.2.0"}, {Name: "cert-manager/cert-manager"}}
+	declared := map[string]bool{"cert-manager/cert-manager": true}
+
+	_, err := missingModules("auth/dex", deps, declared, types.MissingFail)
+	assert.EqualError(t, err, "module auth/dex depends on ingress/nginx, which is not declared")
+
+	added, err := missingModules("auth/dex", deps, declared, types.MissingAdd)
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Module{{Name: "ingress/nginx", Version: "v1.2.0"}}, added)
+	assert.True(t, declared["ingress/nginx"])
+}
+
+func TestWaves(t *testing.T) {
+	withDeps := func(name string, deps ...string) *module.Bundle {
+		return bundle(t, types.Module{Name: name}, module.WithDependencies(deps))
+	}
+
+	d := deployment{bundles: []*module.Bundle{
+		withDeps("apps/web", "ingress/nginx", "cert-manager/issuers"),
+		withDeps("cert-manager/issuers", "cert-manager/cert-manager"),
+		withDeps("cert-manager/cert-manager"),
+		withDeps("ingress/nginx"),
+	}}
+	waves, err := d.waves()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{
+		"apps/web":                  2,
+		"cert-manager/issuers":      1,
+		"cert-manager/cert-manager": 0,
+		"ingress/nginx":             0,
+	}, waves)
+
+	d.cluster = "dev"
+	d.bundles = []*module.Bundle{
+		withDeps("apps/web", "apps/api"),
+		withDeps("apps/api", "apps/db"),
+		withDeps("apps/db", "apps/web"),
+	}
+	_, err = d.waves()
+	assert.EqualError(t, err, "cluster dev: dependency cycle: apps/web -> apps/api -> apps/db -> apps/web")
+
+	d.bundles = []*module.Bundle{withDeps("apps/web", "apps/api")}
+	_, err = d.waves()
+	assert.EqualError(t, err, "cluster dev: module apps/web depends on apps/api, which is not declared")
+}
+
+func TestExport_Ordering(t *testing.T) {
+	r := &Result{
+		Ordering: types.OrderingNumbered,
+		Bundles: []*module.Bundle{
+			bundle(t, types.Module{Name: "auth/dex", Namespace: "auth"}, module.WithDependencies([]string{"ingress/nginx"})),
+			bundle(t, types.Module{Name: "ingress/nginx", Namespace: "ingress"}),
+		},
+		Waves: map[string]int{"auth/dex": 1, "ingress/nginx": 0},
+		Clusters: []*ClusterResult{{
+			Name:    "dev",
+			Modules: []string{"auth/dex", "ingress/nginx"},
+			Bundles: []*module.Bundle{bundle(t, types.Module{Name: "ingress/nginx", Namespace: "dev-ingress"})},
+			Waves:   map[string]int{"auth/dex": 1, "ingress/nginx": 0},
+		}},
+	}
+	fs := filesys.MakeFsInMemory()
+	report, err := r.Export(fs, "src")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"00-ingress/nginx/configmap_config.yaml",
+		"00-ingress/nginx/kustomization.yaml",
+		"01-auth/dex/configmap_config.yaml",
+		"01-auth/dex/kustomization.yaml",
+		"clusters/dev/00-ingress/nginx/configmap_config.yaml",
+		"clusters/dev/00-ingress/nginx/kustomization.yaml",
+		"clusters/dev/kustomization.yaml",
+		"kustomization.yaml",
+	}, report.Written)
+
+	rm, err := krusty.MakeKustomizer(module.DefaultKustomizerOptions).Run(fs, "src/clusters/dev")
+	assert.NoError(t, err)
+	var namespaces []string
+	for _, res := range rm.Resources() {
+		namespaces = append(namespaces, res.GetNamespace())
+	}
+	assert.Equal(t, []string{"auth", "dev-ingress"}, namespaces)
+}
+
+func TestAnnotateWaves(t *testing.T) {
+	d := deployment{bundles: []*module.Bundle{bundle(t, types.Module{Name: "auth/dex"})}}
+	assert.NoError(t, d.annotateWaves(map[string]int{"auth/dex": 3}))
+	assert.Equal(t, "3", d.bundles[0].Resources()[0].GetAnnotations()[AnnotationSyncWave])
+}
@@ -0,0 +1,373 @@
+package builder
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/middlewaregruppen/banana/pkg/module"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	ktypes "sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+const (
+	// ClustersDir is the directory within the export directory holding the root of each cluster
+	ClustersDir = "clusters"
+
+	// ManifestFile is the file in the export directory listing every file written by the export
+	ManifestFile = ".banana-manifest.yaml"
+
+	kustomizationFile = "kustomization.yaml"
+	manifestComment   = "# Files written by banana. Files listed here that are no longer built are removed on the next build.\n"
+)
+
+// Manifest lists the files owned by an export, relative to the export directory
+type Manifest struct {
+	Files []string `yaml:"files"`
+}
+
+// Report lists the files of an export, relative to the export directory
+type Report struct {
+	// Written is the files written
+	Written []string
+
+	// Removed is the files removed since they were written by a previous export but are no longer built
+	Removed []string
+}
+
+type exportOptions struct {
+	prune          bool
+	dryRun         bool
+	format         Format
+	chartPerModule bool
+}
+
+// ExportOpts is options for exporting a build result
+type ExportOpts func(o *exportOptions)
+
+// WithPrune returns an ExportOpts that controls whether files written by a previous export but no longer
+// built are removed. Enabled by default.
+func WithPrune(prune bool) ExportOpts {
+	return func(o *exportOptions) {
+		o.prune = prune
+	}
+}
+
+// WithDryRun returns an ExportOpts that only reports the files that would be written and removed
+func WithDryRun(dryRun bool) ExportOpts {
+	return func(o *exportOptions) {
+		o.dryRun = dryRun
+	}
+}
+
+// WithFormat returns an ExportOpts exporting in the given format. FormatKustomize by default.
+func WithFormat(format Format) ExportOpts {
+	return func(o *exportOptions) {
+		o.format = format
+	}
+}
+
+// WithChartPerModule returns an ExportOpts exporting a chart per module instead of one for the top level and
+// each cluster, when exporting Helm charts
+func WithChartPerModule(perModule bool) ExportOpts {
+	return func(o *exportOptions) {
+		o.chartPerModule = perModule
+	}
+}
+
+// Export writes every bundle into dir on fs along with a root kustomization.yaml referencing every module,
+// so that the whole tree can be built with kustomize. Each cluster gets a root in clusters/<name> referencing
+// its modules, with modules overridden for the cluster exported below it. The files written are recorded in
+// a manifest so that files of a previous export that are no longer built can be removed. Helm charts are written
+// instead when exporting in FormatHelmChart.
+func (r *Result) Export(fs filesys.FileSystem, dir string, opts ...ExportOpts) (*Report, error) {
+	o := &exportOptions{prune: true, format: FormatKustomize}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	// Stage the export in memory so that the files it consists of are known before writing any of them
+	staging := filesys.MakeFsInMemory()
+	stage := r.stage
+	if o.format == FormatHelmChart {
+		stage = func(fs filesys.FileSystem) error {
+			return r.stageCharts(fs, o.chartPerModule)
+		}
+	}
+	if err := stage(staging); err != nil {
+		return nil, err
+	}
+	report := &Report{}
+	err := staging.Walk(".", func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		report.Written = append(report.Written, strings.TrimPrefix(p, "/"))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(report.Written)
+
+	previous, err := readManifest(fs, dir)
+	if err != nil {
+		return nil, err
+	}
+	written := map[string]bool{}
+	for _, f := range report.Written {
+		written[f] = true
+	}
+	manifest := &Manifest{Files: report.Written}
+	for _, f := range previous.Files {
+		if written[f] {
+			continue
+		}
+		if o.prune {
+			report.Removed = append(report.Removed, f)
+			continue
+		}
+		// Files kept are still owned so that they can be removed by a later export
+		manifest.Files = append(manifest.Files, f)
+	}
+	sort.Strings(manifest.Files)
+
+	if o.dryRun {
+		return report, nil
+	}
+
+	for _, f := range report.Written {
+		data, err := staging.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeFile(fs, path.Join(dir, f), data); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range report.Removed {
+		logrus.Debugf("removing %s which is no longer built", f)
+		if err := removeFile(fs, dir, f); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeManifest(fs, dir, manifest); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// exportPath returns the path of the module name in the given waves, relative to its root
+func (r *Result) exportPath(name string, waves map[string]int) string {
+	if r.Ordering == types.OrderingNumbered {
+		return numbered(name, waves[name])
+	}
+	return name
+}
+
+// stage writes the files of the export into the root of fs
+func (r *Result) stage(fs filesys.FileSystem) error {
+	var modules []string
+	for _, bun := range r.Bundles {
+		p := r.exportPath(bun.Module().Name(), r.Waves)
+		if err := bun.Export(fs, module.WithExportLayout(r.Layout), module.WithExportPath(p)); err != nil {
+			return err
+		}
+		modules = append(modules, p)
+	}
+	if err := writeKustomization(fs, ".", modules); err != nil {
+		return err
+	}
+
+	for _, c := range r.Clusters {
+		root := path.Join(ClustersDir, c.Name)
+		local := map[string]bool{}
+		for _, bun := range c.Bundles {
+			p := r.exportPath(bun.Module().Name(), c.Waves)
+			if err := bun.Export(fs, module.WithExportRootDir(root), module.WithExportLayout(r.Layout), module.WithExportPath(p)); err != nil {
+				return err
+			}
+			local[bun.Module().Name()] = true
+		}
+
+		// Modules not overridden refer to those exported at the top level
+		var resources []string
+		for _, m := range c.Modules {
+			if local[m] {
+				resources = append(resources, r.exportPath(m, c.Waves))
+				continue
+			}
+			resources = append(resources, path.Join("..", "..", r.exportPath(m, r.Waves)))
+		}
+		if err := writeKustomization(fs, root, resources); err != nil {
+			return err
+		}
+	}
+	if r.ArgoCD != nil {
+		if err := r.stageArgoCD(fs); err != nil {
+			return err
+		}
+	}
+	if r.Flux != nil {
+		return r.stageFlux(fs)
+	}
+	return nil
+}
+
+// writeKustomization writes a kustomization.yaml into dir holding resources
+func writeKustomization(fs filesys.FileSystem, dir string, resources []string) error {
+	k := ktypes.Kustomization{
+		TypeMeta: ktypes.TypeMeta{
+			Kind:       ktypes.KustomizationKind,
+			APIVersion: ktypes.KustomizationVersion,
+		},
+		Resources: resources,
+	}
+	d, err := yaml.Marshal(&k)
+	if err != nil {
+		return err
+	}
+	return writeFile(fs, path.Join(dir, kustomizationFile), d)
+}
+
+// readManifest reads the manifest of the export in dir. Returns an empty manifest if there is none. Files listed
+// must be relative paths within dir since they may be removed.
+func readManifest(fs filesys.FileSystem, dir string) (*Manifest, error) {
+	m := &Manifest{}
+	p := path.Join(dir, ManifestFile)
+	if !fs.Exists(p) {
+		return m, nil
+	}
+	data, err := fs.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	for _, f := range m.Files {
+		clean := path.Clean(f)
+		if path.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+			return nil, fmt.Errorf("%s: file %q is outside of the export directory", p, f)
+		}
+	}
+	return m, nil
+}
+
+func writeManifest(fs filesys.FileSystem, dir string, m *Manifest) error {
+	d, err := yaml.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return writeFile(fs, path.Join(dir, ManifestFile), append([]byte(manifestComment), d...))
+}
+
+func writeFile(fs filesys.FileSystem, p string, data []byte) error {
+	if err := fs.MkdirAll(path.Dir(p)); err != nil {
+		return err
+	}
+	return fs.WriteFile(p, data)
+}
+
+// removeFile removes the file f in dir along with any parent directories of f left empty
+func removeFile(fs filesys.FileSystem, dir, f string) error {
+	p := path.Join(dir, f)
+	if fs.Exists(p) {
+		if err := fs.RemoveAll(p); err != nil {
+			return err
+		}
+	}
+	for parent := path.Dir(f); parent != "." && parent != "/"; parent = path.Dir(parent) {
+		d := path.Join(dir, parent)
+		if !fs.IsDir(d) {
+			continue
+		}
+		entries, err := fs.ReadDir(d)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			break
+		}
+		if err := fs.RemoveAll(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deployedModule is a module deployed on its own by a GitOps tool
+type deployedModule struct {
+	// name is the name of the module
+	name string
+	// bundle is the bundle of the module
+	bundle *module.Bundle
+	// path is the path of the root of the module, relative to the export directory
+	path string
+	// namespace is the namespace the module is deployed to, if any
+	namespace string
+	wave      int
+}
+
+// deployed returns the modules declared at the top level
+func (r *Result) deployed() []deployedModule {
+	var modules []deployedModule
+	for _, bun := range r.Bundles {
+		name := bun.Module().Name()
+		modules = append(modules, deployedModule{
+			name:      name,
+			bundle:    bun,
+			path:      r.exportPath(name, r.Waves),
+			namespace: bun.Namespace(),
+			wave:      r.Waves[name],
+		})
+	}
+	return modules
+}
+
+// deployedTo returns the modules deployed to the cluster c
+func (r *Result) deployedTo(c *ClusterResult) []deployedModule {
+	root := path.Join(ClustersDir, c.Name)
+	bundles := map[string]*module.Bundle{}
+	for _, bun := range r.Bundles {
+		bundles[bun.Module().Name()] = bun
+	}
+	local := map[string]bool{}
+	for _, bun := range c.Bundles {
+		bundles[bun.Module().Name()] = bun
+		local[bun.Module().Name()] = true
+	}
+
+	var modules []deployedModule
+	for _, name := range c.Modules {
+		bun, ok := bundles[name]
+		if !ok {
+			continue
+		}
+		m := deployedModule{
+			name:      name,
+			bundle:    bun,
+			path:      r.exportPath(name, r.Waves),
+			namespace: bun.Namespace(),
+			wave:      c.Waves[name],
+		}
+		if local[name] {
+			m.path = path.Join(root, r.exportPath(name, c.Waves))
+		}
+		modules = append(modules, m)
+	}
+	return modules
+}
+
+func writeYAML(fs filesys.FileSystem, p string, v interface{}) error {
+	d, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeFile(fs, p, d)
+}
@@ -0,0 +1,140 @@
+package builder
+
+import (
+	"path"
+	"sort"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+const (
+	// FluxDir is the directory, within the export directory and the root of each cluster, holding Flux Kustomizations
+	FluxDir = "_flux"
+
+	fluxAPIVersion = "kustomize.toolkit.fluxcd.io/v1"
+)
+
+type fluxKustomization struct {
+	APIVersion string                `yaml:"apiVersion"`
+	Kind       string                `yaml:"kind"`
+	Metadata   objectMeta            `yaml:"metadata"`
+	Spec       fluxKustomizationSpec `yaml:"spec"`
+}
+
+type fluxKustomizationSpec struct {
+	Interval        string                `yaml:"interval"`
+	Path            string                `yaml:"path"`
+	Prune           bool                  `yaml:"prune"`
+	SourceRef       types.FluxSourceRef   `yaml:"sourceRef"`
+	TargetNamespace string                `yaml:"targetNamespace,omitempty"`
+	DependsOn       []fluxReference       `yaml:"dependsOn,omitempty"`
+	Decryption      *fluxDecryption       `yaml:"decryption,omitempty"`
+	HealthChecks    []fluxObjectReference `yaml:"healthChecks,omitempty"`
+}
+
+type fluxReference struct {
+	Name string `yaml:"name"`
+}
+
+type fluxDecryption struct {
+	Provider  string        `yaml:"provider"`
+	SecretRef fluxReference `yaml:"secretRef"`
+}
+
+type fluxObjectReference struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Name       string `yaml:"name"`
+	Namespace  string `yaml:"namespace,omitempty"`
+}
+
+// stageFlux writes Flux Kustomizations for the modules of the top level and of each cluster
+func (r *Result) stageFlux(fs filesys.FileSystem) error {
+	cfg := *r.Flux
+	if len(cfg.Path) == 0 {
+		cfg.Path = ExportDir
+	}
+	if len(cfg.Namespace) == 0 {
+		cfg.Namespace = "flux-system"
+	}
+	if len(cfg.Interval) == 0 {
+		cfg.Interval = "10m"
+	}
+	if len(cfg.DecryptionSecret) == 0 {
+		cfg.DecryptionSecret = "sops-age"
+	}
+	source := types.FluxSourceRef{Kind: "GitRepository", Name: "flux-system"}
+	if cfg.SourceRef != nil {
+		if len(cfg.SourceRef.Kind) > 0 {
+			source.Kind = cfg.SourceRef.Kind
+		}
+		if len(cfg.SourceRef.Name) > 0 {
+			source.Name = cfg.SourceRef.Name
+		}
+		source.Namespace = cfg.SourceRef.Namespace
+	}
+	cfg.SourceRef = &source
+
+	if err := r.writeKustomizations(fs, FluxDir, cfg, "", r.deployed()); err != nil {
+		return err
+	}
+	for _, c := range r.Clusters {
+		dir := path.Join(ClustersDir, c.Name, FluxDir)
+		if err := r.writeKustomizations(fs, dir, cfg, c.Name, r.deployedTo(c)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeKustomizations writes a Flux Kustomization per module into dir along with a kustomization.yaml listing them
+func (r *Result) writeKustomizations(fs filesys.FileSystem, dir string, cfg types.Flux, cluster string, modules []deployedModule) error {
+	if len(modules) == 0 {
+		return nil
+	}
+	var files []string
+	for _, m := range modules {
+		k := fluxKustomization{
+			APIVersion: fluxAPIVersion,
+			Kind:       "Kustomization",
+			Metadata:   objectMeta{Name: appName(cluster, m.name), Namespace: cfg.Namespace},
+			Spec: fluxKustomizationSpec{
+				Interval:        cfg.Interval,
+				Path:            "./" + path.Join(cfg.Path, m.path),
+				Prune:           cfg.Prune,
+				SourceRef:       *cfg.SourceRef,
+				TargetNamespace: m.namespace,
+			},
+		}
+		for _, dep := range m.bundle.Dependencies() {
+			k.Spec.DependsOn = append(k.Spec.DependsOn, fluxReference{Name: appName(cluster, dep)})
+		}
+		if r.Encrypted {
+			k.Spec.Decryption = &fluxDecryption{Provider: "sops", SecretRef: fluxReference{Name: cfg.DecryptionSecret}}
+		}
+		for _, res := range m.bundle.Resources() {
+			if res.GetKind() != "Deployment" || res.GetApiVersion() != "apps/v1" {
+				continue
+			}
+			ns := m.namespace
+			if len(ns) == 0 {
+				ns = res.GetNamespace()
+			}
+			k.Spec.HealthChecks = append(k.Spec.HealthChecks, fluxObjectReference{
+				APIVersion: res.GetApiVersion(),
+				Kind:       res.GetKind(),
+				Name:       res.GetName(),
+				Namespace:  ns,
+			})
+		}
+
+		f := k.Metadata.Name + ".yaml"
+		if err := writeYAML(fs, path.Join(dir, f), k); err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	return writeKustomization(fs, dir, files)
+}
@@ -0,0 +1,121 @@
+package builder
+
+import (
+	"testing"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/middlewaregruppen/banana/pkg/module"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+const dexDeployment = "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: dex\nspec:\n  template:\n    spec:\n      containers:\n      - name: dex\n        image: ghcr.io/dexidp/dex:v2.37.0\n"
+
+func readFluxKustomization(t *testing.T, fs filesys.FileSystem, p string) fluxKustomization {
+	data, err := fs.ReadFile(p)
+	assert.NoError(t, err)
+	var k fluxKustomization
+	assert.NoError(t, yaml.Unmarshal(data, &k))
+	return k
+}
+
+func TestExport_Flux(t *testing.T) {
+	mfs := filesys.MakeFsInMemory()
+	assert.NoError(t, mfs.WriteFile("auth/dex/kustomization.yaml", []byte("resources:\n- deployment.yaml\n")))
+	assert.NoError(t, mfs.WriteFile("auth/dex/deployment.yaml", []byte(dexDeployment)))
+	dex, err := module.NewKustomizeModule(mfs, types.Module{Name: "auth/dex", Namespace: "auth"}, "").
+		Bundle(module.WithDependencies([]string{"ingress/nginx"}))
+	assert.NoError(t, err)
+	meta := &types.ObjectMeta{Namespace: "dev"}
+	devDex, err := module.NewKustomizeModule(mfs, types.Module{Name: "auth/dex", Namespace: "auth"}, "").
+		Bundle(module.WithDependencies([]string{"ingress/nginx"}), module.WithClusterMetaData(meta))
+	assert.NoError(t, err)
+
+	r := &Result{
+		Flux:      &types.Flux{Prune: true, SourceRef: &types.FluxSourceRef{Name: "deploy"}},
+		Encrypted: true,
+		Bundles:   []*module.Bundle{dex, bundle(t, types.Module{Name: "ingress/nginx", Namespace: "ingress"})},
+		Clusters: []*ClusterResult{{
+			Name:     "dev",
+			MetaData: meta,
+			Modules:  []string{"auth/dex", "ingress/nginx"},
+			Bundles: []*module.Bundle{
+				devDex,
+				bundle(t, types.Module{Name: "ingress/nginx", Namespace: "ingress"}, module.WithClusterMetaData(meta)),
+			},
+		}},
+	}
+	fs := filesys.MakeFsInMemory()
+	report, err := r.Export(fs, "src")
+	assert.NoError(t, err)
+	assert.Subset(t, report.Written, []string{
+		"_flux/auth-dex.yaml",
+		"_flux/ingress-nginx.yaml",
+		"_flux/kustomization.yaml",
+		"clusters/dev/auth/dex/deployment_dex.yaml",
+		"clusters/dev/_flux/dev-auth-dex.yaml",
+		"clusters/dev/_flux/dev-ingress-nginx.yaml",
+		"clusters/dev/_flux/kustomization.yaml",
+	})
+
+	k := readFluxKustomization(t, fs, "src/_flux/auth-dex.yaml")
+	assert.Equal(t, fluxKustomization{
+		APIVersion: fluxAPIVersion,
+		Kind:       "Kustomization",
+		Metadata:   objectMeta{Name: "auth-dex", Namespace: "flux-system"},
+		Spec: fluxKustomizationSpec{
+			Interval:        "10m",
+			Path:            "./src/auth/dex",
+			Prune:           true,
+			SourceRef:       types.FluxSourceRef{Kind: "GitRepository", Name: "deploy"},
+			TargetNamespace: "auth",
+			DependsOn:       []fluxReference{{Name: "ingress-nginx"}},
+			Decryption:      &fluxDecryption{Provider: "sops", SecretRef: fluxReference{Name: "sops-age"}},
+			HealthChecks:    []fluxObjectReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: "dex", Namespace: "auth"}},
+		},
+	}, k)
+
+	k = readFluxKustomization(t, fs, "src/clusters/dev/_flux/dev-auth-dex.yaml")
+	assert.Equal(t, "./src/clusters/dev/auth/dex", k.Spec.Path)
+	assert.Equal(t, "dev", k.Spec.TargetNamespace)
+	assert.Equal(t, []fluxReference{{Name: "dev-ingress-nginx"}}, k.Spec.DependsOn)
+	assert.Equal(t, "dev", k.Spec.HealthChecks[0].Namespace)
+
+	k = readFluxKustomization(t, fs, "src/clusters/dev/_flux/dev-ingress-nginx.yaml")
+	assert.Empty(t, k.Spec.HealthChecks)
+	assert.Empty(t, k.Spec.DependsOn)
+}
+
+func TestExport_FluxNamePrefix(t *testing.T) {
+	mfs := filesys.MakeFsInMemory()
+	assert.NoError(t, mfs.WriteFile("auth/dex/kustomization.yaml", []byte("resources:\n- deployment.yaml\n")))
+	assert.NoError(t, mfs.WriteFile("auth/dex/deployment.yaml", []byte(dexDeployment)))
+	m := types.Module{Name: "auth/dex", Namespace: "auth"}
+	meta := module.WithMetaData(&types.ObjectMeta{NamePrefix: "acme-"})
+	dev := &types.ObjectMeta{NamePrefix: "dev-"}
+	dex, err := module.NewKustomizeModule(mfs, m, "").Bundle(meta)
+	assert.NoError(t, err)
+	devDex, err := module.NewKustomizeModule(mfs, m, "").Bundle(meta, module.WithClusterMetaData(dev))
+	assert.NoError(t, err)
+
+	r := &Result{
+		Flux:    &types.Flux{SourceRef: &types.FluxSourceRef{Name: "deploy"}},
+		Bundles: []*module.Bundle{dex},
+		Clusters: []*ClusterResult{{
+			Name:     "dev",
+			MetaData: dev,
+			Modules:  []string{"auth/dex"},
+			Bundles:  []*module.Bundle{devDex},
+		}},
+	}
+	fs := filesys.MakeFsInMemory()
+	_, err = r.Export(fs, "src")
+	assert.NoError(t, err)
+
+	// Health checks name Deployments by the names they are deployed with
+	k := readFluxKustomization(t, fs, "src/_flux/auth-dex.yaml")
+	assert.Equal(t, []fluxObjectReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: "acme-dex", Namespace: "auth"}}, k.Spec.HealthChecks)
+	k = readFluxKustomization(t, fs, "src/clusters/dev/_flux/dev-auth-dex.yaml")
+	assert.Equal(t, []fluxObjectReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: "dev-acme-dex", Namespace: "auth"}}, k.Spec.HealthChecks)
+}
@@ -0,0 +1,142 @@
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/middlewaregruppen/banana/pkg/module"
+	"github.com/sirupsen/logrus"
+)
+
+// indexed is a resource of a bundle in the index of a deployment
+type indexed struct {
+	bun     *module.Bundle
+	res     module.Resource
+	mutable bool
+}
+
+// index returns every resource of d other than Namespaces by group, kind, namespace and name, along with the keys
+// in the order first seen. Resources are keyed by the namespace they are deployed to rather than their own.
+func (d deployment) index() (map[string][]indexed, []string) {
+	index := map[string][]indexed{}
+	var keys []string
+	visit := func(bundles []*module.Bundle, mutable bool) {
+		for _, bun := range bundles {
+			for _, res := range bun.Resources() {
+				if res.IsNamespace() {
+					continue
+				}
+				ns := ""
+				if !res.GetGvk().IsClusterScoped() {
+					ns = d.namespaceOf(bun, res)
+				}
+				key := strings.Join([]string{res.GetGvk().Group, res.GetKind(), ns, res.GetName()}, "/")
+				if _, ok := index[key]; !ok {
+					keys = append(keys, key)
+				}
+				index[key] = append(index[key], indexed{bun: bun, res: res, mutable: mutable})
+			}
+		}
+	}
+	visit(d.shared, false)
+	visit(d.bundles, true)
+	return index, keys
+}
+
+// resolveConflicts resolves resources emitted by several modules of d according to strategy. Every conflict
+// is reported at once, naming the modules emitting the resource.
+func (d deployment) resolveConflicts(strategy types.ConflictStrategy) error {
+	index, keys := d.index()
+	var conflicts []string
+	for _, key := range keys {
+		entries := index[key]
+		if len(entries) < 2 {
+			continue
+		}
+		name := resourceName(d, entries[0])
+		modules := moduleNames(entries)
+
+		switch strategy {
+		case types.ConflictFail:
+			conflicts = append(conflicts, fmt.Sprintf("%s is emitted by modules %s", name, modules))
+			continue
+		case types.ConflictMergeIfIdentical:
+			identical, err := d.identical(entries)
+			if err != nil {
+				return err
+			}
+			if !identical {
+				conflicts = append(conflicts, fmt.Sprintf("%s is emitted by modules %s with different content", name, modules))
+				continue
+			}
+		case types.ConflictFirstWins:
+			logrus.Warnf("%s is emitted by modules %s, keeping that of %s", name, modules, entries[0].bun.Module().Name())
+		}
+
+		// Shared bundles are resolved when the top level is
+		for _, e := range entries[1:] {
+			if e.mutable {
+				e.bun.RemoveResource(e.res)
+			}
+		}
+	}
+	if len(conflicts) > 0 {
+		return d.errorf("%s", strings.Join(conflicts, "\n"))
+	}
+	return nil
+}
+
+// identical returns true if every resource of entries has the same content as the first, apart from provenance
+func (d deployment) identical(entries []indexed) (bool, error) {
+	first, err := d.contentOf(entries[0])
+	if err != nil {
+		return false, err
+	}
+	for _, e := range entries[1:] {
+		data, err := d.contentOf(e)
+		if err != nil {
+			return false, err
+		}
+		if !bytes.Equal(first, data) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// contentOf returns the resource of e as yaml in the namespace it is deployed to, without the provenance
+// annotations that tell modules apart
+func (d deployment) contentOf(e indexed) ([]byte, error) {
+	c := e.res.DeepCopy()
+	if err := c.SetAnnotations(withoutProvenance(c.GetAnnotations())); err != nil {
+		return nil, err
+	}
+	if !c.GetGvk().IsClusterScoped() {
+		if err := c.SetNamespace(d.namespaceOf(e.bun, e.res)); err != nil {
+			return nil, err
+		}
+	}
+	return c.AsYAML()
+}
+
+// resourceName returns the resource of e as kind/name, or kind/namespace/name if namespaced
+func resourceName(d deployment, e indexed) string {
+	if e.res.GetGvk().IsClusterScoped() {
+		return fmt.Sprintf("%s/%s", e.res.GetKind(), e.res.GetName())
+	}
+	return fmt.Sprintf("%s/%s/%s", e.res.GetKind(), d.namespaceOf(e.bun, e.res), e.res.GetName())
+}
+
+// moduleNames returns the modules of entries as a list such as a, b and c
+func moduleNames(entries []indexed) string {
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.bun.Module().Name()
+	}
+	if len(names) == 1 {
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
@@ -0,0 +1,121 @@
+package builder
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/middlewaregruppen/banana/pkg/module"
+	"github.com/stretchr/testify/assert"
+)
+
+func clusterRole(verb string) string {
+	return fmt.Sprintf("apiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRole\nmetadata:\n  name: viewer\nrules:\n- apiGroups: ['']\n  resources: [pods]\n  verbs: [%s]\n", verb)
+}
+
+// resourcesOf returns the resources of each module of bundles as kind/name
+func resourcesOf(bundles []*module.Bundle) map[string][]string {
+	result := map[string][]string{}
+	for _, bun := range bundles {
+		result[bun.Module().Name()] = []string{}
+		for _, res := range bun.Resources() {
+			result[bun.Module().Name()] = append(result[bun.Module().Name()], res.GetKind()+"/"+res.GetName())
+		}
+	}
+	return result
+}
+
+func TestResolveConflicts(t *testing.T) {
+	var tests = []struct {
+		name     string
+		strategy types.ConflictStrategy
+		verb     string
+		want     map[string][]string
+		wantErr  string
+	}{
+		{
+			"identical resources merged",
+			types.ConflictMergeIfIdentical, "get",
+			map[string][]string{"monitoring/grafana": {"ClusterRole/viewer", "ConfigMap/config"}, "monitoring/prometheus": {}, "auth/dex": {"ConfigMap/config"}},
+			"",
+		},
+		{
+			"different resources fail to merge",
+			types.ConflictMergeIfIdentical, "list",
+			nil,
+			"ClusterRole/viewer is emitted by modules monitoring/grafana and monitoring/prometheus with different content",
+		},
+		{
+			"first wins",
+			types.ConflictFirstWins, "list",
+			map[string][]string{"monitoring/grafana": {"ClusterRole/viewer", "ConfigMap/config"}, "monitoring/prometheus": {}, "auth/dex": {"ConfigMap/config"}},
+			"",
+		},
+		{
+			"fail",
+			types.ConflictFail, "get",
+			nil,
+			"ClusterRole/viewer is emitted by modules monitoring/grafana and monitoring/prometheus\nConfigMap/monitoring/config is emitted by modules monitoring/grafana and monitoring/prometheus",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := deployment{bundles: []*module.Bundle{
+				bundleOf(t, types.Module{Name: "monitoring/grafana", Namespace: "monitoring"}, clusterRole("get"), configMap),
+				bundleOf(t, types.Module{Name: "monitoring/prometheus", Namespace: "monitoring"}, clusterRole(tt.verb), configMap),
+				// Resources of the same name in another namespace don't conflict
+				bundleOf(t, types.Module{Name: "auth/dex", Namespace: "auth"}, configMap),
+			}}
+			err := d.resolveConflicts(tt.strategy)
+			if len(tt.wantErr) > 0 {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, resourcesOf(d.bundles))
+		})
+	}
+}
+
+func TestResolveConflicts_Cluster(t *testing.T) {
+	shared := bundleOf(t, types.Module{Name: "monitoring/grafana"}, clusterRole("get"))
+	d := deployment{
+		cluster: "dev",
+		shared:  []*module.Bundle{shared},
+		bundles: []*module.Bundle{bundleOf(t, types.Module{Name: "monitoring/prometheus"}, clusterRole("get"), configMap)},
+	}
+	assert.NoError(t, d.resolveConflicts(types.ConflictMergeIfIdentical))
+	assert.Equal(t, map[string][]string{"monitoring/grafana": {"ClusterRole/viewer"}, "monitoring/prometheus": {"ConfigMap/config"}},
+		resourcesOf(append(d.shared, d.bundles...)))
+
+	d.bundles = []*module.Bundle{bundleOf(t, types.Module{Name: "monitoring/prometheus"}, clusterRole("list"))}
+	assert.EqualError(t, d.resolveConflicts(types.ConflictMergeIfIdentical),
+		"cluster dev: ClusterRole/viewer is emitted by modules monitoring/grafana and monitoring/prometheus with different content")
+}
+
+func TestResolveConflicts_MetaData(t *testing.T) {
+	meta := func(prefix, namespace string) []module.BundleOpts {
+		return []module.BundleOpts{module.WithMetaData(&types.ObjectMeta{NamePrefix: prefix, Namespace: namespace})}
+	}
+
+	// Resources renamed or moved apart by metadata don't conflict
+	d := deployment{bundles: []*module.Bundle{
+		bundleWith(t, types.Module{Name: "monitoring/grafana"}, meta("grafana-", "monitoring"), clusterRole("get"), configMap),
+		bundleWith(t, types.Module{Name: "monitoring/prometheus"}, meta("prometheus-", "monitoring"), clusterRole("list"), configMap),
+		bundleWith(t, types.Module{Name: "auth/dex"}, meta("grafana-", "auth"), configMap),
+	}}
+	assert.NoError(t, d.resolveConflicts(types.ConflictFail))
+	assert.Equal(t, map[string][]string{
+		"monitoring/grafana":    {"ClusterRole/grafana-viewer", "ConfigMap/grafana-config"},
+		"monitoring/prometheus": {"ClusterRole/prometheus-viewer", "ConfigMap/prometheus-config"},
+		"auth/dex":              {"ConfigMap/grafana-config"},
+	}, resourcesOf(d.bundles))
+
+	// Resources given the same final name are compared after metadata is applied
+	d = deployment{bundles: []*module.Bundle{
+		bundleWith(t, types.Module{Name: "monitoring/grafana"}, meta("acme-", "monitoring"), clusterRole("get"), configMap),
+		bundleWith(t, types.Module{Name: "monitoring/prometheus", Namespace: "monitoring"}, meta("acme-", ""), clusterRole("list"), configMap),
+	}}
+	assert.EqualError(t, d.resolveConflicts(types.ConflictMergeIfIdentical),
+		"ClusterRole/acme-viewer is emitted by modules monitoring/grafana and monitoring/prometheus with different content")
+}
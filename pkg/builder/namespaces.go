@@ -0,0 +1,213 @@
+package builder
+
+import (
+	"fmt"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/middlewaregruppen/banana/pkg/module"
+)
+
+// deployment is a set of bundles deployed together, either at the top level or to a cluster
+type deployment struct {
+	// cluster is the name of the cluster, empty for the top level
+	cluster string
+
+	// bundles are the bundles built for the deployment, which may be changed
+	bundles []*module.Bundle
+
+	// shared are the bundles built at the top level and deployed along with bundles. They are left as is since
+	// they are deployed to every cluster not overriding them.
+	shared []*module.Bundle
+}
+
+// deployments returns the top level followed by every cluster of r
+func (r *Result) deployments() []deployment {
+	deployments := []deployment{{bundles: r.Bundles}}
+	for _, c := range r.Clusters {
+		d := deployment{cluster: c.Name, bundles: c.Bundles}
+		overridden := map[string]bool{}
+		for _, bun := range c.Bundles {
+			overridden[bun.Module().Name()] = true
+		}
+		for _, bun := range r.Bundles {
+			if !overridden[bun.Module().Name()] && contains(c.Modules, bun.Module().Name()) {
+				d.shared = append(d.shared, bun)
+			}
+		}
+		deployments = append(deployments, d)
+	}
+	return deployments
+}
+
+// errorf returns an error prefixed with the cluster of d, if any
+func (d deployment) errorf(format string, args ...interface{}) error {
+	err := fmt.Errorf(format, args...)
+	if len(d.cluster) > 0 {
+		return fmt.Errorf("cluster %s: %w", d.cluster, err)
+	}
+	return err
+}
+
+// namespaceOf returns the namespace res of bun is deployed to, or its name if it is a Namespace
+func (d deployment) namespaceOf(bun *module.Bundle, res module.Resource) string {
+	switch {
+	case len(bun.Namespace()) > 0:
+		return bun.Namespace()
+	case res.IsNamespace():
+		return res.GetName()
+	}
+	return res.GetNamespace()
+}
+
+// declaration is a Namespace declared by a module
+type declaration struct {
+	bun     *module.Bundle
+	res     module.Resource
+	mutable bool
+}
+
+// ensureNamespaces makes sure exactly one Namespace exists for every namespace resources of d are deployed to.
+// Namespaces declared by several modules are merged into the first one, and Namespaces not declared by any module
+// are added to the first module deployed to them. Labels and annotations of cfg take precedence over those of modules.
+func (d deployment) ensureNamespaces(cfg []types.Namespace) error {
+	var targets []string
+	first := map[string]*module.Bundle{}
+	declared := map[string][]declaration{}
+	visit := func(bundles []*module.Bundle, mutable bool) {
+		for _, bun := range bundles {
+			for _, res := range bun.Resources() {
+				if !res.IsNamespace() && res.GetGvk().IsClusterScoped() {
+					continue
+				}
+				ns := d.namespaceOf(bun, res)
+				if len(ns) == 0 {
+					continue
+				}
+				if _, ok := first[ns]; !ok {
+					targets = append(targets, ns)
+					first[ns] = nil
+				}
+				if mutable && first[ns] == nil {
+					first[ns] = bun
+				}
+				if res.IsNamespace() {
+					declared[ns] = append(declared[ns], declaration{bun: bun, res: res, mutable: mutable})
+				}
+			}
+		}
+	}
+	visit(d.shared, false)
+	visit(d.bundles, true)
+
+	config := map[string]types.Namespace{}
+	for _, ns := range cfg {
+		config[ns.Name] = ns
+	}
+
+	for _, ns := range targets {
+		decls := declared[ns]
+		if len(decls) == 0 {
+			// Namespaces only targeted by shared bundles are ensured at the top level
+			if first[ns] == nil {
+				continue
+			}
+			res, err := module.NewNamespace(ns, config[ns].Labels, config[ns].Annotations)
+			if err != nil {
+				return err
+			}
+			if err := first[ns].AddGeneratedResource(res); err != nil {
+				return err
+			}
+			continue
+		}
+
+		keep := decls[0]
+		labels, annotations := map[string]string{}, map[string]string{}
+		for _, decl := range decls {
+			if err := d.mergeMap(ns, "label", labels, decl.res.GetLabels(), decls[0], decl); err != nil {
+				return err
+			}
+			if err := d.mergeMap(ns, "annotation", annotations, withoutProvenance(decl.res.GetAnnotations()), decls[0], decl); err != nil {
+				return err
+			}
+		}
+		for k, v := range config[ns].Labels {
+			labels[k] = v
+		}
+		for k, v := range config[ns].Annotations {
+			annotations[k] = v
+		}
+		for k, v := range keep.res.GetAnnotations() {
+			if _, ok := annotations[k]; !ok {
+				annotations[k] = v
+			}
+		}
+
+		if keep.mutable {
+			if err := keep.res.SetLabels(labels); err != nil {
+				return err
+			}
+			if err := keep.res.SetAnnotations(annotations); err != nil {
+				return err
+			}
+		} else if !equalMaps(labels, keep.res.GetLabels()) || !equalMaps(annotations, keep.res.GetAnnotations()) {
+			return d.errorf("namespace %s is declared by module %s with labels or annotations that module %s, deployed to every cluster, doesn't set",
+				ns, decls[len(decls)-1].bun.Module().Name(), keep.bun.Module().Name())
+		}
+
+		// Shared bundles are deduplicated when the top level is
+		for _, decl := range decls[1:] {
+			if decl.mutable {
+				decl.bun.RemoveResource(decl.res)
+			}
+		}
+	}
+	return nil
+}
+
+// mergeMap merges m of the Namespace declared by decl into merged. Values conflicting with those merged so far fail.
+func (d deployment) mergeMap(ns, what string, merged, m map[string]string, first, decl declaration) error {
+	for k, v := range m {
+		if prev, ok := merged[k]; ok && prev != v {
+			return d.errorf("namespace %s: %s %s is %q in module %s but %q in module %s",
+				ns, what, k, prev, first.bun.Module().Name(), v, decl.bun.Module().Name())
+		}
+		merged[k] = v
+	}
+	return nil
+}
+
+// withoutProvenance returns annotations without those recording the provenance of a resource
+func withoutProvenance(annotations map[string]string) map[string]string {
+	result := map[string]string{}
+	for k, v := range annotations {
+		switch k {
+		case module.AnnotationBananaVersion, module.AnnotationModule, module.AnnotationModuleVersion,
+			module.AnnotationSource, module.AnnotationCommit, module.AnnotationComponents, module.AnnotationBuildTime:
+			continue
+		}
+		result[k] = v
+	}
+	return result
+}
+
+func equalMaps(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package builder
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/middlewaregruppen/banana/pkg/module"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+// bundleOf returns a bundle of the module m holding the given resources
+func bundleOf(t *testing.T, m types.Module, docs ...string) *module.Bundle {
+	return bundleWith(t, m, nil, docs...)
+}
+
+// bundleWith returns a bundle of the module m holding the given resources, built with opts
+func bundleWith(t *testing.T, m types.Module, opts []module.BundleOpts, docs ...string) *module.Bundle {
+	fs := filesys.MakeFsInMemory()
+	kust := "resources:\n"
+	for i, doc := range docs {
+		name := fmt.Sprintf("res-%d.yaml", i)
+		kust += "- " + name + "\n"
+		assert.NoError(t, fs.WriteFile(m.Name+"/"+name, []byte(doc)))
+	}
+	assert.NoError(t, fs.WriteFile(m.Name+"/kustomization.yaml", []byte(kust)))
+	b, err := module.NewKustomizeModule(fs, m, "").Bundle(append([]module.BundleOpts{module.WithProvenance(module.Provenance{})}, opts...)...)
+	assert.NoError(t, err)
+	return b
+}
+
+func namespace(name string, labels string) string {
+	return fmt.Sprintf("apiVersion: v1\nkind: Namespace\nmetadata:\n  name: %s\n  labels: {%s}\n", name, labels)
+}
+
+const configMap = "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n"
+
+// namespaces returns the Namespaces of each bundle as name and labels
+func namespaces(bundles []*module.Bundle) map[string][]string {
+	result := map[string][]string{}
+	for _, bun := range bundles {
+		for _, res := range bun.Resources() {
+			if res.IsNamespace() {
+				result[bun.Module().Name()] = append(result[bun.Module().Name()], fmt.Sprintf("%s %v", res.GetName(), res.GetLabels()))
+			}
+		}
+	}
+	return result
+}
+
+func TestEnsureNamespaces(t *testing.T) {
+	r := &Result{
+		Bundles: []*module.Bundle{
+			bundleOf(t, types.Module{Name: "ingress/nginx", Namespace: "ingress-nginx"}, namespace("ingress-nginx", "app: nginx"), configMap),
+			bundleOf(t, types.Module{Name: "ingress/extras", Namespace: "ingress-nginx"}, namespace("ingress-nginx", "tier: edge"), configMap),
+			bundleOf(t, types.Module{Name: "auth/dex", Namespace: "auth"}, configMap),
+		},
+	}
+	r.Clusters = []*ClusterResult{
+		{
+			Name:    "dev",
+			Modules: []string{"ingress/nginx", "ingress/extras", "auth/dex"},
+			Bundles: []*module.Bundle{bundleOf(t, types.Module{Name: "auth/dex", Namespace: "dev-auth"}, configMap)},
+		},
+	}
+	cfg := []types.Namespace{{Name: "ingress-nginx", Labels: map[string]string{"pod-security.kubernetes.io/enforce": "baseline"}}}
+
+	for _, d := range r.deployments() {
+		assert.NoError(t, d.ensureNamespaces(cfg))
+	}
+	assert.Equal(t, map[string][]string{
+		"ingress/nginx": {"ingress-nginx map[app:nginx pod-security.kubernetes.io/enforce:baseline tier:edge]"},
+		"auth/dex":      {"auth map[]"},
+	}, namespaces(r.Bundles))
+	assert.Equal(t, map[string][]string{
+		"auth/dex": {"dev-auth map[]"},
+	}, namespaces(r.Clusters[0].Bundles))
+
+	// Ensuring again changes nothing
+	for _, d := range r.deployments() {
+		assert.NoError(t, d.ensureNamespaces(cfg))
+	}
+	assert.Len(t, namespaces(r.Bundles), 2)
+}
+
+func TestEnsureNamespaces_Conflict(t *testing.T) {
+	d := deployment{bundles: []*module.Bundle{
+		bundleOf(t, types.Module{Name: "ingress/nginx"}, namespace("ingress", "tier: edge")),
+		bundleOf(t, types.Module{Name: "ingress/extras"}, namespace("ingress", "tier: internal")),
+	}}
+	assert.EqualError(t, d.ensureNamespaces(nil), `namespace ingress: label tier is "edge" in module ingress/nginx but "internal" in module ingress/extras`)
+
+	// Labels set by a cluster can't be added to a Namespace deployed to every cluster
+	d = deployment{
+		cluster: "dev",
+		shared:  []*module.Bundle{bundleOf(t, types.Module{Name: "ingress/nginx"}, namespace("ingress", "tier: edge"))},
+		bundles: []*module.Bundle{bundleOf(t, types.Module{Name: "ingress/extras"}, namespace("ingress", "team: web"))},
+	}
+	assert.EqualError(t, d.ensureNamespaces(nil), "cluster dev: namespace ingress is declared by module ingress/extras with labels or annotations that module ingress/nginx, deployed to every cluster, doesn't set")
+}
+
+func TestEnsureNamespaces_ClusterMetaData(t *testing.T) {
+	meta := &types.ObjectMeta{Namespace: "dev"}
+	nginx := types.Module{Name: "ingress/nginx", Namespace: "ingress-nginx"}
+	extras := types.Module{Name: "ingress/extras", Namespace: "ingress-nginx"}
+	extrasConfig := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: extras\n"
+	r := &Result{
+		Bundles: []*module.Bundle{
+			bundleOf(t, nginx, namespace("ingress-nginx", "app: nginx"), configMap),
+			bundleOf(t, extras, namespace("ingress-nginx", "tier: edge"), extrasConfig),
+		},
+		Clusters: []*ClusterResult{{
+			Name:     "dev",
+			MetaData: meta,
+			Modules:  []string{"ingress/nginx", "ingress/extras"},
+			Bundles: []*module.Bundle{
+				bundleWith(t, nginx, []module.BundleOpts{module.WithClusterMetaData(meta)}, namespace("ingress-nginx", "app: nginx"), configMap),
+				bundleWith(t, extras, []module.BundleOpts{module.WithClusterMetaData(meta)}, namespace("ingress-nginx", "tier: edge"), extrasConfig),
+			},
+		}},
+	}
+	for _, d := range r.deployments() {
+		assert.NoError(t, d.ensureNamespaces(nil))
+	}
+	assert.Equal(t, map[string][]string{
+		"ingress/nginx": {"dev map[app:nginx tier:edge]"},
+	}, namespaces(r.Clusters[0].Bundles))
+
+	// The root of the cluster builds with a single Namespace
+	fs := filesys.MakeFsInMemory()
+	_, err := r.Export(fs, "src")
+	assert.NoError(t, err)
+	rm, err := krusty.MakeKustomizer(module.DefaultKustomizerOptions).Run(fs, "src/clusters/dev")
+	if !assert.NoError(t, err) {
+		return
+	}
+	var ids []string
+	for _, res := range rm.Resources() {
+		ids = append(ids, res.GetKind()+" "+res.GetNamespace()+"/"+res.GetName())
+	}
+	assert.ElementsMatch(t, []string{"Namespace /dev", "ConfigMap dev/config", "ConfigMap dev/extras"}, ids)
+}
@@ -0,0 +1,260 @@
+package catalog
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/middlewaregruppen/banana/pkg/git"
+	"golang.org/x/mod/semver"
+	ktypes "sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const (
+	// IndexFile is the name of the catalog index file at the root of a module repository. If present it is
+	// read instead of discovering modules by walking the repository.
+	IndexFile = "catalog.yaml"
+
+	// MetadataFile is the name of the file in a module directory describing the module
+	MetadataFile = "banana-module.yaml"
+)
+
+// Module describes a module available in a module repository
+type Module struct {
+	// Name is the name of the module, which is its path in the repository. For example ingress/nginx
+	Name string `json:"name" yaml:"name"`
+
+	// Description is a short description of the module, read from its metadata file
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+
+	// Components is a list of components of the module, relative to the module path
+	Components []string `json:"components,omitempty" yaml:"components,omitempty"`
+
+	// Options is a list of options accepted by the module, read from its metadata file
+	Options []types.ModuleOption `json:"options,omitempty" yaml:"options,omitempty"`
+
+	// Secrets is a list of secrets expected by the module, read from its metadata file
+	Secrets []types.ModuleSecret `json:"secrets,omitempty" yaml:"secrets,omitempty"`
+
+	// Dependencies is a list of modules the module depends on, read from its metadata file
+	Dependencies []types.ModuleDependency `json:"dependencies,omitempty" yaml:"dependencies,omitempty"`
+}
+
+// Catalog is a list of modules available in a module repository
+type Catalog struct {
+	// Versions is a list of tags of the module repository, newest first. Modules are versioned
+	// together so each of them may be used as the version of any module.
+	Versions []string `json:"versions,omitempty" yaml:"versions,omitempty"`
+
+	Modules []Module `json:"modules" yaml:"modules"`
+}
+
+// Get returns the module with the given name, or nil if not found
+func (c *Catalog) Get(name string) *Module {
+	for i := range c.Modules {
+		if c.Modules[i].Name == name {
+			return &c.Modules[i]
+		}
+	}
+	return nil
+}
+
+// Search returns the modules whose name, description or components contain query, ignoring case
+func (c *Catalog) Search(query string) []Module {
+	query = strings.ToLower(query)
+	var result []Module
+	for _, m := range c.Modules {
+		fields := append([]string{m.Name, m.Description}, m.Components...)
+		for _, f := range fields {
+			if strings.Contains(strings.ToLower(f), query) {
+				result = append(result, m)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// Example returns a module entry of the banana file using m at the given version, with every component,
+// option and secret of m declared
+func (m *Module) Example(version string) types.Module {
+	mod := types.Module{
+		Name:    m.Name,
+		Version: version,
+	}
+	for _, c := range m.Components {
+		mod.Components = append(mod.Components, types.Component{Name: c})
+	}
+	for _, o := range m.Options {
+		if mod.Opts == nil {
+			mod.Opts = types.ModuleOpts{}
+		}
+		mod.Opts[o.Name] = o.Default
+	}
+	for _, s := range m.Secrets {
+		mod.Secrets = append(mod.Secrets, types.Secret{Key: s.Key})
+	}
+	return mod
+}
+
+// Fetch clones the module repository at url into memory and returns the catalog of its modules along
+// with the tags of the repository. The tag named by version is used, or HEAD if version is empty.
+func Fetch(url, version string) (*Catalog, error) {
+	fs := filesys.MakeFsInMemory()
+	if err := git.NewURLCloner(url, version).Clone(fs); err != nil {
+		return nil, err
+	}
+	c, err := Load(fs, ".")
+	if err != nil {
+		return nil, err
+	}
+	tags, err := git.ListTags(url)
+	if err != nil {
+		return nil, err
+	}
+	c.Versions = sortVersions(tags)
+	return c, nil
+}
+
+// Load returns the catalog of the module repository at root. The index file is read if present,
+// otherwise modules are discovered by walking the repository.
+func Load(fs filesys.FileSystem, root string) (*Catalog, error) {
+	p := path.Join(root, IndexFile)
+	if !fs.Exists(p) {
+		return Discover(fs, root)
+	}
+	data, err := fs.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	c := &Catalog{}
+	if err := kyaml.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("unable to read catalog index %s: %w", p, err)
+	}
+	sort.Slice(c.Modules, func(i, j int) bool { return c.Modules[i].Name < c.Modules[j].Name })
+	return c, nil
+}
+
+// Discover walks fs from root and returns a catalog of every module found. A module is a directory holding
+// a kustomization that is not nested within another module. Components are directories within a module
+// holding a kustomization of kind Component.
+func Discover(fs filesys.FileSystem, root string) (*Catalog, error) {
+	c := &Catalog{}
+	var current *Module
+	var currentDir string
+
+	err := fs.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if strings.HasPrefix(info.Name(), ".") && p != root {
+			return filepath.SkipDir
+		}
+		kind, ok, err := kustomizationKind(fs, p)
+		if err != nil || !ok {
+			return err
+		}
+		rel := relPath(root, p)
+		if current != nil && strings.HasPrefix(rel, currentDir+"/") {
+			if kind == ktypes.ComponentKind {
+				current.Components = append(current.Components, strings.TrimPrefix(rel, currentDir+"/"))
+			}
+			return nil
+		}
+		if kind == ktypes.ComponentKind || len(rel) == 0 {
+			return nil
+		}
+		meta, err := ReadMetadata(fs, p)
+		if err != nil {
+			return err
+		}
+		c.Modules = append(c.Modules, Module{
+			Name:         rel,
+			Description:  meta.Description,
+			Options:      meta.Options,
+			Secrets:      meta.Secrets,
+			Dependencies: meta.Dependencies,
+		})
+		current, currentDir = &c.Modules[len(c.Modules)-1], rel
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(c.Modules, func(i, j int) bool { return c.Modules[i].Name < c.Modules[j].Name })
+	return c, nil
+}
+
+// kustomizationKind returns the kind of the kustomization in dir. Returns false if dir holds no kustomization.
+func kustomizationKind(fs filesys.FileSystem, dir string) (string, bool, error) {
+	for _, name := range []string{"kustomization.yaml", "kustomization.yml", "Kustomization"} {
+		p := path.Join(dir, name)
+		if !fs.Exists(p) {
+			continue
+		}
+		data, err := fs.ReadFile(p)
+		if err != nil {
+			return "", false, err
+		}
+		var meta ktypes.TypeMeta
+		if err := kyaml.Unmarshal(data, &meta); err != nil {
+			return "", false, err
+		}
+		if len(meta.Kind) == 0 {
+			meta.Kind = ktypes.KustomizationKind
+		}
+		return meta.Kind, true, nil
+	}
+	return "", false, nil
+}
+
+// ReadMetadata reads the metadata file in dir. Returns empty metadata if there is none.
+func ReadMetadata(fs filesys.FileSystem, dir string) (*types.ModuleMetadata, error) {
+	meta := &types.ModuleMetadata{}
+	p := path.Join(dir, MetadataFile)
+	if !fs.Exists(p) {
+		return meta, nil
+	}
+	data, err := fs.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	if err := kyaml.Unmarshal(data, meta); err != nil {
+		return nil, fmt.Errorf("unable to read module metadata %s: %w", p, err)
+	}
+	return meta, nil
+}
+
+// sortVersions sorts tags newest first. Tags that are not semantic versions are sorted last by name.
+func sortVersions(tags []string) []string {
+	sort.SliceStable(tags, func(i, j int) bool {
+		vi, vj := semver.IsValid(tags[i]), semver.IsValid(tags[j])
+		if vi && vj {
+			return semver.Compare(tags[i], tags[j]) > 0
+		}
+		if vi != vj {
+			return vi
+		}
+		return tags[i] < tags[j]
+	})
+	return tags
+}
+
+// relPath returns p relative to root. Paths walked on an in-memory filesystem are absolute even if root is not.
+func relPath(root, p string) string {
+	root = strings.TrimPrefix(path.Clean(root), "/")
+	p = strings.TrimPrefix(path.Clean(p), "/")
+	if root == "." {
+		return p
+	}
+	return strings.Trim(strings.TrimPrefix(p, root), "/")
+}
@@ -0,0 +1,77 @@
+package catalog
+
+import (
+	"testing"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+func TestDiscover(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"ingress/nginx/kustomization.yaml":            "resources:\n- deployment.yaml\n",
+		"ingress/nginx/banana-module.yaml":            "kind: BananaModule\napiVersion: banana.io/v1beta1\ndescription: NGINX ingress controller\n",
+		"ingress/nginx/tls/kustomization.yaml":        "apiVersion: kustomize.config.k8s.io/v1alpha1\nkind: Component\n",
+		"auth/dex/kustomization.yaml":                 "apiVersion: kustomize.config.k8s.io/v1beta1\nkind: Kustomization\n",
+		"auth/dex/base/kustomization.yaml":            "resources: []\n",
+		"auth/dex/components/ldap/kustomization.yaml": "kind: Component\n",
+		".github/kustomization.yaml":                  "resources: []\n",
+		"README.md":                                   "# modules\n",
+	}
+	for p, data := range files {
+		assert.NoError(t, fs.WriteFile(p, []byte(data)))
+	}
+
+	c, err := Discover(fs, ".")
+	assert.NoError(t, err)
+	assert.Equal(t, []Module{
+		{Name: "auth/dex", Components: []string{"components/ldap"}},
+		{Name: "ingress/nginx", Description: "NGINX ingress controller", Components: []string{"tls"}},
+	}, c.Modules)
+	assert.Equal(t, "ingress/nginx", c.Get("ingress/nginx").Name)
+	assert.Nil(t, c.Get("monitoring/grafana"))
+}
+
+func TestLoadIndex(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	index := `modules:
+- name: monitoring/grafana
+  description: Grafana dashboards
+  components:
+  - loki
+  options:
+  - name: replicas
+    default: "1"
+  secrets:
+  - key: ADMIN_PASSWORD
+    required: true
+- name: auth/dex
+`
+	assert.NoError(t, fs.WriteFile(IndexFile, []byte(index)))
+	// Modules in the repository are ignored when an index is present
+	assert.NoError(t, fs.WriteFile("ingress/nginx/kustomization.yaml", []byte("resources: []\n")))
+
+	c, err := Load(fs, ".")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"auth/dex", "monitoring/grafana"}, []string{c.Modules[0].Name, c.Modules[1].Name})
+
+	assert.Equal(t, []Module{c.Modules[1]}, c.Search("LOKI"))
+	assert.Equal(t, []Module{c.Modules[1]}, c.Search("dashboards"))
+	assert.Empty(t, c.Search("nginx"))
+
+	assert.Equal(t, types.Module{
+		Name:       "monitoring/grafana",
+		Version:    "v1.0.0",
+		Opts:       types.ModuleOpts{"replicas": "1"},
+		Components: []types.Component{{Name: "loki"}},
+		Secrets:    []types.Secret{{Key: "ADMIN_PASSWORD"}},
+	}, c.Get("monitoring/grafana").Example("v1.0.0"))
+}
+
+func TestSortVersions(t *testing.T) {
+	assert.Equal(t,
+		[]string{"v1.10.0", "v1.2.0", "v1.2.0-rc.1", "latest", "stable"},
+		sortVersions([]string{"stable", "v1.2.0-rc.1", "v1.10.0", "latest", "v1.2.0"}))
+}
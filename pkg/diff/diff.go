@@ -0,0 +1,388 @@
+// Package diff compares the resources of two builds, resource by resource rather than file by file
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/getsops/sops/v3/cmd/sops/formats"
+	"github.com/getsops/sops/v3/decrypt"
+	"github.com/middlewaregruppen/banana/pkg/builder"
+	"github.com/middlewaregruppen/banana/pkg/module"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/kio"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const (
+	redacted        = "<redacted>"
+	redactedChanged = "<redacted, changed>"
+	encrypted       = "<encrypted>"
+)
+
+// ResourceID identifies a resource across builds
+type ResourceID struct {
+	// Tree is the directory of the root the resource is exported below, relative to the export
+	// directory. Empty for modules exported at the top level, otherwise clusters/<name>.
+	Tree string `json:"tree,omitempty"`
+
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+}
+
+func (id ResourceID) String() string {
+	s := fmt.Sprintf("%s/%s %s/%s", id.APIVersion, id.Kind, id.Namespace, id.Name)
+	if len(id.Namespace) == 0 {
+		s = fmt.Sprintf("%s/%s %s", id.APIVersion, id.Kind, id.Name)
+	}
+	if len(id.Tree) > 0 {
+		s = id.Tree + ": " + s
+	}
+	return s
+}
+
+func (id ResourceID) isSecret() bool {
+	return id.APIVersion == "v1" && id.Kind == "Secret"
+}
+
+// Action is the kind of change made to a resource
+type Action string
+
+const (
+	Added   Action = "added"
+	Removed Action = "removed"
+	Changed Action = "changed"
+)
+
+// Change is a resource that differs between two builds
+type Change struct {
+	ResourceID
+	Action Action `json:"action"`
+
+	// Diff is a unified diff of the resource with the values of Secrets redacted
+	Diff string `json:"-"`
+}
+
+// resource is a resource of a build
+type resource struct {
+	node *kyaml.RNode
+
+	// sealed is true if the resource was read encrypted and could not be decrypted
+	sealed bool
+}
+
+func (r *resource) copy() *resource {
+	if r == nil {
+		return nil
+	}
+	return &resource{node: r.node.Copy(), sealed: r.sealed}
+}
+
+// Resources is the resources of a build keyed by their id
+type Resources map[ResourceID]*resource
+
+func (r Resources) add(tree string, n *kyaml.RNode, sealed bool) error {
+	meta, err := n.GetMeta()
+	if err != nil {
+		return err
+	}
+	if len(meta.Kind) == 0 || len(meta.APIVersion) == 0 {
+		return nil
+	}
+	id := ResourceID{tree, meta.APIVersion, meta.Kind, meta.Namespace, meta.Name}
+	r[id] = &resource{node: n, sealed: sealed}
+	return nil
+}
+
+// FromResult returns the resources of every module and cluster of the build result
+func FromResult(result *builder.Result) (Resources, error) {
+	r := Resources{}
+	if err := r.addBundles("", result.Bundles); err != nil {
+		return nil, err
+	}
+	for _, c := range result.Clusters {
+		if err := r.addBundles(path.Join(builder.ClustersDir, c.Name), c.Bundles); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// FromBundles returns the resources of the bundles before any encryption applied on export
+func FromBundles(bundles []*module.Bundle) (Resources, error) {
+	r := Resources{}
+	return r, r.addBundles("", bundles)
+}
+
+func (r Resources) addBundles(tree string, bundles []*module.Bundle) error {
+	for _, b := range bundles {
+		for _, res := range b.Resources() {
+			d, err := res.Flatten()
+			if err != nil {
+				return err
+			}
+			n, err := kyaml.Parse(string(d))
+			if err != nil {
+				return err
+			}
+			if err := r.add(tree, n, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ReadDir returns the resources of every yaml file below dir on fs, ignoring kustomization and hidden files.
+// Resources below clusters/<name> are part of the tree of that cluster.
+// Files encrypted with sops are decrypted when a key is available, otherwise values of encrypted
+// resources are not compared.
+func ReadDir(fs filesys.FileSystem, dir string) (Resources, error) {
+	r := Resources{}
+	if !fs.Exists(dir) {
+		return r, nil
+	}
+	err := fs.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		ext, base := path.Ext(p), path.Base(p)
+		if (ext != ".yaml" && ext != ".yml") || strings.HasPrefix(base, "kustomization.") || strings.HasPrefix(base, ".") {
+			return nil
+		}
+		parts := strings.Split(relPath(dir, p), "/")
+		if deploysModules(parts) {
+			return nil
+		}
+		data, err := fs.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		sealed := false
+		if bytes.Contains(data, []byte("\nsops:")) {
+			plain, err := decrypt.DataWithFormat(data, formats.Yaml)
+			if err != nil {
+				logrus.Warnf("unable to decrypt %s, changes to its encrypted values are not shown: %s", p, err)
+				sealed = true
+			} else {
+				data = plain
+			}
+		}
+
+		tree := ""
+		if len(parts) > 2 && parts[0] == builder.ClustersDir {
+			tree = path.Join(parts[0], parts[1])
+		}
+
+		nodes, err := kio.FromBytes(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		for _, n := range nodes {
+			if err := n.PipeE(kyaml.Clear("sops")); err != nil {
+				return err
+			}
+			if err := r.add(tree, n, sealed); err != nil {
+				return fmt.Errorf("%s: %w", p, err)
+			}
+		}
+		return nil
+	})
+	return r, err
+}
+
+// Compare returns the resources added, removed or changed in new compared to old, sorted by id.
+// Values of Secrets are never revealed, they are shown as changed or not.
+func Compare(old, new Resources) ([]Change, error) {
+	ids := map[ResourceID]bool{}
+	for id := range old {
+		ids[id] = true
+	}
+	for id := range new {
+		ids[id] = true
+	}
+
+	var changes []Change
+	for id := range ids {
+		o, n := old[id], new[id]
+		if id.isSecret() {
+			o, n = o.copy(), n.copy()
+			if err := redact(o, n); err != nil {
+				return nil, err
+			}
+		}
+		a, err := normalize(o)
+		if err != nil {
+			return nil, err
+		}
+		b, err := normalize(n)
+		if err != nil {
+			return nil, err
+		}
+		if a == b {
+			continue
+		}
+
+		c := Change{ResourceID: id, Action: Changed}
+		switch {
+		case o == nil:
+			c.Action = Added
+		case n == nil:
+			c.Action = Removed
+		}
+		c.Diff, err = difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        lines(a),
+			B:        lines(b),
+			FromFile: "a/" + id.String(),
+			ToFile:   "b/" + id.String(),
+			Context:  3,
+		})
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].String() < changes[j].String() })
+	return changes, nil
+}
+
+// redact replaces the values of the Secrets old and new, either of which may be nil, so that only
+// whether a value changed is shown
+func redact(old, new *resource) error {
+	values := func(r *resource) (map[string]*kyaml.Node, error) {
+		v := map[string]*kyaml.Node{}
+		if r == nil {
+			return v, nil
+		}
+		for _, field := range []string{"data", "stringData"} {
+			m, err := r.node.Pipe(kyaml.Lookup(field))
+			if err != nil {
+				return nil, err
+			}
+			if m == nil {
+				continue
+			}
+			err = m.VisitFields(func(f *kyaml.MapNode) error {
+				v[field+"."+f.Key.YNode().Value] = f.Value.YNode()
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		return v, nil
+	}
+	o, err := values(old)
+	if err != nil {
+		return err
+	}
+	n, err := values(new)
+	if err != nil {
+		return err
+	}
+
+	sealed := old != nil && old.sealed
+	for k, nv := range n {
+		ov, ok := o[k]
+		switch {
+		case sealed:
+			nv.Value = encrypted
+		case ok && ov.Value != nv.Value:
+			nv.Value = redactedChanged
+		default:
+			nv.Value = redacted
+		}
+	}
+	for _, ov := range o {
+		ov.Value = redacted
+		if sealed {
+			ov.Value = encrypted
+		}
+	}
+	return nil
+}
+
+// normalize encodes the resource with sorted keys and without comments, or returns an empty string if r is nil.
+// The time of the build and the values of SealedSecrets are left out since they differ between every build, values
+// are sealed with a random session key.
+func normalize(r *resource) (string, error) {
+	if r == nil {
+		return "", nil
+	}
+	var v interface{}
+	if err := r.node.YNode().Decode(&v); err != nil {
+		return "", err
+	}
+	if r.node.GetApiVersion() == "bitnami.com/v1alpha1" && r.node.GetKind() == "SealedSecret" {
+		if spec, ok := lookupMap(v, "spec"); ok {
+			if data, ok := lookupMap(spec, "encryptedData"); ok {
+				for k := range data {
+					data[k] = encrypted
+				}
+			}
+		}
+	}
+	if meta, ok := lookupMap(v, "metadata"); ok {
+		if annotations, ok := lookupMap(meta, "annotations"); ok {
+			delete(annotations, module.AnnotationBuildTime)
+			if len(annotations) == 0 {
+				delete(meta, "annotations")
+			}
+		}
+	}
+	out, err := kyaml.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// lookupMap returns the mapping at key of v if v is a mapping
+func lookupMap(v interface{}, key string) (map[string]interface{}, bool) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	result, ok := m[key].(map[string]interface{})
+	return result, ok
+}
+
+// relPath returns p relative to dir. Paths walked on an in-memory filesystem are absolute even if dir is not.
+func relPath(dir, p string) string {
+	dir = strings.TrimPrefix(path.Clean(dir), "/")
+	p = strings.TrimPrefix(path.Clean(p), "/")
+	if dir == "." {
+		return p
+	}
+	return strings.Trim(strings.TrimPrefix(p, dir), "/")
+}
+
+// lines splits s into lines, each ending with a newline
+func lines(s string) []string {
+	l := strings.SplitAfter(s, "\n")
+	if len(l) > 0 && len(l[len(l)-1]) == 0 {
+		l = l[:len(l)-1]
+	}
+	return l
+}
+
+// deploysModules returns true if the file at parts, relative to the export directory, is generated to deploy the
+// modules of the export rather than built from them, such as Argo CD Applications and Flux Kustomizations. Such files
+// are not compared.
+func deploysModules(parts []string) bool {
+	for _, part := range parts[:len(parts)-1] {
+		if part == builder.ArgoCDDir || part == builder.FluxDir {
+			return true
+		}
+	}
+	return false
+}
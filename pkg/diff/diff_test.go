@@ -0,0 +1,198 @@
+package diff
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/middlewaregruppen/banana/pkg/builder"
+	"github.com/middlewaregruppen/banana/pkg/module"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+var moduleFiles = map[string]string{
+	"test/app/kustomization.yaml": `resources:
+- secret.yaml
+- configmap.yaml
+`,
+	"test/app/secret.yaml": `apiVersion: v1
+kind: Secret
+metadata:
+  name: app
+data:
+  USERNAME: YWRtaW4=
+  PASSWORD: Q0hBTkdFX01F
+`,
+	"test/app/configmap.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+data:
+  LOG_LEVEL: info
+`,
+}
+
+func bundle(t *testing.T, mod types.Module, opts ...module.BundleOpts) *module.Bundle {
+	fs := filesys.MakeFsInMemory()
+	for p, data := range moduleFiles {
+		assert.NoError(t, fs.WriteFile(p, []byte(data)))
+	}
+	m := module.NewKustomizeModule(fs, mod, "")
+	b, err := m.Bundle(append([]module.BundleOpts{module.WithSecrets(m.Secrets())}, opts...)...)
+	assert.NoError(t, err)
+	return b
+}
+
+func TestCompare(t *testing.T) {
+	old, err := FromBundles([]*module.Bundle{bundle(t, types.Module{Name: "test/app", Namespace: "apps"})})
+	assert.NoError(t, err)
+
+	changes, err := Compare(old, old)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+
+	new, err := FromBundles([]*module.Bundle{bundle(t, types.Module{
+		Name:      "test/app",
+		Namespace: "other",
+		Secrets:   []types.Secret{{Key: "PASSWORD", Value: "password"}},
+	})})
+	assert.NoError(t, err)
+
+	changes, err = Compare(old, new)
+	assert.NoError(t, err)
+	var summary []string
+	for _, c := range changes {
+		summary = append(summary, string(c.Action)+" "+c.String())
+	}
+	assert.Equal(t, []string{
+		"removed v1/ConfigMap apps/app",
+		"added v1/ConfigMap other/app",
+		"removed v1/Secret apps/app",
+		"added v1/Secret other/app",
+	}, summary)
+
+	// Values of secrets are never shown
+	for _, c := range changes {
+		assert.NotContains(t, c.Diff, "cGFzc3dvcmQ=")
+		assert.NotContains(t, c.Diff, "Q0hBTkdFX01F")
+	}
+
+	new, err = FromBundles([]*module.Bundle{bundle(t, types.Module{
+		Name:      "test/app",
+		Namespace: "apps",
+		Secrets:   []types.Secret{{Key: "PASSWORD", Value: "password"}},
+	})})
+	assert.NoError(t, err)
+	changes, err = Compare(old, new)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 1)
+	assert.Equal(t, Changed, changes[0].Action)
+	assert.Contains(t, changes[0].Diff, "-  PASSWORD: <redacted>\n+  PASSWORD: <redacted, changed>\n")
+	assert.Contains(t, changes[0].Diff, "   USERNAME: <redacted>\n")
+}
+
+func TestReadDirEncrypted(t *testing.T) {
+	id, err := age.GenerateX25519Identity()
+	assert.NoError(t, err)
+
+	mod := types.Module{
+		Name:      "test/app",
+		Namespace: "apps",
+		Secrets:   []types.Secret{{Key: "PASSWORD", Value: "password"}},
+	}
+	b := bundle(t, mod, module.WithAgeRecipients([]string{id.Recipient().String()}))
+	outfs := filesys.MakeFsInMemory()
+	assert.NoError(t, b.Export(outfs, module.WithExportRootDir("src")))
+	current, err := FromBundles([]*module.Bundle{b})
+	assert.NoError(t, err)
+
+	// Decrypted values are compared, ignoring sops metadata
+	t.Setenv("SOPS_AGE_KEY", id.String())
+	exported, err := ReadDir(outfs, "src")
+	assert.NoError(t, err)
+	assert.Len(t, exported, 2)
+	changes, err := Compare(exported, current)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+
+	mod.Secrets[0].Value = "changed"
+	changed, err := FromBundles([]*module.Bundle{bundle(t, mod)})
+	assert.NoError(t, err)
+	changes, err = Compare(exported, changed)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 1)
+	assert.Contains(t, changes[0].Diff, "+  PASSWORD: <redacted, changed>\n")
+
+	// Without a key values are not compared
+	t.Setenv("SOPS_AGE_KEY", "")
+	exported, err = ReadDir(outfs, "src")
+	assert.NoError(t, err)
+	changes, err = Compare(exported, changed)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestCompareSealedSecrets(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sealed-secret"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+	certfs := filesys.MakeFsInMemory()
+	assert.NoError(t, certfs.WriteFile("cert.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})))
+
+	mod := types.Module{Name: "test/app", Namespace: "apps"}
+	sealed := func() Resources {
+		r, err := FromBundles([]*module.Bundle{bundle(t, mod, module.WithSealedSecrets(certfs, "cert.pem", module.SealedSecretScopeStrict))})
+		assert.NoError(t, err)
+		return r
+	}
+
+	// Values are sealed with a new session key on every build
+	changes, err := Compare(sealed(), sealed())
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestReadDirExport(t *testing.T) {
+	var tests = []struct {
+		name string
+		r    *builder.Result
+	}{
+		{"modules", &builder.Result{}},
+		{"argocd", &builder.Result{ArgoCD: &types.ArgoCD{RepoURL: "https://github.com/example/deploy.git"}}},
+		{"flux", &builder.Result{Flux: &types.Flux{SourceRef: &types.FluxSourceRef{Name: "deploy"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.r.Bundles = []*module.Bundle{bundle(t, types.Module{Name: "test/app", Namespace: "apps"})}
+			tt.r.Clusters = []*builder.ClusterResult{{Name: "dev", Modules: []string{"test/app"}}}
+			fs := filesys.MakeFsInMemory()
+			_, err := tt.r.Export(fs, "src")
+			assert.NoError(t, err)
+
+			// A clean build shows no changes
+			exported, err := ReadDir(fs, "src")
+			assert.NoError(t, err)
+			current, err := FromResult(tt.r)
+			assert.NoError(t, err)
+			changes, err := Compare(exported, current)
+			assert.NoError(t, err)
+			assert.Empty(t, changes)
+		})
+	}
+}
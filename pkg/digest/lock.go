@@ -0,0 +1,97 @@
+package digest
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// LockFile is the name of the lock file, next to the banana file
+const LockFile = "banana.lock"
+
+// lockHeader is written at the top of every lock file
+const lockHeader = "# Digests of the images built by banana. Generated by banana build, do not edit.\n"
+
+// Lock records the digest each image resolved to
+type Lock struct {
+	// Images maps images, as referenced by resources, to the digest of their manifest
+	Images map[string]string `json:"images,omitempty" yaml:"images,omitempty"`
+}
+
+// ReadLock reads the lock file at path from fs. An empty lock is returned if the file doesn't exist.
+func ReadLock(fs filesys.FileSystem, path string) (*Lock, error) {
+	l := &Lock{Images: map[string]string{}}
+	if !fs.Exists(path) {
+		return l, nil
+	}
+	data, err := fs.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := kyaml.Unmarshal(data, l); err != nil {
+		return nil, fmt.Errorf("unable to read lock file %s: %w", path, err)
+	}
+	if l.Images == nil {
+		l.Images = map[string]string{}
+	}
+	return l, nil
+}
+
+// Write writes the lock to path on fs. Images are sorted so that the file only changes when digests do.
+func (l *Lock) Write(fs filesys.FileSystem, path string) error {
+	data, err := kyaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+	return fs.WriteFile(path, append([]byte(lockHeader), data...))
+}
+
+// Pinner resolves images to digests, preferring those recorded in a lock file
+type Pinner struct {
+	lock     *Lock
+	resolver *Resolver
+	update   bool
+
+	// resolved holds the digest of every image pinned
+	resolved map[string]string
+}
+
+// NewPinner returns a pinner looking up digests in lock. Images missing from the lock are resolved using resolver,
+// or fail if it is nil. Every image is resolved again if update is true.
+func NewPinner(lock *Lock, resolver *Resolver, update bool) *Pinner {
+	return &Pinner{
+		lock:     lock,
+		resolver: resolver,
+		update:   update,
+		resolved: map[string]string{},
+	}
+}
+
+// Pin returns the digest of image
+func (p *Pinner) Pin(image string) (string, error) {
+	if d, ok := p.resolved[image]; ok {
+		return d, nil
+	}
+	d, ok := p.lock.Images[image]
+	if !ok || p.update {
+		if p.resolver == nil {
+			return "", fmt.Errorf("image %s is not in the lock file, run banana build to resolve it", image)
+		}
+		var err error
+		if d, err = p.resolver.Resolve(image); err != nil {
+			return "", err
+		}
+	}
+	p.resolved[image] = d
+	return d, nil
+}
+
+// Lock returns a lock holding every image pinned. Images of the original lock that were not pinned are left out.
+func (p *Pinner) Lock() *Lock {
+	images := make(map[string]string, len(p.resolved))
+	for k, v := range p.resolved {
+		images[k] = v
+	}
+	return &Lock{Images: images}
+}
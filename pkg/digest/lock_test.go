@@ -0,0 +1,58 @@
+package digest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+func TestLock_ReadWrite(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	lock, err := ReadLock(fs, LockFile)
+	assert.NoError(t, err)
+	assert.Empty(t, lock.Images)
+
+	lock.Images["nginx:1.25"] = "sha256:abc"
+	lock.Images["ghcr.io/dexidp/dex:v2.37.0"] = "sha256:def"
+	assert.NoError(t, lock.Write(fs, LockFile))
+
+	data, err := fs.ReadFile(LockFile)
+	assert.NoError(t, err)
+	assert.Equal(t, lockHeader+`images:
+  ghcr.io/dexidp/dex:v2.37.0: sha256:def
+  nginx:1.25: sha256:abc
+`, string(data))
+
+	read, err := ReadLock(fs, LockFile)
+	assert.NoError(t, err)
+	assert.Equal(t, lock, read)
+}
+
+func TestPinner_Pin(t *testing.T) {
+	reg := newRegistry(t, "none", true)
+	resolver := NewResolver(WithHTTPClient(reg.Client()))
+	image := reg.host() + "/app:v1"
+	lock := &Lock{Images: map[string]string{image: "sha256:locked", "nginx:1.25": "sha256:unused"}}
+
+	// Digests of the lock file are used without contacting the registry
+	d, err := NewPinner(lock, nil, false).Pin(image)
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256:locked", d)
+
+	_, err = NewPinner(lock, nil, false).Pin(reg.host() + "/app:v2")
+	assert.ErrorContains(t, err, "not in the lock file")
+
+	// Images missing from the lock file are resolved
+	p := NewPinner(lock, resolver, false)
+	d, err = p.Pin(reg.host() + "/app:v2")
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256:fromheader", d)
+	assert.Equal(t, map[string]string{reg.host() + "/app:v2": "sha256:fromheader"}, p.Lock().Images)
+
+	// Every image is resolved again when updating
+	p = NewPinner(lock, resolver, true)
+	d, err = p.Pin(image)
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256:fromheader", d)
+}
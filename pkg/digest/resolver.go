@@ -0,0 +1,273 @@
+// Package digest resolves image tags to manifest digests through the OCI distribution API and records them in a lock file
+package digest
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/middlewaregruppen/banana/pkg/module"
+)
+
+// manifestTypes are the media types of manifests accepted, indexes first so that multi-arch images resolve to their index
+var manifestTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// dockerHubAuthKey is the key of Docker Hub credentials in docker config files
+const dockerHubAuthKey = "https://index.docker.io/v1/"
+
+// Credentials is a username and password for a registry
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// Resolver resolves image tags to digests
+type Resolver struct {
+	client *http.Client
+
+	// auths holds credentials by registry host
+	auths map[string]Credentials
+}
+
+// ResolverOpts is options for the resolver
+type ResolverOpts func(r *Resolver)
+
+// WithHTTPClient returns a ResolverOpts using client for requests to registries
+func WithHTTPClient(client *http.Client) ResolverOpts {
+	return func(r *Resolver) {
+		r.client = client
+	}
+}
+
+// WithCredentials returns a ResolverOpts authenticating to registries with auths, keyed by registry host
+func WithCredentials(auths map[string]Credentials) ResolverOpts {
+	return func(r *Resolver) {
+		r.auths = auths
+	}
+}
+
+// NewResolver returns a resolver using the default HTTP client and no credentials unless configured by opts
+func NewResolver(opts ...ResolverOpts) *Resolver {
+	r := &Resolver{
+		client: http.DefaultClient,
+		auths:  map[string]Credentials{},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Resolve returns the digest of the manifest the tag of image refers to. Images without tag resolve latest.
+func (r *Resolver) Resolve(image string) (string, error) {
+	ref := module.ParseImage(image)
+	tag := ref.Tag
+	if len(tag) == 0 {
+		tag = "latest"
+	}
+	host := ref.Registry
+	if host == "docker.io" {
+		host = "registry-1.docker.io"
+	}
+	u := fmt.Sprintf("https://%s/v2/%s/manifests/%s", host, ref.Repository, tag)
+
+	resp, err := r.do(http.MethodHead, u, ref)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		if d := resp.Header.Get("Docker-Content-Digest"); len(d) > 0 {
+			return d, nil
+		}
+	}
+
+	// Registries aren't required to return the digest, in which case it is computed from the manifest
+	resp, err = r.do(http.MethodGet, u, ref)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unable to resolve %s: %s", image, resp.Status)
+	}
+	if d := resp.Header.Get("Docker-Content-Digest"); len(d) > 0 {
+		return d, nil
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, resp.Body); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("sha256:%x", h.Sum(nil)), nil
+}
+
+// do sends a request for the manifest at u, authenticating as challenged by the registry
+func (r *Resolver) do(method, u string, ref module.ImageRef) (*http.Response, error) {
+	resp, err := r.send(method, u, "")
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	resp.Body.Close()
+
+	scheme, params := parseChallenge(resp.Header.Get("WWW-Authenticate"))
+	creds, hasCreds := r.auths[ref.Registry]
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if !hasCreds {
+			return nil, fmt.Errorf("registry %s requires credentials", ref.Registry)
+		}
+		return r.send(method, u, "Basic "+basicAuth(creds))
+	case "bearer":
+		token, err := r.token(params, fmt.Sprintf("repository:%s:pull", ref.Repository), creds, hasCreds)
+		if err != nil {
+			return nil, fmt.Errorf("unable to authenticate to %s: %w", ref.Registry, err)
+		}
+		return r.send(method, u, "Bearer "+token)
+	}
+	return nil, fmt.Errorf("registry %s requires unsupported authentication %q", ref.Registry, scheme)
+}
+
+func (r *Resolver) send(method, u, authorization string) (*http.Response, error) {
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestTypes, ", "))
+	if len(authorization) > 0 {
+		req.Header.Set("Authorization", authorization)
+	}
+	return r.client.Do(req)
+}
+
+// token fetches a bearer token from the realm of a challenge
+func (r *Resolver) token(params map[string]string, scope string, creds Credentials, hasCreds bool) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || len(realm.Host) == 0 {
+		return "", fmt.Errorf("invalid realm %q", params["realm"])
+	}
+	q := realm.Query()
+	if service, ok := params["service"]; ok {
+		q.Set("service", service)
+	}
+	if s, ok := params["scope"]; ok {
+		scope = s
+	}
+	q.Set("scope", scope)
+	realm.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if hasCreds {
+		req.SetBasicAuth(creds.Username, creds.Password)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request failed: %s", resp.Status)
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	if len(body.Token) > 0 {
+		return body.Token, nil
+	}
+	return body.AccessToken, nil
+}
+
+// parseChallenge returns the scheme and parameters of a WWW-Authenticate header such as
+// Bearer realm="https://auth.example.com/token",service="registry.example.com"
+func parseChallenge(h string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(h), " ")
+	params := map[string]string{}
+	for len(rest) > 0 {
+		var key, val string
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, " ,"), "=")
+		if strings.HasPrefix(rest, `"`) {
+			val, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			val, rest, _ = strings.Cut(rest, ",")
+		}
+		if len(key) > 0 {
+			params[strings.ToLower(strings.TrimSpace(key))] = val
+		}
+	}
+	return scheme, params
+}
+
+func basicAuth(c Credentials) string {
+	return base64.StdEncoding.EncodeToString([]byte(c.Username + ":" + c.Password))
+}
+
+// LoadDockerConfig returns the credentials of the docker config file at $DOCKER_CONFIG/config.json,
+// or ~/.docker/config.json. Returns no credentials if there is no config file. Credential helpers are not supported.
+func LoadDockerConfig() (map[string]Credentials, error) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if len(dir) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return map[string]Credentials{}, nil
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if os.IsNotExist(err) {
+		return map[string]Credentials{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseDockerConfig(data)
+}
+
+func parseDockerConfig(data []byte) (map[string]Credentials, error) {
+	var cfg struct {
+		Auths map[string]struct {
+			Auth     string `json:"auth"`
+			Username string `json:"username"`
+			Password string `json:"password"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("unable to read docker config: %w", err)
+	}
+	auths := map[string]Credentials{}
+	for key, a := range cfg.Auths {
+		c := Credentials{Username: a.Username, Password: a.Password}
+		if len(a.Auth) > 0 {
+			decoded, err := base64.StdEncoding.DecodeString(a.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("invalid auth of %s in docker config: %w", key, err)
+			}
+			c.Username, c.Password, _ = strings.Cut(string(decoded), ":")
+		}
+		host := key
+		if key == dockerHubAuthKey {
+			host = "docker.io"
+		} else if u, err := url.Parse(key); err == nil && len(u.Host) > 0 {
+			host = u.Host
+		}
+		auths[host] = c
+	}
+	return auths, nil
+}
@@ -0,0 +1,139 @@
+package digest
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// manifest is the manifest served by the test registry
+const manifest = `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json"}`
+
+// registry is an in-process OCI distribution registry serving manifest for every tag of repository app
+type registry struct {
+	*httptest.Server
+
+	// auth is the authentication required, one of none, basic or bearer
+	auth string
+
+	// digestHeader returns the digest of manifests in the Docker-Content-Digest header
+	digestHeader bool
+}
+
+func newRegistry(t *testing.T, auth string, digestHeader bool) *registry {
+	r := &registry{auth: auth, digestHeader: digestHeader}
+	r.Server = httptest.NewTLSServer(r)
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *registry) host() string {
+	return r.Listener.Addr().String()
+}
+
+func (r *registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/token" {
+		if user, pass, ok := req.BasicAuth(); !ok || user != "bob" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if req.URL.Query().Get("scope") != "repository:app:pull" || req.URL.Query().Get("service") != "test" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"token":"t0k3n"}`)
+		return
+	}
+
+	switch r.auth {
+	case "basic":
+		if req.Header.Get("Authorization") != "Basic "+base64.StdEncoding.EncodeToString([]byte("bob:secret")) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	case "bearer":
+		if req.Header.Get("Authorization") != "Bearer t0k3n" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, r.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+
+	if !strings.HasPrefix(req.URL.Path, "/v2/app/manifests/") || !strings.Contains(req.Header.Get("Accept"), "application/vnd.oci.image.index.v1+json") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+	if r.digestHeader {
+		w.Header().Set("Docker-Content-Digest", "sha256:fromheader")
+	}
+	if req.Method == http.MethodGet {
+		fmt.Fprint(w, manifest)
+	}
+}
+
+func TestResolver_Resolve(t *testing.T) {
+	computed := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(manifest)))
+
+	var tests = []struct {
+		name         string
+		auth         string
+		digestHeader bool
+		creds        bool
+		want         string
+		wantErr      bool
+	}{
+		{"anonymous", "none", true, false, "sha256:fromheader", false},
+		{"digest computed from manifest", "none", false, false, computed, false},
+		{"basic auth", "basic", true, true, "sha256:fromheader", false},
+		{"basic auth without credentials", "basic", true, false, "", true},
+		{"bearer token", "bearer", true, true, "sha256:fromheader", false},
+		{"bearer token without credentials", "bearer", true, false, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := newRegistry(t, tt.auth, tt.digestHeader)
+			auths := map[string]Credentials{}
+			if tt.creds {
+				auths[reg.host()] = Credentials{Username: "bob", Password: "secret"}
+			}
+			r := NewResolver(WithHTTPClient(reg.Client()), WithCredentials(auths))
+
+			got, err := r.Resolve(reg.host() + "/app:v1")
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestResolver_ResolveNotFound(t *testing.T) {
+	reg := newRegistry(t, "none", true)
+	_, err := NewResolver(WithHTTPClient(reg.Client())).Resolve(reg.host() + "/missing:v1")
+	assert.ErrorContains(t, err, "404 Not Found")
+}
+
+func TestParseDockerConfig(t *testing.T) {
+	data := `{"auths": {
+  "https://index.docker.io/v1/": {"auth": "` + base64.StdEncoding.EncodeToString([]byte("alice:pw:with:colons")) + `"},
+  "ghcr.io": {"username": "bob", "password": "secret"},
+  "https://registry.example.com": {"auth": "` + base64.StdEncoding.EncodeToString([]byte("carol:pw")) + `"}
+}}`
+	auths, err := parseDockerConfig([]byte(data))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]Credentials{
+		"docker.io":            {Username: "alice", Password: "pw:with:colons"},
+		"ghcr.io":              {Username: "bob", Password: "secret"},
+		"registry.example.com": {Username: "carol", Password: "pw"},
+	}, auths)
+}
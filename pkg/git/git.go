@@ -5,11 +5,14 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/go-git/go-billy/v5/memfs"
 	"github.com/go-git/go-billy/v5/util"
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/storage"
 	"github.com/go-git/go-git/v5/storage/memory"
 	"github.com/middlewaregruppen/banana/pkg/module"
@@ -31,6 +34,9 @@ type Cloner struct {
 
 	// The sub directory in the repo to clone
 	cloneSubdir string
+
+	// The commit the ref resolved to, known once cloned
+	commit string
 }
 
 // CloonerOpts is options for the cloner
@@ -68,7 +74,7 @@ func (c *Cloner) Clone(fsys filesys.FileSystem) error {
 	}
 
 	// Clone
-	_, err := git.Clone(c.storer, fs, &git.CloneOptions{
+	repo, err := git.Clone(c.storer, fs, &git.CloneOptions{
 		URL:           c.cloneURL,
 		ReferenceName: c.cloneRef,
 		//SingleBranch: true, 	// SingleBranch: true doesn't work together with ReferenceName when remote repo uses main instead of master as branch name
@@ -79,6 +85,12 @@ func (c *Cloner) Clone(fsys filesys.FileSystem) error {
 		return err
 	}
 
+	head, err := repo.Head()
+	if err != nil {
+		return err
+	}
+	c.commit = head.Hash().String()
+
 	// Walk over the given targetPath in a temporary mem fs and copy files/folders
 	// to the tiven filesystem
 	err = util.Walk(fs, c.cloneSubdir, func(rel string, info os.FileInfo, err error) error {
@@ -138,6 +150,11 @@ func (c *Cloner) GetRef() plumbing.ReferenceName {
 	return c.cloneRef
 }
 
+// Commit returns the hash of the commit cloned. Empty until cloned.
+func (c *Cloner) Commit() string {
+	return c.commit
+}
+
 func NewCloner(mod module.Module, opts ...ClonerOpts) *Cloner {
 
 	cloneRef := plumbing.HEAD
@@ -147,9 +164,22 @@ func NewCloner(mod module.Module, opts ...ClonerOpts) *Cloner {
 	if len(mod.Ref()) > 0 {
 		cloneRef = plumbing.ReferenceName(mod.Ref())
 	}
+	return newCloner(mod.URL(), cloneRef, opts...)
+}
+
+// NewURLCloner returns a cloner for the repository at url. The tag named by version is cloned, or HEAD if version is empty.
+func NewURLCloner(url, version string, opts ...ClonerOpts) *Cloner {
+	cloneRef := plumbing.HEAD
+	if len(version) > 0 {
+		cloneRef = plumbing.NewTagReferenceName(version)
+	}
+	return newCloner(url, cloneRef, opts...)
+}
+
+func newCloner(url string, ref plumbing.ReferenceName, opts ...ClonerOpts) *Cloner {
 	cloner := &Cloner{
-		cloneURL:    mod.URL(),
-		cloneRef:    cloneRef,
+		cloneURL:    url,
+		cloneRef:    ref,
 		storer:      memory.NewStorage(),
 		clonePath:   ".",
 		cloneSubdir: ".",
@@ -160,3 +190,76 @@ func NewCloner(mod module.Module, opts ...ClonerOpts) *Cloner {
 	}
 	return cloner
 }
+
+// ListTags returns the names of the tags of the remote repository at url without cloning it
+func ListTags(url string) ([]string, error) {
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{url},
+	})
+	refs, err := remote.List(&git.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	for _, ref := range refs {
+		if ref.Name().IsTag() {
+			tags = append(tags, ref.Name().Short())
+		}
+	}
+	return tags, nil
+}
+
+// ReadRevision copies the files below dir, relative to repoPath, as of the revision rev of the repository containing
+// repoPath into fsys at dir. rev may be anything resolvable by git such as HEAD~1, a tag or a commit hash.
+func ReadRevision(repoPath, rev, dir string, fsys filesys.FileSystem) error {
+	repo, err := git.PlainOpenWithOptions(repoPath, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return err
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return fmt.Errorf("unable to resolve revision %s: %w", rev, err)
+	}
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+
+	// Paths in the tree are relative to the root of the work tree
+	wt, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(filepath.Join(repoPath, dir))
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(wt.Filesystem.Root(), abs)
+	if err != nil {
+		return err
+	}
+	prefix := ""
+	if rel != "." {
+		prefix = filepath.ToSlash(rel) + "/"
+	}
+
+	return tree.Files().ForEach(func(f *object.File) error {
+		if !strings.HasPrefix(f.Name, prefix) {
+			return nil
+		}
+		content, err := f.Contents()
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(dir, strings.TrimPrefix(f.Name, prefix))
+		if err := fsys.MkdirAll(filepath.Dir(dst)); err != nil {
+			return err
+		}
+		return fsys.WriteFile(dst, []byte(content))
+	})
+}
@@ -1,8 +1,11 @@
 package git
 
 import (
+	"path/filepath"
 	"testing"
 
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/middlewaregruppen/banana/api/types"
 	"github.com/middlewaregruppen/banana/pkg/module"
 	"github.com/stretchr/testify/assert"
@@ -56,3 +59,55 @@ func TestModuleVersion(t *testing.T) {
 		})
 	}
 }
+
+func TestReadRevision(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	assert.NoError(t, err)
+	wt, err := repo.Worktree()
+	assert.NoError(t, err)
+
+	disk := filesys.MakeFsOnDisk()
+	commit := func(content string) {
+		assert.NoError(t, disk.MkdirAll(filepath.Join(dir, "src", "app")))
+		assert.NoError(t, disk.WriteFile(filepath.Join(dir, "src", "app", "configmap.yaml"), []byte(content)))
+		assert.NoError(t, disk.WriteFile(filepath.Join(dir, "banana.yaml"), []byte(content)))
+		_, err := wt.Add(".")
+		assert.NoError(t, err)
+		_, err = wt.Commit(content, &git.CommitOptions{Author: &object.Signature{Name: "test", Email: "test@example.com"}})
+		assert.NoError(t, err)
+	}
+	commit("first")
+	commit("second")
+
+	fs := filesys.MakeFsInMemory()
+	assert.NoError(t, ReadRevision(dir, "HEAD~1", "src", fs))
+	content, err := fs.ReadFile("src/app/configmap.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, "first", string(content))
+	// Only files below src are read
+	assert.False(t, fs.Exists("banana.yaml"))
+
+	assert.Error(t, ReadRevision(dir, "v1.0.0", "src", fs))
+}
+
+func TestClonerCommit(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	assert.NoError(t, err)
+	wt, err := repo.Worktree()
+	assert.NoError(t, err)
+	disk := filesys.MakeFsOnDisk()
+	assert.NoError(t, disk.WriteFile(filepath.Join(dir, "kustomization.yaml"), []byte("resources: []\n")))
+	_, err = wt.Add(".")
+	assert.NoError(t, err)
+	hash, err := wt.Commit("init", &git.CommitOptions{Author: &object.Signature{Name: "test", Email: "test@example.com"}})
+	assert.NoError(t, err)
+	_, err = repo.CreateTag("v1.0.0", hash, nil)
+	assert.NoError(t, err)
+
+	c := NewURLCloner("file://"+dir, "v1.0.0")
+	assert.Empty(t, c.Commit())
+	assert.NoError(t, c.Clone(filesys.MakeFsInMemory()))
+	assert.Equal(t, hash.String(), c.Commit())
+}
@@ -0,0 +1,381 @@
+// Package helm packages built resources as Helm charts
+package helm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/middlewaregruppen/banana/pkg/module"
+	"golang.org/x/mod/semver"
+	"gopkg.in/yaml.v3"
+	"sigs.k8s.io/kustomize/api/resource"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// DefaultVersion is the version of charts built from banana files without a version
+const DefaultVersion = "0.1.0"
+
+// Chart is a Helm chart holding resources as templates. Images, secrets and hosts of ingresses are lifted into the
+// values of the chart so that they can be overridden when installed.
+type Chart struct {
+	// Name is the name of the chart
+	Name string `yaml:"name"`
+	// Version is the version of the chart, a semantic version without leading v
+	Version string `yaml:"version"`
+	// AppVersion is the version of the banana file the chart is built from, if any
+	AppVersion string `yaml:"appVersion,omitempty"`
+
+	templates map[string][]byte
+	images    map[string]interface{}
+	secrets   map[string]interface{}
+	hosts     map[string]interface{}
+
+	// specs selects the fields holding images
+	specs []types.FieldSpec
+}
+
+// chartFile is the Chart.yaml of a chart
+type chartFile struct {
+	APIVersion  string `yaml:"apiVersion"`
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Type        string `yaml:"type"`
+	Version     string `yaml:"version"`
+	AppVersion  string `yaml:"appVersion,omitempty"`
+}
+
+// NewChart returns an empty chart. version is the version of the banana file, such as v1.2.0, and must be a
+// semantic version. Images are lifted from the containers of workloads and the fields selected by specs.
+func NewChart(name, version string, specs []types.FieldSpec) (*Chart, error) {
+	chartVersion := DefaultVersion
+	if len(version) > 0 {
+		v := "v" + strings.TrimPrefix(version, "v")
+		if !semver.IsValid(v) {
+			return nil, fmt.Errorf("version %q of chart %s is not a semantic version", version, name)
+		}
+		chartVersion = strings.TrimPrefix(v, "v")
+	}
+	return &Chart{
+		Name:       name,
+		Version:    chartVersion,
+		AppVersion: version,
+		templates:  map[string][]byte{},
+		images:     map[string]interface{}{},
+		secrets:    map[string]interface{}{},
+		hosts:      map[string]interface{}{},
+		specs:      append(append([]types.FieldSpec{}, module.DefaultImageFieldSpecs...), specs...),
+	}, nil
+}
+
+// value is a field of a template replaced by a reference to the values of the chart
+type value struct {
+	// placeholder is the value of the field until the template is rendered
+	placeholder string
+	// expr is the template expression the placeholder is replaced with
+	expr string
+}
+
+// AddTemplate adds resources to the chart as the template name, lifting their images, secrets and hosts into the
+// values of the chart. Resources are modified in place.
+func (c *Chart) AddTemplate(name string, resources []*resource.Resource) error {
+	var values []value
+	lift := func(n *kyaml.RNode, expr string) {
+		v := value{placeholder: fmt.Sprintf("__banana_value_%d__", len(values)), expr: "{{ " + expr + " }}"}
+		n.YNode().Value = v.placeholder
+		n.YNode().Style = 0
+		n.YNode().Tag = kyaml.NodeTagString
+		values = append(values, v)
+	}
+
+	var docs []string
+	for _, res := range resources {
+		err := module.VisitImages(res, c.specs, func(n *kyaml.RNode) error {
+			if len(n.YNode().Value) == 0 {
+				return nil
+			}
+			key := c.imageKey(n.YNode().Value)
+			lift(n, fmt.Sprintf("index .Values %q %q | quote", "images", key))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if err := c.liftSecret(res, lift); err != nil {
+			return err
+		}
+		if err := c.liftHosts(res, lift); err != nil {
+			return err
+		}
+
+		d, err := res.AsYAML()
+		if err != nil {
+			return err
+		}
+		docs = append(docs, escape(string(d)))
+	}
+
+	tmpl := strings.Join(docs, "---\n")
+	for _, v := range values {
+		tmpl = strings.Replace(tmpl, v.placeholder, v.expr, 1)
+	}
+	c.templates[path.Join("templates", name)] = []byte(tmpl)
+	return nil
+}
+
+// imageKey returns the key of image in the values of the chart, named after its repository
+func (c *Chart) imageKey(image string) string {
+	repo := module.ParseImage(image).Repository
+	key := repo[strings.LastIndex(repo, "/")+1:]
+	return uniqueKey(c.images, key, image)
+}
+
+// liftSecret lifts the keys of res into the values of the chart if it is a Secret. Values encrypted with sops are
+// left out of the chart and must be given when installed.
+func (c *Chart) liftSecret(res *resource.Resource, lift func(n *kyaml.RNode, expr string)) error {
+	if res.GetKind() != "Secret" || res.GetApiVersion() != "v1" {
+		return nil
+	}
+	encrypted := false
+	if sops, err := res.Pipe(kyaml.Lookup("sops")); err != nil {
+		return err
+	} else if sops != nil {
+		encrypted = true
+		if err := res.PipeE(kyaml.Clear("sops")); err != nil {
+			return err
+		}
+	}
+
+	values := map[string]interface{}{}
+	key := uniqueKey(c.secrets, res.GetName(), values)
+	for _, field := range []string{"data", "stringData"} {
+		data, err := res.Pipe(kyaml.Lookup(field))
+		if err != nil {
+			return err
+		}
+		if data == nil {
+			continue
+		}
+		err = data.VisitFields(func(node *kyaml.MapNode) error {
+			k, v := node.Key.YNode().Value, node.Value.YNode().Value
+			if encrypted {
+				v = ""
+			} else if field == "data" {
+				d, err := base64.StdEncoding.DecodeString(v)
+				if err != nil {
+					return fmt.Errorf("secret %s: value of key %s is not base64 encoded: %w", res.GetName(), k, err)
+				}
+				v = string(d)
+			}
+			values[k] = v
+
+			expr := fmt.Sprintf("index .Values %q %q %q", "secrets", key, k)
+			if encrypted {
+				expr = fmt.Sprintf("required %q (%s)", fmt.Sprintf("secrets.%s.%s is required", key, k), expr)
+			}
+			if field == "data" {
+				expr += " | b64enc"
+			}
+			lift(node.Value, expr+" | quote")
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// liftHosts lifts the hosts of res into the values of the chart if it is an Ingress
+func (c *Chart) liftHosts(res *resource.Resource, lift func(n *kyaml.RNode, expr string)) error {
+	if res.GetKind() != "Ingress" {
+		return nil
+	}
+	var hosts []interface{}
+	var nodes []*kyaml.RNode
+	var indexes []int
+	add := func(n *kyaml.RNode) {
+		host := n.YNode().Value
+		if len(host) == 0 || n.YNode().Tag == kyaml.NodeTagNull {
+			return
+		}
+		i := len(hosts)
+		for j, h := range hosts {
+			if h == host {
+				i = j
+				break
+			}
+		}
+		if i == len(hosts) {
+			hosts = append(hosts, host)
+		}
+		nodes = append(nodes, n)
+		indexes = append(indexes, i)
+	}
+	rules, err := res.Pipe(kyaml.Lookup("spec", "rules"))
+	if err != nil {
+		return err
+	}
+	if rules != nil {
+		err := rules.VisitElements(func(rule *kyaml.RNode) error {
+			if host := rule.Field("host"); host != nil {
+				add(host.Value)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	tls, err := res.Pipe(kyaml.Lookup("spec", "tls"))
+	if err != nil {
+		return err
+	}
+	if tls != nil {
+		err := tls.VisitElements(func(t *kyaml.RNode) error {
+			if h := t.Field("hosts"); h != nil {
+				return h.Value.VisitElements(func(host *kyaml.RNode) error {
+					add(host)
+					return nil
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(hosts) == 0 {
+		return nil
+	}
+	key := uniqueKey(c.hosts, res.GetName(), hosts)
+	for i, n := range nodes {
+		lift(n, fmt.Sprintf("index .Values %q %q %d | quote", "hosts", key, indexes[i]))
+	}
+	return nil
+}
+
+// uniqueKey adds v to values under key, suffixed with a number if key already holds another value
+func uniqueKey(values map[string]interface{}, key string, v interface{}) string {
+	k := key
+	for i := 2; ; i++ {
+		existing, ok := values[k]
+		if !ok {
+			values[k] = v
+			return k
+		}
+		if s, isString := v.(string); isString && existing == s {
+			return k
+		}
+		k = fmt.Sprintf("%s-%d", key, i)
+	}
+}
+
+// escape escapes the delimiters of Go templates in s so that they are rendered as is
+func escape(s string) string {
+	r := strings.NewReplacer("{{", `{{"{{"}}`, "}}", `{{"}}"}}`)
+	return r.Replace(s)
+}
+
+// Files returns the files of the chart, relative to the chart directory
+func (c *Chart) Files() (map[string][]byte, error) {
+	files := map[string][]byte{}
+	for p, d := range c.templates {
+		files[p] = d
+	}
+	chart, err := yaml.Marshal(chartFile{
+		APIVersion:  "v2",
+		Name:        c.Name,
+		Description: "Built by banana",
+		Type:        "application",
+		Version:     c.Version,
+		AppVersion:  c.AppVersion,
+	})
+	if err != nil {
+		return nil, err
+	}
+	files["Chart.yaml"] = chart
+
+	values := map[string]interface{}{}
+	for k, v := range map[string]map[string]interface{}{"images": c.images, "secrets": c.secrets, "hosts": c.hosts} {
+		if len(v) > 0 {
+			values[k] = v
+		}
+	}
+	files["values.yaml"] = []byte("{}\n")
+	if len(values) > 0 {
+		if files["values.yaml"], err = yaml.Marshal(values); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// Write writes the chart into the directory dir/<name> on fs
+func (c *Chart) Write(fs filesys.FileSystem, dir string) error {
+	files, err := c.Files()
+	if err != nil {
+		return err
+	}
+	for p, d := range files {
+		p = path.Join(dir, c.Name, p)
+		if err := fs.MkdirAll(path.Dir(p)); err != nil {
+			return err
+		}
+		if err := fs.WriteFile(p, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Package writes the chart as the archive dir/<name>-<version>.tgz on fs, the same as helm package
+func (c *Chart) Package(fs filesys.FileSystem, dir string) error {
+	files, err := c.Files()
+	if err != nil {
+		return err
+	}
+	var names []string
+	for p := range files {
+		names = append(names, p)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, p := range names {
+		// Archives are reproducible, so every file has the same time
+		hdr := &tar.Header{
+			Name:     path.Join(c.Name, p),
+			Mode:     0644,
+			Size:     int64(len(files[p])),
+			ModTime:  time.Unix(0, 0),
+			Typeflag: tar.TypeReg,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(files[p]); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	if err := fs.MkdirAll(dir); err != nil {
+		return err
+	}
+	return fs.WriteFile(path.Join(dir, fmt.Sprintf("%s-%s.tgz", c.Name, c.Version)), buf.Bytes())
+}
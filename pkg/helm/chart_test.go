@@ -0,0 +1,171 @@
+package helm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strconv"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+	"sigs.k8s.io/kustomize/api/provider"
+	"sigs.k8s.io/kustomize/api/resource"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+const resources = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: dex
+  annotations:
+    description: "{{ not a template }}"
+spec:
+  template:
+    spec:
+      containers:
+      - name: dex
+        image: ghcr.io/dexidp/dex:v2.37.0
+      - name: proxy
+        image: ghcr.io/example/dex:v1.0.0
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: dex
+data:
+  password: c2VjcmV0
+stringData:
+  username: admin
+---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: dex
+spec:
+  rules:
+  - host: dex.example.com
+  tls:
+  - hosts:
+    - dex.example.com
+    - login.example.com
+`
+
+func parse(t *testing.T, data string) []*resource.Resource {
+	res, err := provider.NewDefaultDepProvider().GetResourceFactory().SliceFromBytes([]byte(data))
+	assert.NoError(t, err)
+	return res
+}
+
+// render renders the template of the chart with its values, the way helm does with the functions used by charts
+func render(t *testing.T, files map[string][]byte, name string, values map[string]interface{}) string {
+	funcs := template.FuncMap{
+		"quote":  func(v interface{}) string { return strconv.Quote(fmt.Sprint(v)) },
+		"b64enc": func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+		"required": func(msg string, v interface{}) (interface{}, error) {
+			if v == nil || v == "" {
+				return nil, fmt.Errorf("%s", msg)
+			}
+			return v, nil
+		},
+	}
+	tmpl, err := template.New(name).Funcs(funcs).Parse(string(files[name]))
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, map[string]interface{}{"Values": values})
+	assert.NoError(t, err)
+	return buf.String()
+}
+
+func TestNewChart(t *testing.T) {
+	c, err := NewChart("platform", "v1.2.0", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "1.2.0", c.Version)
+	assert.Equal(t, "v1.2.0", c.AppVersion)
+
+	c, err = NewChart("platform", "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultVersion, c.Version)
+
+	_, err = NewChart("platform", "2024-01", nil)
+	assert.EqualError(t, err, `version "2024-01" of chart platform is not a semantic version`)
+}
+
+func TestChart_AddTemplate(t *testing.T) {
+	c, err := NewChart("platform", "v1.2.0", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, c.AddTemplate("auth-dex.yaml", parse(t, resources)))
+
+	files, err := c.Files()
+	assert.NoError(t, err)
+	var values map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal(files["values.yaml"], &values))
+	assert.Equal(t, map[string]interface{}{
+		"images": map[string]interface{}{
+			"dex":   "ghcr.io/dexidp/dex:v2.37.0",
+			"dex-2": "ghcr.io/example/dex:v1.0.0",
+		},
+		"secrets": map[string]interface{}{
+			"dex": map[string]interface{}{"password": "secret", "username": "admin"},
+		},
+		"hosts": map[string]interface{}{
+			"dex": []interface{}{"dex.example.com", "login.example.com"},
+		},
+	}, values)
+
+	// Rendering with the default values gives back the resources
+	rendered := parse(t, render(t, files, "templates/auth-dex.yaml", values))
+	for i, res := range parse(t, resources) {
+		assert.Equal(t, res.MustYaml(), rendered[i].MustYaml())
+	}
+
+	// Values are overridden when installed
+	values["hosts"].(map[string]interface{})["dex"] = []interface{}{"dex.internal", "login.internal"}
+	rendered = parse(t, render(t, files, "templates/auth-dex.yaml", values))
+	assert.Contains(t, rendered[2].MustString(), `host: "dex.internal"`)
+	assert.Contains(t, rendered[2].MustString(), `- "login.internal"`)
+}
+
+func TestChart_AddTemplateEncrypted(t *testing.T) {
+	c, err := NewChart("platform", "", nil)
+	assert.NoError(t, err)
+	secret := "apiVersion: v1\nkind: Secret\nmetadata:\n  name: dex\ndata:\n  password: ENC[AES256_GCM,data:abc]\nsops:\n  version: 3.8.1\n"
+	assert.NoError(t, c.AddTemplate("auth-dex.yaml", parse(t, secret)))
+
+	files, err := c.Files()
+	assert.NoError(t, err)
+	assert.NotContains(t, string(files["templates/auth-dex.yaml"]), "sops")
+	assert.NotContains(t, string(files["values.yaml"]), "ENC[")
+	assert.Contains(t, string(files["templates/auth-dex.yaml"]), `required "secrets.dex.password is required"`)
+}
+
+func TestChart_Package(t *testing.T) {
+	c, err := NewChart("platform", "v1.2.0", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, c.AddTemplate("auth-dex.yaml", parse(t, resources)))
+
+	fs := filesys.MakeFsInMemory()
+	assert.NoError(t, c.Write(fs, "charts"))
+	assert.True(t, fs.Exists("charts/platform/Chart.yaml"))
+	assert.NoError(t, c.Package(fs, "charts"))
+
+	data, err := fs.ReadFile("charts/platform-1.2.0.tgz")
+	assert.NoError(t, err)
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	assert.NoError(t, err)
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		names = append(names, hdr.Name)
+	}
+	assert.Equal(t, []string{"platform/Chart.yaml", "platform/templates/auth-dex.yaml", "platform/values.yaml"}, names)
+}
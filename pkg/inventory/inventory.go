@@ -0,0 +1,206 @@
+// Package inventory lists the container images deployed by a build
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/middlewaregruppen/banana/pkg/builder"
+	"github.com/middlewaregruppen/banana/pkg/module"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// Format is the output format of an inventory
+type Format string
+
+const (
+	FormatText      Format = "text"
+	FormatJSON      Format = "json"
+	FormatCycloneDX Format = "cyclonedx"
+)
+
+// ParseFormat returns the format matching s
+func ParseFormat(s string) (Format, error) {
+	switch Format(s) {
+	case FormatText, FormatJSON, FormatCycloneDX:
+		return Format(s), nil
+	}
+	return "", fmt.Errorf("unknown format %q, must be one of %s, %s or %s", s, FormatText, FormatJSON, FormatCycloneDX)
+}
+
+// Reference is a resource referencing an image
+type Reference struct {
+	// Cluster is the cluster the resource is deployed to, empty for modules built at the top level
+	Cluster string `json:"cluster,omitempty"`
+	// Module is the name of the module the resource is part of
+	Module string `json:"module"`
+	// Resource identifies the resource as kind/namespace/name, or kind/name if cluster scoped
+	Resource string `json:"resource"`
+}
+
+// Image is an image along with every resource referencing it
+type Image struct {
+	Image      string      `json:"image"`
+	References []Reference `json:"references"`
+}
+
+// FromResult returns every image of the result in the containers of workloads, and in the fields selected by specs,
+// deduplicated and sorted by image
+func FromResult(result *builder.Result, specs []types.FieldSpec) ([]Image, error) {
+	all := append(append([]types.FieldSpec{}, module.DefaultImageFieldSpecs...), specs...)
+	images := map[string]*Image{}
+	add := func(cluster string, bundles []*module.Bundle) error {
+		for _, bun := range bundles {
+			for _, res := range bun.Resources() {
+				id := fmt.Sprintf("%s/%s", res.GetKind(), res.GetName())
+				if ns := res.GetNamespace(); len(ns) > 0 {
+					id = fmt.Sprintf("%s/%s/%s", res.GetKind(), ns, res.GetName())
+				}
+				ref := Reference{Cluster: cluster, Module: bun.Module().Name(), Resource: id}
+				err := module.VisitImages(res.Resource, all, func(n *kyaml.RNode) error {
+					name := n.YNode().Value
+					if len(name) == 0 {
+						return nil
+					}
+					img, ok := images[name]
+					if !ok {
+						img = &Image{Image: name}
+						images[name] = img
+					}
+					for _, r := range img.References {
+						if r == ref {
+							return nil
+						}
+					}
+					img.References = append(img.References, ref)
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if err := add("", result.Bundles); err != nil {
+		return nil, err
+	}
+	for _, c := range result.Clusters {
+		if err := add(c.Name, c.Bundles); err != nil {
+			return nil, err
+		}
+	}
+
+	var list []Image
+	for _, img := range images {
+		list = append(list, *img)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Image < list[j].Image })
+	return list, nil
+}
+
+// Write writes images to w in the given format
+func Write(w io.Writer, images []Image, format Format) error {
+	switch format {
+	case FormatJSON:
+		if images == nil {
+			images = []Image{}
+		}
+		return writeJSON(w, images)
+	case FormatCycloneDX:
+		return writeJSON(w, cycloneDX(images))
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "IMAGE\tMODULE\tRESOURCE")
+	for _, img := range images {
+		for _, r := range img.References {
+			m := r.Module
+			if len(r.Cluster) > 0 {
+				m = fmt.Sprintf("%s (%s)", m, r.Cluster)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", img.Image, m, r.Resource)
+		}
+	}
+	return tw.Flush()
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(v)
+}
+
+// bom is a CycloneDX bill of materials. Only the fields used are declared.
+type bom struct {
+	BOMFormat   string      `json:"bomFormat"`
+	SpecVersion string      `json:"specVersion"`
+	Version     int         `json:"version"`
+	Components  []component `json:"components"`
+}
+
+type component struct {
+	BOMRef     string     `json:"bom-ref"`
+	Type       string     `json:"type"`
+	Name       string     `json:"name"`
+	Version    string     `json:"version,omitempty"`
+	PURL       string     `json:"purl"`
+	Properties []property `json:"properties,omitempty"`
+}
+
+type property struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// cycloneDX returns a bill of materials holding a container component for each image. Each reference to an image is
+// recorded as a group of properties named banana:reference:<index>:<field>, so that the module, cluster and resource
+// of a reference are kept together. No serial number or timestamp is included so that the same build always results
+// in the same document.
+func cycloneDX(images []Image) bom {
+	b := bom{BOMFormat: "CycloneDX", SpecVersion: "1.5", Version: 1, Components: []component{}}
+	for _, img := range images {
+		ref := module.ParseImage(img.Image)
+		c := component{
+			BOMRef:  img.Image,
+			Type:    "container",
+			Name:    ref.Name(),
+			Version: ref.Tag,
+			PURL:    purl(ref),
+		}
+		if len(ref.Digest) > 0 {
+			c.Version = ref.Digest
+		}
+		for i, r := range img.References {
+			prefix := fmt.Sprintf("banana:reference:%d:", i)
+			c.Properties = append(c.Properties, property{Name: prefix + "module", Value: r.Module})
+			if len(r.Cluster) > 0 {
+				c.Properties = append(c.Properties, property{Name: prefix + "cluster", Value: r.Cluster})
+			}
+			c.Properties = append(c.Properties, property{Name: prefix + "resource", Value: r.Resource})
+		}
+		b.Components = append(b.Components, c)
+	}
+	return b
+}
+
+// purl returns the package URL of an OCI image as specified by https://github.com/package-url/purl-spec
+func purl(ref module.ImageRef) string {
+	s := "pkg:oci/" + strings.ToLower(path.Base(ref.Repository))
+	if len(ref.Digest) > 0 {
+		s += "@" + url.QueryEscape(ref.Digest)
+	}
+	s += "?repository_url=" + ref.Registry + "/" + ref.Repository
+	if len(ref.Tag) > 0 {
+		s += "&tag=" + url.QueryEscape(ref.Tag)
+	}
+	return s
+}
@@ -0,0 +1,147 @@
+package inventory
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/middlewaregruppen/banana/pkg/builder"
+	"github.com/middlewaregruppen/banana/pkg/module"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+const resources = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: busybox
+      containers:
+      - name: web
+        image: nginx:1.25
+      - name: sidecar
+        image: nginx:1.25
+---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: backup
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: backup
+            image: ghcr.io/acme/backup@sha256:abc
+---
+apiVersion: argoproj.io/v1alpha1
+kind: Rollout
+metadata:
+  name: canary
+spec:
+  template:
+    spec:
+      containers:
+      - name: canary
+        image: nginx:1.25
+`
+
+func bundle(t *testing.T, name, namespace string) *module.Bundle {
+	fs := filesys.MakeFsInMemory()
+	assert.NoError(t, fs.WriteFile(name+"/kustomization.yaml", []byte("resources:\n- resources.yaml\n")))
+	assert.NoError(t, fs.WriteFile(name+"/resources.yaml", []byte(resources)))
+	b, err := module.NewKustomizeModule(fs, types.Module{Name: name, Namespace: namespace}, "").Bundle()
+	assert.NoError(t, err)
+	return b
+}
+
+func TestFromResult(t *testing.T) {
+	r := &builder.Result{
+		Bundles: []*module.Bundle{bundle(t, "web/app", "web")},
+		Clusters: []*builder.ClusterResult{{
+			Name:    "dev",
+			Bundles: []*module.Bundle{bundle(t, "web/app", "")},
+		}},
+	}
+	images, err := FromResult(r, []types.FieldSpec{{Group: "argoproj.io", Kind: "Rollout", Path: "spec/template/spec/containers[]/image"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []Image{
+		{Image: "busybox", References: []Reference{
+			{Module: "web/app", Resource: "Deployment/web/web"},
+			{Cluster: "dev", Module: "web/app", Resource: "Deployment/web"},
+		}},
+		{Image: "ghcr.io/acme/backup@sha256:abc", References: []Reference{
+			{Module: "web/app", Resource: "CronJob/web/backup"},
+			{Cluster: "dev", Module: "web/app", Resource: "CronJob/backup"},
+		}},
+		{Image: "nginx:1.25", References: []Reference{
+			{Module: "web/app", Resource: "Deployment/web/web"},
+			{Module: "web/app", Resource: "Rollout/web/canary"},
+			{Cluster: "dev", Module: "web/app", Resource: "Deployment/web"},
+			{Cluster: "dev", Module: "web/app", Resource: "Rollout/canary"},
+		}},
+	}, images)
+
+	// Images of custom resources are only found through field specs
+	images, err = FromResult(&builder.Result{Bundles: r.Bundles}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, images[2].References, 1)
+}
+
+func TestWrite(t *testing.T) {
+	images := []Image{
+		{Image: "ghcr.io/acme/backup:v1.0.0@sha256:abc", References: []Reference{{Module: "web/app", Resource: "CronJob/web/backup"}}},
+		{Image: "nginx:1.25", References: []Reference{
+			{Cluster: "dev", Module: "web/app", Resource: "Deployment/web/web"},
+			{Module: "web/proxy", Resource: "Deployment/web/proxy"},
+		}},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, Write(&buf, images, FormatText))
+	assert.Equal(t, `IMAGE                                  MODULE         RESOURCE
+ghcr.io/acme/backup:v1.0.0@sha256:abc  web/app        CronJob/web/backup
+nginx:1.25                             web/app (dev)  Deployment/web/web
+nginx:1.25                             web/proxy      Deployment/web/proxy
+`, buf.String())
+
+	buf.Reset()
+	assert.NoError(t, Write(&buf, images, FormatCycloneDX))
+	var doc bom
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &doc))
+	assert.Equal(t, "CycloneDX", doc.BOMFormat)
+	assert.Equal(t, []component{
+		{
+			BOMRef:     "ghcr.io/acme/backup:v1.0.0@sha256:abc",
+			Type:       "container",
+			Name:       "ghcr.io/acme/backup",
+			Version:    "sha256:abc",
+			PURL:       "pkg:oci/backup@sha256%3Aabc?repository_url=ghcr.io/acme/backup&tag=v1.0.0",
+			Properties: []property{{"banana:reference:0:module", "web/app"}, {"banana:reference:0:resource", "CronJob/web/backup"}},
+		},
+		{
+			BOMRef:  "nginx:1.25",
+			Type:    "container",
+			Name:    "nginx",
+			Version: "1.25",
+			PURL:    "pkg:oci/nginx?repository_url=docker.io/library/nginx&tag=1.25",
+			Properties: []property{
+				{"banana:reference:0:module", "web/app"},
+				{"banana:reference:0:cluster", "dev"},
+				{"banana:reference:0:resource", "Deployment/web/web"},
+				{"banana:reference:1:module", "web/proxy"},
+				{"banana:reference:1:resource", "Deployment/web/proxy"},
+			},
+		},
+	}, doc.Components)
+
+	_, err := ParseFormat("yaml")
+	assert.Error(t, err)
+}
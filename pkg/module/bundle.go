@@ -2,9 +2,12 @@ package module
 
 import (
 	"bytes"
+	"crypto/rsa"
+	"encoding/base64"
 	"fmt"
 	"io"
 	"path"
+	"sort"
 	"strings"
 	"time"
 
@@ -29,8 +32,20 @@ type Bundle struct {
 	mod           Module
 	opts          []BundleOpts
 	exportRootDir string
+	exportLayout  Layout
 	recipients    []string
+	sealCert      *rsa.PublicKey
+	sealScope     SealedSecretScope
 	kustomization *ktypes.Kustomization
+	namespace     string
+	exportPath    string
+	dependencies  []string
+
+	// labels, annotations and provenance are those of the metadata and provenance applied to the bundle, set on
+	// resources generated afterwards as well
+	labels      map[string]string
+	annotations map[string]string
+	provenance  map[string]string
 }
 
 type BundleOpts func(*Bundle) error
@@ -41,10 +56,75 @@ func (b *Bundle) Resources() []Resource {
 	return b.resources
 }
 
+// Module returns the module this bundle is built from
+func (b *Bundle) Module() Module {
+	return b.mod
+}
+
+// Dependencies returns the names of the modules the module of this bundle depends on
+func (b *Bundle) Dependencies() []string {
+	return b.dependencies
+}
+
 // AddResource adds a resource to this bundle
 func (b *Bundle) AddResource(res Resource) {
 	b.resources = append(b.resources, res)
-	b.kustomization.Resources = append(b.kustomization.Resources, res.FileName())
+}
+
+// AddGeneratedResource adds res, generated after the bundle is built, to this bundle. The labels and annotations of
+// the metadata of the bundle and its provenance are set on res the same as on every other resource.
+func (b *Bundle) AddGeneratedResource(res Resource) error {
+	if err := b.applyGenerated(res.Resource); err != nil {
+		return err
+	}
+	b.AddResource(res)
+	return nil
+}
+
+// applyGenerated sets the labels and annotations of the metadata of the bundle and its provenance on res, a resource
+// generated after the metadata was applied. Labels and annotations already set on res take precedence.
+func (b *Bundle) applyGenerated(res *resource.Resource) error {
+	labels := res.GetLabels()
+	for k, v := range b.labels {
+		if _, ok := labels[k]; !ok {
+			labels[k] = v
+		}
+	}
+	annotations := res.GetAnnotations()
+	for _, m := range []map[string]string{b.annotations, b.provenance} {
+		for k, v := range m {
+			if _, ok := annotations[k]; !ok {
+				annotations[k] = v
+			}
+		}
+	}
+	if len(labels) > 0 {
+		if err := res.SetLabels(labels); err != nil {
+			return err
+		}
+	}
+	if len(annotations) > 0 {
+		return res.SetAnnotations(annotations)
+	}
+	return nil
+}
+
+// RemoveResource removes res from this bundle
+func (b *Bundle) RemoveResource(res Resource) {
+	for i, r := range b.resources {
+		if r.Resource == res.Resource {
+			b.resources = append(b.resources[:i], b.resources[i+1:]...)
+			break
+		}
+	}
+	if b.resmap != nil {
+		_ = b.resmap.Remove(res.CurId())
+	}
+}
+
+// Namespace returns the namespace every resource of the bundle is moved to, if any
+func (b *Bundle) Namespace() string {
+	return b.namespace
 }
 
 // FindByGVK attempts to find a resource with the specific kind group, version and kind
@@ -62,6 +142,8 @@ func (b *Bundle) FindByGVK(gvk GroupVersionKind) []*resource.Resource {
 // Export writes each resource in the bundle to individual yaml files on the provided filesystem.
 // It effectivly runs resource.Flatten on each resource in this bundle. If a v1.Secret is encountered and
 // a list of age recipient are known, then the resource is encrypted before writing to the file.
+// Files are placed according to the export layout, flat by default, and listed in sorted order in the
+// kustomization.yaml of the module.
 func (b *Bundle) Export(fs filesys.FileSystem, opts ...ExportOpts) error {
 
 	// Apply opts
@@ -73,41 +155,47 @@ func (b *Bundle) Export(fs filesys.FileSystem, opts ...ExportOpts) error {
 	}
 
 	root := b.mod.Name()
+	if len(b.exportPath) > 0 {
+		root = b.exportPath
+	}
 	if len(b.exportRootDir) > 0 {
 		root = path.Join(b.exportRootDir, root)
 	}
 
-	err := fs.MkdirAll(root)
+	layout := b.exportLayout
+	if len(layout) == 0 {
+		layout = LayoutFlat
+	}
+	paths, err := layout.Paths(b.Resources())
 	if err != nil {
-		return err
+		return fmt.Errorf("module %s: %w", b.mod.Name(), err)
 	}
 
-	// Create kustomization.yaml
-	kname := path.Join(root, "kustomization.yaml")
-	kfile, err := fs.Create(kname)
+	err = fs.MkdirAll(root)
 	if err != nil {
 		return err
 	}
-	defer kfile.Close()
 
-	kdata, err := yaml.Marshal(b.kustomization)
+	// Create kustomization.yaml
+	kust := *b.kustomization
+	kust.Resources = append([]string{}, paths...)
+	sort.Strings(kust.Resources)
+	kdata, err := yaml.Marshal(&kust)
 	if err != nil {
 		return err
 	}
-
-	_, err = kfile.Write(kdata)
+	err = fs.WriteFile(path.Join(root, "kustomization.yaml"), kdata)
 	if err != nil {
 		return err
 	}
 
 	// Write each resource to file on fs
-	for _, res := range b.Resources() {
-		fname := strings.ToLower(path.Join(root, res.FileName()))
-		dfile, err := fs.Create(fname)
+	for i, res := range b.Resources() {
+		fname := path.Join(root, paths[i])
+		err = fs.MkdirAll(path.Dir(fname))
 		if err != nil {
 			return err
 		}
-		defer dfile.Close()
 
 		var out []byte
 
@@ -126,7 +214,7 @@ func (b *Bundle) Export(fs filesys.FileSystem, opts ...ExportOpts) error {
 			}
 		}
 
-		_, err = dfile.Write(out)
+		err = fs.WriteFile(fname, out)
 		if err != nil {
 			return err
 		}
@@ -136,11 +224,15 @@ func (b *Bundle) Export(fs filesys.FileSystem, opts ...ExportOpts) error {
 }
 
 func (b *Bundle) Flatten(w io.Writer) error {
-	for _, res := range b.resmap.Resources() {
+	for i, res := range b.resmap.Resources() {
 		d, err := res.AsYAML()
 		if err != nil {
 			return err
 		}
+		// Separate each document in the stream
+		if i > 0 {
+			d = append([]byte("---\n"), d...)
+		}
 		_, err = w.Write(d)
 		if err != nil {
 			return err
@@ -235,13 +327,36 @@ func WithExportRootDir(root string) ExportOpts {
 	}
 }
 
+// WithExportLayout returns an ExportOpts placing the files of resources according to layout
+func WithExportLayout(layout Layout) ExportOpts {
+	return func(b *Bundle) error {
+		b.exportLayout = layout
+		return nil
+	}
+}
+
+// WithExportPath returns an ExportOpts writing the module to p, relative to the export root, instead of a directory
+// named after the module
+func WithExportPath(p string) ExportOpts {
+	return func(b *Bundle) error {
+		b.exportPath = p
+		return nil
+	}
+}
+
+// WithDependencies returns a BundleOpts recording the names of the modules the module depends on
+func WithDependencies(names []string) BundleOpts {
+	return func(b *Bundle) error {
+		b.dependencies = names
+		return nil
+	}
+}
+
+// WithResMap returns a BundleOpts bundling the resources of rm. The resources of the bundle are populated by NewBundle
+// once every option has been applied, so that they are added once and reflect options replacing resources.
 func WithResMap(rm resmap.ResMap) BundleOpts {
 	return func(b *Bundle) error {
 		b.resmap = rm
-		b.resources = make([]Resource, len(b.resmap.Resources()))
-		for i, res := range b.resmap.Resources() {
-			b.resources[i].Resource = res
-		}
 		return nil
 	}
 }
@@ -283,6 +398,7 @@ func WithURLs(s string) BundleOpts {
 // Searches through the given resmap for Secret resources, updating/adding secrets on this module.
 // The Secret resource to update is determined by the secret key name itself.
 // This function only adds or updates values in the Secret resource if the key matches that of the module.
+// Values are base64 encoded since they are set in the data of the Secret.
 func WithSecrets(secrets []Secret) BundleOpts {
 	return func(b *Bundle) error {
 		// Create a list of Secret resources to transform
@@ -290,10 +406,14 @@ func WithSecrets(secrets []Secret) BundleOpts {
 
 		// Range over each secret. If the key matches that of a Secret resource then replace it's value with a strategic merge patch
 		for _, k := range secrets {
+			// Referenced secrets are handled by WithExternalSecrets
+			if k.IsRef() {
+				continue
+			}
 			for _, secRes := range secretResources {
 				_, err := secRes.Pipe(
 					kyaml.Lookup("data", k.Key),
-					kyaml.Set(kyaml.NewScalarRNode(k.Value)),
+					kyaml.Set(kyaml.NewScalarRNode(base64.StdEncoding.EncodeToString([]byte(k.Value)))),
 				)
 				if err != nil {
 					return err
@@ -316,6 +436,7 @@ func NewBundle(m Module, opts ...BundleOpts) (*Bundle, error) {
 		mod:       m,
 		opts:      opts,
 		resources: []Resource{},
+		namespace: m.Namespace(),
 	}
 	// Apply opts
 	for _, opt := range opts {
@@ -331,12 +452,19 @@ func NewBundle(m Module, opts ...BundleOpts) (*Bundle, error) {
 			Kind:       ktypes.KustomizationKind,
 			APIVersion: ktypes.KustomizationVersion,
 		},
-		Namespace:  b.mod.Namespace(),
 		Resources:  []string{},
 		Components: []string{},
 	}
+	kust.Namespace = b.namespace
 	b.kustomization = kust
 
+	// Sealing is done once all other options have been applied so that overridden secret values are included
+	if b.sealCert != nil {
+		if err := b.sealSecrets(); err != nil {
+			return nil, err
+		}
+	}
+
 	for _, res := range b.resmap.Resources() {
 		b.AddResource(Resource{Resource: res})
 	}
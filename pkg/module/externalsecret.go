@@ -0,0 +1,149 @@
+package module
+
+import (
+	"fmt"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"sigs.k8s.io/kustomize/api/hasher"
+	"sigs.k8s.io/kustomize/api/resource"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const (
+	defaultSecretStoreKind = "SecretStore"
+	defaultRefreshInterval = "1h"
+)
+
+var resourceFactory = resource.NewFactory(&hasher.Hasher{})
+
+// WithExternalSecrets emits an external-secrets.io/v1beta1 ExternalSecret for each Secret resource holding keys
+// that are referenced by secrets in the form of KEY=ref+<provider>://<key>#<property>. Referenced keys are removed from
+// the Secret, from either data or stringData, so that their values are fetched by the cluster at runtime. If no keys
+// remain the Secret is removed altogether and the ExternalSecret becomes the owner of it. Referenced keys must be held
+// by a Secret of the bundle.
+func WithExternalSecrets(secrets []Secret, cfg types.ExternalSecrets) BundleOpts {
+	return func(b *Bundle) error {
+		var refs []Secret
+		for _, s := range secrets {
+			if s.IsRef() {
+				refs = append(refs, s)
+			}
+		}
+		if len(refs) == 0 {
+			return nil
+		}
+
+		if len(cfg.SecretStoreRef.Name) == 0 {
+			return fmt.Errorf("a secret store is required for referenced secrets, set externalSecrets.secretStoreRef.name")
+		}
+		storeKind := defaultSecretStoreKind
+		if len(cfg.SecretStoreRef.Kind) > 0 {
+			storeKind = cfg.SecretStoreRef.Kind
+		}
+		refreshInterval := defaultRefreshInterval
+		if len(cfg.RefreshInterval) > 0 {
+			refreshInterval = cfg.RefreshInterval
+		}
+
+		// Create a list of Secret resources to transform
+		secretResources := b.FindByGVK(GroupVersionKind{"", "v1", "Secret"})
+
+		found := map[string]bool{}
+		for _, secRes := range secretResources {
+			var data []interface{}
+			for _, ref := range refs {
+				field, err := secretField(secRes, ref.Key)
+				if err != nil {
+					return err
+				}
+				if len(field) == 0 {
+					continue
+				}
+				found[ref.Key] = true
+				key, property, err := ref.RemoteRef()
+				if err != nil {
+					return err
+				}
+				remoteRef := map[string]interface{}{"key": key}
+				if len(property) > 0 {
+					remoteRef["property"] = property
+				}
+				data = append(data, map[string]interface{}{
+					"secretKey": ref.Key,
+					"remoteRef": remoteRef,
+				})
+				_, err = secRes.Pipe(kyaml.Lookup(field), kyaml.Clear(ref.Key))
+				if err != nil {
+					return err
+				}
+			}
+			if len(data) == 0 {
+				continue
+			}
+
+			// Keep the Secret for the remaining values and let the ExternalSecret merge into it
+			stringData, err := secRes.Pipe(kyaml.Lookup("stringData"))
+			if err != nil {
+				return err
+			}
+			creationPolicy := "Merge"
+			if len(secRes.GetDataMap()) == 0 && (kyaml.IsMissingOrNull(stringData) || len(stringData.Content()) == 0) {
+				creationPolicy = "Owner"
+				if err := b.resmap.Remove(secRes.CurId()); err != nil {
+					return err
+				}
+			}
+
+			meta := map[string]interface{}{
+				"name": secRes.GetName(),
+			}
+			if ns := secRes.GetNamespace(); len(ns) > 0 {
+				meta["namespace"] = ns
+			}
+			es := resourceFactory.FromMap(map[string]interface{}{
+				"apiVersion": "external-secrets.io/v1beta1",
+				"kind":       "ExternalSecret",
+				"metadata":   meta,
+				"spec": map[string]interface{}{
+					"refreshInterval": refreshInterval,
+					"secretStoreRef": map[string]interface{}{
+						"name": cfg.SecretStoreRef.Name,
+						"kind": storeKind,
+					},
+					"target": map[string]interface{}{
+						"name":           secRes.GetName(),
+						"creationPolicy": creationPolicy,
+					},
+					"data": data,
+				},
+			})
+			if err := b.applyGenerated(es); err != nil {
+				return err
+			}
+			if err := b.resmap.Append(es); err != nil {
+				return err
+			}
+		}
+		for _, ref := range refs {
+			if !found[ref.Key] {
+				return fmt.Errorf("referenced secret %s is not held by any Secret of module %s", ref.Key, b.mod.Name())
+			}
+		}
+		return nil
+	}
+}
+
+// secretField returns the field of the Secret res, data or stringData, holding key. An empty string is returned if
+// key is held by neither.
+func secretField(res *resource.Resource, key string) (string, error) {
+	for _, field := range []string{"data", "stringData"} {
+		n, err := res.Pipe(kyaml.Lookup(field, key))
+		if err != nil {
+			return "", err
+		}
+		if n != nil {
+			return field, nil
+		}
+	}
+	return "", nil
+}
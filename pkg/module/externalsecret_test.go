@@ -0,0 +1,135 @@
+package module
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/resmap"
+)
+
+func TestBundle_ExternalSecrets(t *testing.T) {
+	store := types.ExternalSecrets{SecretStoreRef: types.SecretStoreRef{Name: "vault"}}
+
+	var tests = []struct {
+		name    string
+		secrets []Secret
+		want    string
+	}{
+		{
+			"merge into remaining secret",
+			[]Secret{{Key: "PASSWORD", Value: "ref+vault://kv/app#password"}},
+			`apiVersion: v1
+data:
+  USERNAME: YWRtaW4=
+kind: Secret
+metadata:
+  labels:
+    app: test
+  name: test-secret
+  namespace: test-namespace
+type: Opaque
+---
+apiVersion: external-secrets.io/v1beta1
+kind: ExternalSecret
+metadata:
+  name: test-secret
+  namespace: test-namespace
+spec:
+  data:
+  - remoteRef:
+      key: kv/app
+      property: password
+    secretKey: PASSWORD
+  refreshInterval: 1h
+  secretStoreRef:
+    kind: SecretStore
+    name: vault
+  target:
+    creationPolicy: Merge
+    name: test-secret
+`,
+		},
+		{
+			"owner of secret",
+			[]Secret{
+				{Key: "USERNAME", Value: "ref+vault://kv/app#username"},
+				{Key: "PASSWORD", Value: "ref+vault://kv/app/password"},
+			},
+			`apiVersion: external-secrets.io/v1beta1
+kind: ExternalSecret
+metadata:
+  name: test-secret
+  namespace: test-namespace
+spec:
+  data:
+  - remoteRef:
+      key: kv/app
+      property: username
+    secretKey: USERNAME
+  - remoteRef:
+      key: kv/app/password
+    secretKey: PASSWORD
+  refreshInterval: 1h
+  secretStoreRef:
+    kind: SecretStore
+    name: vault
+  target:
+    creationPolicy: Owner
+    name: test-secret
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			m := newModule(types.Module{Name: "test-namespace/test-secret-module"})
+			b, err := m.Bundle(
+				WithSecrets(tt.secrets),
+				WithExternalSecrets(tt.secrets, store),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = b.Flatten(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
+
+func TestBundle_ExternalSecretsStringData(t *testing.T) {
+	store := types.ExternalSecrets{SecretStoreRef: types.SecretStoreRef{Name: "vault"}}
+	secret := object("v1", "Secret", "web", "app")
+	secret["stringData"] = map[string]interface{}{"TOKEN": "changeme"}
+
+	rm := resmap.New()
+	for _, r := range makeResources(t, secret) {
+		if err := rm.Append(r.Resource); err != nil {
+			t.Fatal(err)
+		}
+	}
+	secrets := []Secret{{Key: "TOKEN", Value: "ref+vault://kv/app#token"}}
+	b, err := NewBundle(newModule(types.Module{Name: "web/app"}), WithResMap(rm), WithExternalSecrets(secrets, store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, b.FindByGVK(GroupVersionKind{"", "v1", "Secret"}), 0)
+	es := b.FindByGVK(GroupVersionKind{"external-secrets.io", "v1beta1", "ExternalSecret"})
+	if assert.Len(t, es, 1) {
+		assert.Contains(t, es[0].MustString(), "secretKey: TOKEN")
+		assert.Contains(t, es[0].MustString(), "creationPolicy: Owner")
+	}
+}
+
+func TestBundle_ExternalSecretsMissingKey(t *testing.T) {
+	store := types.ExternalSecrets{SecretStoreRef: types.SecretStoreRef{Name: "vault"}}
+	secrets := []Secret{{Key: "API_KEY", Value: "ref+vault://kv/app#key"}}
+	m := newModule(types.Module{Name: "test-namespace/test-secret-module"})
+	_, err := m.Bundle(WithExternalSecrets(secrets, store))
+	assert.EqualError(t, err, "referenced secret API_KEY is not held by any Secret of module test-namespace/test-secret-module")
+}
@@ -0,0 +1,220 @@
+package module
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"sigs.k8s.io/kustomize/api/resource"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// defaultRegistry is the registry of images not naming a registry
+const defaultRegistry = "docker.io"
+
+// DefaultImageFieldSpecs selects the images of every container, init container and ephemeral container of workloads
+var DefaultImageFieldSpecs = imageFieldSpecs([]podSpec{
+	{"spec", []string{"/Pod"}},
+	{"spec/template/spec", []string{"apps/Deployment", "apps/StatefulSet", "apps/DaemonSet", "apps/ReplicaSet", "batch/Job", "/ReplicationController"}},
+	{"spec/jobTemplate/spec/template/spec", []string{"batch/CronJob"}},
+})
+
+// podSpec is the path of the pod spec in resources of the given kinds in the form of group/kind
+type podSpec struct {
+	path  string
+	kinds []string
+}
+
+func imageFieldSpecs(podSpecs []podSpec) []types.FieldSpec {
+	var specs []types.FieldSpec
+	for _, ps := range podSpecs {
+		for _, gk := range ps.kinds {
+			group, kind, _ := strings.Cut(gk, "/")
+			for _, containers := range []string{"containers", "initContainers", "ephemeralContainers"} {
+				specs = append(specs, types.FieldSpec{Group: group, Kind: kind, Path: fmt.Sprintf("%s/%s[]/image", ps.path, containers)})
+			}
+		}
+	}
+	return specs
+}
+
+// ImageRef is a reference to a container image
+type ImageRef struct {
+	// Registry is the host of the registry, docker.io if the reference doesn't name one
+	Registry string
+	// Repository is the path of the image within the registry
+	Repository string
+	// Tag is the tag of the image, if any
+	Tag string
+	// Digest is the digest of the image, if any
+	Digest string
+
+	// explicit is true if the reference names the registry
+	explicit bool
+}
+
+// ParseImage parses an image reference such as nginx:1.25, ghcr.io/dexidp/dex:v2.37.0 or
+// registry.k8s.io/pause@sha256:...
+func ParseImage(s string) ImageRef {
+	ref := ImageRef{Registry: defaultRegistry}
+	name := s
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, ref.Digest = name[:i], name[i+1:]
+	}
+	if i := strings.LastIndex(name, ":"); i >= 0 && !strings.Contains(name[i:], "/") {
+		name, ref.Tag = name[:i], name[i+1:]
+	}
+	if first, rest, ok := strings.Cut(name, "/"); ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		ref.Registry, name, ref.explicit = first, rest, true
+	} else if !ok {
+		name = "library/" + name
+	}
+	ref.Repository = name
+	return ref
+}
+
+// Name returns the reference without tag and digest
+func (r ImageRef) Name() string {
+	if !r.explicit && r.Registry == defaultRegistry {
+		return strings.TrimPrefix(r.Repository, "library/")
+	}
+	return r.Registry + "/" + r.Repository
+}
+
+// String returns the reference in the form it was parsed from
+func (r ImageRef) String() string {
+	s := r.Name()
+	if len(r.Tag) > 0 {
+		s += ":" + r.Tag
+	}
+	if len(r.Digest) > 0 {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// VisitImages calls fn with the node of every image field of res selected by specs. A spec naming a kind only selects
+// resources of that kind and group, while a spec without kind selects resources of its group, or every resource.
+func VisitImages(res *resource.Resource, specs []types.FieldSpec, fn func(n *kyaml.RNode) error) error {
+	gvk := res.GetGvk()
+	for _, spec := range specs {
+		if len(spec.Kind) > 0 && (spec.Kind != gvk.Kind || spec.Group != gvk.Group) {
+			continue
+		}
+		if len(spec.Group) > 0 && spec.Group != gvk.Group {
+			continue
+		}
+		if len(spec.Version) > 0 && spec.Version != gvk.Version {
+			continue
+		}
+		if err := visitPath(&res.RNode, strings.Split(spec.Path, "/"), fn); err != nil {
+			return fmt.Errorf("%s: %w", res.CurId(), err)
+		}
+	}
+	return nil
+}
+
+// visitPath calls fn with the scalar at path below n. Fields suffixed with [] are lists of which every item is visited.
+func visitPath(n *kyaml.RNode, path []string, fn func(n *kyaml.RNode) error) error {
+	if len(path) == 0 {
+		if n.YNode().Kind != kyaml.ScalarNode {
+			return nil
+		}
+		return fn(n)
+	}
+	field, isList := strings.CutSuffix(path[0], "[]")
+	child, err := n.Pipe(kyaml.Lookup(field))
+	if err != nil || child == nil {
+		return err
+	}
+	if !isList {
+		return visitPath(child, path[1:], fn)
+	}
+	items, err := child.Elements()
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if err := visitPath(item, path[1:], fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WithImageRegistry returns a BundleOpts pulling images of every container, and of the additional fields selected by
+// specs, from the mirror of cfg instead of their own registry. Only images of the registries of cfg are rewritten,
+// or every image if none are given.
+func WithImageRegistry(cfg types.ImageRegistry, specs []types.FieldSpec) BundleOpts {
+	return func(b *Bundle) error {
+		if len(cfg.Mirror) == 0 {
+			return nil
+		}
+		mirror := strings.TrimSuffix(cfg.Mirror, "/")
+		all := append(append([]types.FieldSpec{}, DefaultImageFieldSpecs...), specs...)
+		for _, res := range b.resmap.Resources() {
+			err := VisitImages(res, all, func(n *kyaml.RNode) error {
+				image := n.YNode().Value
+				if rewritten, ok := rewriteImage(image, mirror, cfg.Registries); ok {
+					n.YNode().Value = rewritten
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// rewriteImage returns image pulled from mirror if its registry is one of registries, or registries is empty.
+// Images already pulled from the mirror are left as is.
+func rewriteImage(image, mirror string, registries []string) (string, bool) {
+	if len(image) == 0 || strings.HasPrefix(image, mirror+"/") {
+		return image, false
+	}
+	ref := ParseImage(image)
+	if len(registries) > 0 {
+		found := false
+		for _, r := range registries {
+			if r == ref.Registry {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return image, false
+		}
+	}
+	ref.Registry, ref.explicit = mirror, true
+	return ref.String(), true
+}
+
+// WithImageDigests returns a BundleOpts replacing the tag of every image of containers, and of the additional fields
+// selected by specs, with the digest returned by resolve. Images already referenced by digest are left as is.
+func WithImageDigests(resolve func(image string) (string, error), specs []types.FieldSpec) BundleOpts {
+	return func(b *Bundle) error {
+		all := append(append([]types.FieldSpec{}, DefaultImageFieldSpecs...), specs...)
+		for _, res := range b.resmap.Resources() {
+			err := VisitImages(res, all, func(n *kyaml.RNode) error {
+				image := n.YNode().Value
+				if len(image) == 0 || strings.Contains(image, "@") {
+					return nil
+				}
+				digest, err := resolve(image)
+				if err != nil {
+					return err
+				}
+				ref := ParseImage(image)
+				ref.Tag, ref.Digest = "", digest
+				n.YNode().Value = ref.String()
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
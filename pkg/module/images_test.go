@@ -0,0 +1,156 @@
+package module
+
+import (
+	"testing"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/resmap"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+func TestParseImage(t *testing.T) {
+	var tests = []struct {
+		input string
+		want  ImageRef
+	}{
+		{"nginx", ImageRef{Registry: "docker.io", Repository: "library/nginx"}},
+		{"nginx:1.25", ImageRef{Registry: "docker.io", Repository: "library/nginx", Tag: "1.25"}},
+		{"bitnami/redis:7.2", ImageRef{Registry: "docker.io", Repository: "bitnami/redis", Tag: "7.2"}},
+		{"ghcr.io/dexidp/dex:v2.37.0", ImageRef{Registry: "ghcr.io", Repository: "dexidp/dex", Tag: "v2.37.0", explicit: true}},
+		{"localhost:5000/app@sha256:abc", ImageRef{Registry: "localhost:5000", Repository: "app", Digest: "sha256:abc", explicit: true}},
+		{"registry.k8s.io/pause:3.9@sha256:abc", ImageRef{Registry: "registry.k8s.io", Repository: "pause", Tag: "3.9", Digest: "sha256:abc", explicit: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got := ParseImage(tt.input)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.input, got.String())
+		})
+	}
+}
+
+func TestRewriteImage(t *testing.T) {
+	var tests = []struct {
+		image      string
+		registries []string
+		want       string
+	}{
+		{"nginx:1.25", nil, "mirror.example.com/dockerhub/library/nginx:1.25"},
+		{"ghcr.io/dexidp/dex:v2.37.0", nil, "mirror.example.com/dockerhub/dexidp/dex:v2.37.0"},
+		{"ghcr.io/dexidp/dex:v2.37.0", []string{"docker.io"}, "ghcr.io/dexidp/dex:v2.37.0"},
+		{"bitnami/redis@sha256:abc", []string{"docker.io"}, "mirror.example.com/dockerhub/bitnami/redis@sha256:abc"},
+		{"mirror.example.com/dockerhub/library/nginx:1.25", nil, "mirror.example.com/dockerhub/library/nginx:1.25"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			got, _ := rewriteImage(tt.image, "mirror.example.com/dockerhub", tt.registries)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestBundle_ImageRegistry(t *testing.T) {
+	container := func(image string) map[string]interface{} {
+		return map[string]interface{}{"name": "c", "image": image}
+	}
+	podSpec := map[string]interface{}{
+		"containers":          []interface{}{container("nginx:1.25")},
+		"initContainers":      []interface{}{container("busybox")},
+		"ephemeralContainers": []interface{}{container("ghcr.io/debug/tools:v1")},
+	}
+	cronJob := object("batch/v1", "CronJob", "web", "backup")
+	cronJob["spec"] = map[string]interface{}{
+		"jobTemplate": map[string]interface{}{"spec": map[string]interface{}{"template": map[string]interface{}{"spec": podSpec}}},
+	}
+	rollout := object("argoproj.io/v1alpha1", "Rollout", "web", "app")
+	rollout["spec"] = map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+		"containers": []interface{}{container("nginx:1.25")},
+	}}}
+
+	rolloutSpec := types.FieldSpec{Group: "argoproj.io", Kind: "Rollout", Path: "spec/template/spec/containers[]/image"}
+	rm := resmap.New()
+	for _, r := range makeResources(t, cronJob, rollout) {
+		if err := rm.Append(r.Resource); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := NewBundle(newModule(types.Module{Name: "web/app"}), WithResMap(rm), WithImageRegistry(
+		types.ImageRegistry{Mirror: "mirror.example.com/", Registries: []string{"docker.io"}},
+		[]types.FieldSpec{rolloutSpec},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var images []string
+	specs := append([]types.FieldSpec{rolloutSpec}, DefaultImageFieldSpecs...)
+	for _, res := range rm.Resources() {
+		err := VisitImages(res, specs, func(n *kyaml.RNode) error {
+			images = append(images, n.YNode().Value)
+			return nil
+		})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{
+		"mirror.example.com/library/nginx:1.25",
+		"mirror.example.com/library/busybox",
+		"ghcr.io/debug/tools:v1",
+		"mirror.example.com/library/nginx:1.25",
+	}, images)
+}
+
+func TestKustomizeModuleBundle_Images(t *testing.T) {
+	data := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+      - name: web
+        image: nginx:1.25
+`
+	assert.NoError(t, testfs.WriteFile("test-namespace/test-images-module/kustomization.yaml", []byte("resources:\n- deployment.yaml\n")))
+	assert.NoError(t, testfs.WriteFile("test-namespace/test-images-module/deployment.yaml", []byte(data)))
+
+	b, err := newModule(types.Module{
+		Name:   "test-namespace/test-images-module",
+		Images: []types.Image{{Name: "nginx", NewName: "registry.example.com/nginx", Digest: "sha256:abc"}},
+	}).Bundle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	image, err := b.Resources()[0].GetFieldValue("spec.template.spec.containers.0.image")
+	assert.NoError(t, err)
+	assert.Equal(t, "registry.example.com/nginx@sha256:abc", image)
+}
+
+func TestBundle_ImageDigests(t *testing.T) {
+	pod := object("v1", "Pod", "web", "app")
+	pod["spec"] = map[string]interface{}{"containers": []interface{}{
+		map[string]interface{}{"name": "web", "image": "ghcr.io/example/web:v1"},
+		map[string]interface{}{"name": "pinned", "image": "nginx:1.25@sha256:def"},
+	}}
+	rm := resmap.New()
+	if err := rm.Append(makeResources(t, pod)[0].Resource); err != nil {
+		t.Fatal(err)
+	}
+
+	var resolved []string
+	resolve := func(image string) (string, error) {
+		resolved = append(resolved, image)
+		return "sha256:abc", nil
+	}
+	_, err := NewBundle(newModule(types.Module{Name: "web/app"}), WithResMap(rm), WithImageDigests(resolve, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{"ghcr.io/example/web:v1"}, resolved)
+	containers, err := rm.Resources()[0].GetSlice("spec.containers")
+	assert.NoError(t, err)
+	assert.Equal(t, "ghcr.io/example/web@sha256:abc", containers[0].(map[string]interface{})["image"])
+	assert.Equal(t, "nginx:1.25@sha256:def", containers[1].(map[string]interface{})["image"])
+}
@@ -3,6 +3,7 @@ package module
 import (
 	"fmt"
 	"io"
+	"path"
 	"strings"
 	"time"
 
@@ -16,8 +17,13 @@ import (
 	"sigs.k8s.io/kustomize/api/krusty"
 	ktypes "sigs.k8s.io/kustomize/api/types"
 	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/resid"
 )
 
+// ComponentVersionsDir is the directory the repository of a module is cloned into at each version its components are
+// pinned to, when other than the version of the module
+const ComponentVersionsDir = "_versions"
+
 var DefaultKustomizerOptions = &krusty.Options{
 	Reorder:           krusty.ReorderOptionNone,
 	AddManagedbyLabel: false,
@@ -68,7 +74,34 @@ func (m *KustomizeModule) Namespace() string {
 }
 
 func (m *KustomizeModule) Components() []string {
-	return m.mod.Components
+	return m.mod.ComponentNames()
+}
+
+// ComponentVersions returns the versions components of the module are pinned to, other than that of the module. The
+// repository of the module is expected in ComponentVersionsDir/<version> at each of them when bundling.
+func (m *KustomizeModule) ComponentVersions() []string {
+	var versions []string
+	seen := map[string]bool{}
+	for _, c := range m.mod.Components {
+		if m.pinned(c) && !seen[c.Version] {
+			seen[c.Version] = true
+			versions = append(versions, c.Version)
+		}
+	}
+	return versions
+}
+
+// pinned returns true if the component c is pinned to a version other than that of the module
+func (m *KustomizeModule) pinned(c types.Component) bool {
+	return len(c.Version) > 0 && c.Version != m.Version()
+}
+
+// componentPath returns the path of the component c, within the clone of its version if pinned
+func (m *KustomizeModule) componentPath(c types.Component) string {
+	if m.pinned(c) {
+		return path.Join(ComponentVersionsDir, c.Version, m.Name(), c.Name)
+	}
+	return path.Join(m.Name(), c.Name)
 }
 
 func (m *KustomizeModule) Resolve() error {
@@ -80,7 +113,12 @@ func (m *KustomizeModule) Resolve() error {
 func (m *KustomizeModule) Secrets() []Secret {
 	var secrets []Secret
 	for _, s := range m.mod.Secrets {
-		secrets = append(secrets, getSecretFromString(s))
+		// References are kept in their prefixed form so they can be told apart from plain values
+		v := s.Value
+		if len(s.Ref) > 0 {
+			v = secretRefPrefix + s.Ref
+		}
+		secrets = append(secrets, Secret{Key: s.Key, Value: v})
 	}
 	return secrets
 }
@@ -121,18 +159,6 @@ func (m *KustomizeModule) Host() string {
 	return name
 }
 
-// Takes a secret in the form of key=value and returns they key and value as two different return values
-func getSecretFromString(s string) Secret {
-	ss := strings.Split(s, "=")
-	key, val := ss[0], ss[1]
-	// If len is greater than 2 it means the secret value contains a '='
-	// so wee need to account for that by concatinating everything after the first occurance.
-	if len(ss) > 2 {
-		val = s[len(key)+1:]
-	}
-	return Secret{Key: key, Value: val}
-}
-
 // ApplySecrets applies all secrets defined in this module to the provided ResMap.
 // Searches through the given resmap for Secret resources, updating/adding secrets on this module.
 // The Secret resource to update is determined by the secret key name itself.
@@ -241,10 +267,23 @@ func (m *KustomizeModule) Bundle(opts ...BundleOpts) (*Bundle, error) {
 		Components: []string{},
 	}
 
-	// Clone every component into tmp fs
-	for _, c := range m.Components() {
-		cName := fmt.Sprintf("%s/%s", m.Name(), c)
-		content.Components = append(content.Components, cName)
+	// Components pinned to another version are read from the clone of that version
+	for _, c := range m.mod.Components {
+		content.Components = append(content.Components, m.componentPath(c))
+	}
+
+	// Patches are applied after components
+	content.Patches, err = kustomizePatches(m.mod.Patches)
+	if err != nil {
+		return nil, err
+	}
+	for _, img := range m.mod.Images {
+		content.Images = append(content.Images, ktypes.Image{
+			Name:    img.Name,
+			NewName: img.NewName,
+			NewTag:  img.NewTag,
+			Digest:  img.Digest,
+		})
 	}
 
 	b, err := yaml.Marshal(&content)
@@ -273,6 +312,31 @@ func (m *KustomizeModule) Bundle(opts ...BundleOpts) (*Bundle, error) {
 	)
 }
 
+// kustomizePatches converts patches into kustomize patches. Patches read from files must be inlined beforehand
+// since files are resolved relative to the banana file rather than the module.
+func kustomizePatches(patches []types.Patch) ([]ktypes.Patch, error) {
+	var result []ktypes.Patch
+	for i, p := range patches {
+		if len(p.Path) > 0 {
+			return nil, fmt.Errorf("patch %d: file %s must be read into the patch before bundling", i, p.Path)
+		}
+		kp := ktypes.Patch{Patch: p.Patch}
+		if t := p.Target; t != nil {
+			kp.Target = &ktypes.Selector{
+				ResId: resid.ResId{
+					Gvk:       resid.Gvk{Group: t.Group, Version: t.Version, Kind: t.Kind},
+					Name:      t.Name,
+					Namespace: t.Namespace,
+				},
+				LabelSelector:      t.LabelSelector,
+				AnnotationSelector: t.AnnotationSelector,
+			}
+		}
+		result = append(result, kp)
+	}
+	return result, nil
+}
+
 func (m *KustomizeModule) BuildEncrypted(data []byte, recipients []string) ([]byte, error) {
 	outputStore := &syaml.Store{}
 	inputStore := &syaml.Store{}
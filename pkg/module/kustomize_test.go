@@ -2,6 +2,7 @@ package module
 
 import (
 	"bytes"
+	"encoding/base64"
 	"fmt"
 	"testing"
 
@@ -18,18 +19,23 @@ func init() {
 	// Simple Ingress
 	ing := []byte(ingressData)
 
-	err := makeSingleModule(ing)
+	err := makeSingleModule("test-namespace/test-module", ing)
+	if err != nil {
+		panic(err)
+	}
+
+	// Simple Secret
+	err = makeSingleModule("test-namespace/test-secret-module", []byte(secretData))
 	if err != nil {
 		panic(err)
 	}
 }
 
-func makeSingleModule(data []byte) error {
+func makeSingleModule(rootdir string, data []byte) error {
 	// The kustomization
 	kust := []byte(kustomizationData)
 
 	// Create module folder structure
-	rootdir := "test-namespace/test-module"
 	err := testfs.MkdirAll(rootdir)
 	if err != nil {
 		return err
@@ -118,3 +124,97 @@ spec:
 	}
 
 }
+
+func TestKustomizeModuleBundle_Patches(t *testing.T) {
+	m := newModule(types.Module{
+		Name: "test-namespace/test-module",
+		Patches: []types.Patch{
+			{
+				Patch: `apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: test-ingress
+  namespace: test-namespace
+  annotations:
+    nginx.ingress.kubernetes.io/ssl-redirect: "true"
+`,
+			},
+			{
+				Patch:  "- op: replace\n  path: /spec/ingressClassName\n  value: traefik\n",
+				Target: &types.PatchTarget{Kind: "Ingress", Name: "test-ingress"},
+			},
+		},
+	})
+	b, err := m.Bundle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ing := b.Resources()[0]
+	assert.Equal(t, "true", ing.GetAnnotations()["nginx.ingress.kubernetes.io/ssl-redirect"])
+	class, err := ing.GetFieldValue("spec.ingressClassName")
+	assert.NoError(t, err)
+	assert.Equal(t, "traefik", class)
+
+	// Patches read from files are inlined by the builder
+	_, err = newModule(types.Module{
+		Name:    "test-namespace/test-module",
+		Patches: []types.Patch{{Path: "patches/ingress.yaml"}},
+	}).Bundle()
+	assert.Error(t, err)
+}
+
+func TestKustomizeModuleBundle_Secrets(t *testing.T) {
+	m := newModule(types.Module{Name: "test-namespace/test-secret-module"})
+	b, err := m.Bundle(WithSecrets([]Secret{{Key: "PASSWORD", Value: "hunter2"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Values of data must be base64 encoded for the Secret to be valid
+	data := b.Resources()[0].GetDataMap()
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("hunter2")), data["PASSWORD"])
+	assert.Equal(t, "YWRtaW4=", data["USERNAME"])
+}
+
+func TestKustomizeModuleBundle_ResourcesOnce(t *testing.T) {
+	b, err := newModule(types.Module{Name: "test-namespace/test-module"}).Bundle()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every resource of the resmap is part of the bundle exactly once
+	assert.Len(t, b.Resources(), 1)
+	var buf bytes.Buffer
+	assert.NoError(t, b.Flatten(&buf))
+	assert.Equal(t, 1, bytes.Count(buf.Bytes(), []byte("kind: Ingress")))
+}
+
+func TestKustomizeModuleBundle_ComponentVersions(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	component := func(dir, name string) {
+		assert.NoError(t, fs.WriteFile(dir+"/kustomization.yaml", []byte("apiVersion: kustomize.config.k8s.io/v1alpha1\nkind: Component\nresources:\n- configmap.yaml\n")))
+		assert.NoError(t, fs.WriteFile(dir+"/configmap.yaml", []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: "+name+"\n")))
+	}
+	assert.NoError(t, fs.WriteFile("ingress/nginx/kustomization.yaml", []byte("resources: []\n")))
+	component("ingress/nginx/tls", "tls-v1.0.0")
+	component("ingress/nginx/metrics", "metrics-v1.0.0")
+	component(ComponentVersionsDir+"/v1.1.0/ingress/nginx/metrics", "metrics-v1.1.0")
+
+	m := NewKustomizeModule(fs, types.Module{
+		Name:       "ingress/nginx",
+		Version:    "v1.0.0",
+		Components: []types.Component{{Name: "tls", Version: "v1.0.0"}, {Name: "metrics", Version: "v1.1.0"}},
+	}, "")
+	assert.Equal(t, []string{"v1.1.0"}, m.ComponentVersions())
+
+	// Components pinned to another version are read from the clone of that version
+	b, err := m.Bundle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, res := range b.Resources() {
+		names = append(names, res.GetName())
+	}
+	assert.Equal(t, []string{"tls-v1.0.0", "metrics-v1.1.0"}, names)
+}
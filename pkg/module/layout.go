@@ -0,0 +1,113 @@
+package module
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Layout determines the directories and file names resources of a bundle are exported to
+type Layout string
+
+const (
+	// LayoutFlat writes every resource into the module directory as <kind>_<name>.yaml
+	LayoutFlat Layout = "flat"
+	// LayoutByKind writes resources into a directory per kind as <kind>/<name>.yaml
+	LayoutByKind Layout = "by-kind"
+	// LayoutByNamespaceKind writes resources into a directory per namespace and kind as <namespace>/<kind>/<name>.yaml
+	LayoutByNamespaceKind Layout = "by-namespace/kind"
+)
+
+// clusterScopedDir is the namespace directory of cluster scoped resources. It can't clash with a namespace
+// since underscores aren't allowed in namespace names.
+const clusterScopedDir = "_cluster"
+
+// Levels of qualification of a file name, used to tell apart resources that would otherwise share a file
+const (
+	qualifyNone = iota
+	qualifyNamespace
+	qualifyGroup
+)
+
+// ParseLayout returns the layout matching s. An empty string defaults to flat.
+func ParseLayout(s string) (Layout, error) {
+	switch Layout(s) {
+	case "", LayoutFlat:
+		return LayoutFlat, nil
+	case LayoutByKind, LayoutByNamespaceKind:
+		return Layout(s), nil
+	}
+	return "", fmt.Errorf("unknown layout %q, must be one of %s, %s or %s", s, LayoutFlat, LayoutByKind, LayoutByNamespaceKind)
+}
+
+// Paths returns the path, relative to the module directory, of each resource. Names hold only the kind and name
+// of a resource unless several resources would share the same path, in which case the namespace and then the API
+// group is added to the names of those resources. An error is returned if resources still share a path.
+func (l Layout) Paths(resources []Resource) ([]string, error) {
+	levels := make([]int, len(resources))
+	for {
+		paths := make([]string, len(resources))
+		byPath := map[string][]int{}
+		for i := range resources {
+			paths[i] = l.path(&resources[i], levels[i])
+			byPath[paths[i]] = append(byPath[paths[i]], i)
+		}
+
+		// Visit paths in order so that the error reported is the same for every export
+		keys := make([]string, 0, len(byPath))
+		for p := range byPath {
+			keys = append(keys, p)
+		}
+		sort.Strings(keys)
+
+		qualified := false
+		for _, p := range keys {
+			idx := byPath[p]
+			if len(idx) < 2 {
+				continue
+			}
+			bumped := false
+			for _, i := range idx {
+				if levels[i] < qualifyGroup {
+					levels[i]++
+					bumped = true
+				}
+			}
+			if !bumped {
+				return nil, fmt.Errorf("resources %s and %s would both be exported to %s", resources[idx[0]].CurId(), resources[idx[1]].CurId(), p)
+			}
+			qualified = true
+		}
+		if !qualified {
+			return paths, nil
+		}
+	}
+}
+
+// path returns the path of res qualified to the given level
+func (l Layout) path(res *Resource, level int) string {
+	kind := strings.ToLower(res.GetKind())
+	if group := res.GetGvk().Group; level >= qualifyGroup && len(group) > 0 {
+		kind = fmt.Sprintf("%s.%s", kind, strings.ToLower(group))
+	}
+	namespace := res.GetNamespace()
+	name := strings.ToLower(res.GetName())
+
+	switch l {
+	case LayoutByKind:
+		if level >= qualifyNamespace && len(namespace) > 0 {
+			name = fmt.Sprintf("%s_%s", namespace, name)
+		}
+		return path.Join(kind, name+".yaml")
+	case LayoutByNamespaceKind:
+		if len(namespace) == 0 {
+			namespace = clusterScopedDir
+		}
+		return path.Join(namespace, kind, name+".yaml")
+	}
+	if level >= qualifyNamespace && len(namespace) > 0 {
+		name = fmt.Sprintf("%s_%s", namespace, name)
+	}
+	return fmt.Sprintf("%s_%s.yaml", kind, name)
+}
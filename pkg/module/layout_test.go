@@ -0,0 +1,136 @@
+package module
+
+import (
+	"testing"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/provider"
+	"sigs.k8s.io/kustomize/api/resmap"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+func makeResources(t *testing.T, objs ...map[string]interface{}) []Resource {
+	rf := provider.NewDefaultDepProvider().GetResourceFactory()
+	var res []Resource
+	for _, o := range objs {
+		res = append(res, Resource{Resource: rf.FromMap(o)})
+	}
+	return res
+}
+
+func object(apiVersion, kind, namespace, name string) map[string]interface{} {
+	meta := map[string]interface{}{"name": name}
+	if len(namespace) > 0 {
+		meta["namespace"] = namespace
+	}
+	return map[string]interface{}{"apiVersion": apiVersion, "kind": kind, "metadata": meta}
+}
+
+func TestLayoutPaths(t *testing.T) {
+	resources := []map[string]interface{}{
+		object("rbac.authorization.k8s.io/v1", "Role", "ingress-nginx", "nginx"),
+		object("rbac.authorization.k8s.io/v1", "Role", "kube-system", "nginx"),
+		object("apps/v1", "Deployment", "ingress-nginx", "nginx"),
+		object("v1", "Service", "ingress-nginx", "nginx"),
+		object("serving.knative.dev/v1", "Service", "ingress-nginx", "nginx"),
+		object("rbac.authorization.k8s.io/v1", "ClusterRole", "", "nginx"),
+	}
+
+	var tests = []struct {
+		layout Layout
+		want   []string
+	}{
+		{
+			LayoutFlat,
+			[]string{
+				"role_ingress-nginx_nginx.yaml",
+				"role_kube-system_nginx.yaml",
+				"deployment_nginx.yaml",
+				"service_ingress-nginx_nginx.yaml",
+				"service.serving.knative.dev_ingress-nginx_nginx.yaml",
+				"clusterrole_nginx.yaml",
+			},
+		},
+		{
+			LayoutByKind,
+			[]string{
+				"role/ingress-nginx_nginx.yaml",
+				"role/kube-system_nginx.yaml",
+				"deployment/nginx.yaml",
+				"service/ingress-nginx_nginx.yaml",
+				"service.serving.knative.dev/ingress-nginx_nginx.yaml",
+				"clusterrole/nginx.yaml",
+			},
+		},
+		{
+			LayoutByNamespaceKind,
+			[]string{
+				"ingress-nginx/role/nginx.yaml",
+				"kube-system/role/nginx.yaml",
+				"ingress-nginx/deployment/nginx.yaml",
+				"ingress-nginx/service/nginx.yaml",
+				"ingress-nginx/service.serving.knative.dev/nginx.yaml",
+				"_cluster/clusterrole/nginx.yaml",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.layout), func(t *testing.T) {
+			got, err := tt.layout.Paths(makeResources(t, resources...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLayoutPathsCollision(t *testing.T) {
+	res := makeResources(t,
+		object("autoscaling/v1", "HorizontalPodAutoscaler", "default", "app"),
+		object("autoscaling/v2", "HorizontalPodAutoscaler", "default", "app"),
+	)
+	_, err := LayoutFlat.Paths(res)
+	assert.EqualError(t, err, "resources HorizontalPodAutoscaler.v1.autoscaling/app.default and HorizontalPodAutoscaler.v2.autoscaling/app.default would both be exported to horizontalpodautoscaler.autoscaling_default_app.yaml")
+}
+
+func TestParseLayout(t *testing.T) {
+	l, err := ParseLayout("")
+	assert.NoError(t, err)
+	assert.Equal(t, LayoutFlat, l)
+
+	_, err = ParseLayout("by-name")
+	assert.Error(t, err)
+}
+
+func TestBundleExportLayout(t *testing.T) {
+	rm := resmap.New()
+	for _, r := range makeResources(t,
+		object("v1", "Service", "web", "b"),
+		object("apps/v1", "Deployment", "web", "a"),
+	) {
+		if err := rm.Append(r.Resource); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, err := NewBundle(newModule(types.Module{Name: "Web/App"}), WithResMap(rm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := filesys.MakeFsInMemory()
+	if err := b.Export(fs, WithExportRootDir("src"), WithExportLayout(LayoutByKind)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The root directory keeps the case of the module name
+	assert.True(t, fs.Exists("src/Web/App/service/b.yaml"))
+	assert.True(t, fs.Exists("src/Web/App/deployment/a.yaml"))
+	k, err := fs.ReadFile("src/Web/App/kustomization.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(k), "resources:\n    - deployment/a.yaml\n    - service/b.yaml\n")
+}
@@ -0,0 +1,113 @@
+package module
+
+import (
+	"github.com/middlewaregruppen/banana/api/types"
+	"gopkg.in/yaml.v3"
+	"sigs.k8s.io/kustomize/api/krusty"
+	ktypes "sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+// WithMetaData returns a BundleOpts applying the labels, annotations, namespace and name prefix of meta to every
+// resource of the bundle. The namespace of the module takes precedence over that of meta. Resources are transformed
+// right away so that options given after it, such as those sealing secrets, see the final names and namespaces.
+// Given more than once, metadata is applied in order and later name prefixes are prepended to earlier ones.
+func WithMetaData(meta *types.ObjectMeta) BundleOpts {
+	return withMetaData(meta, false)
+}
+
+// WithClusterMetaData returns a BundleOpts applying meta on top of the resources of the bundle, the same as
+// WithMetaData except that the namespace of meta takes precedence over that of the module. It applies the metadata
+// of a cluster to the modules deployed to it.
+func WithClusterMetaData(meta *types.ObjectMeta) BundleOpts {
+	return withMetaData(meta, true)
+}
+
+func withMetaData(meta *types.ObjectMeta, override bool) BundleOpts {
+	return func(b *Bundle) error {
+		if meta == nil || b.resmap == nil {
+			return nil
+		}
+		k := &ktypes.Kustomization{
+			TypeMeta: ktypes.TypeMeta{
+				Kind:       ktypes.KustomizationKind,
+				APIVersion: ktypes.KustomizationVersion,
+			},
+			Resources: []string{"resources.yaml"},
+		}
+		ApplyMetaData(k, meta)
+		b.labels = mergeMaps(b.labels, meta.Labels)
+		b.annotations = mergeMaps(b.annotations, meta.Annotations)
+		if !override && len(b.mod.Namespace()) > 0 {
+			k.Namespace = b.mod.Namespace()
+		}
+		if len(k.Namespace) > 0 {
+			b.namespace = k.Namespace
+		}
+		return b.transform(k)
+	}
+}
+
+// mergeMaps returns m with the values of override added, taking precedence
+func mergeMaps(m, override map[string]string) map[string]string {
+	if len(override) == 0 {
+		return m
+	}
+	result := map[string]string{}
+	for k, v := range m {
+		result[k] = v
+	}
+	for k, v := range override {
+		result[k] = v
+	}
+	return result
+}
+
+// transform runs the transformers of the kustomization k over the resources of the bundle. References between
+// resources are updated along with the names they refer to.
+func (b *Bundle) transform(k *ktypes.Kustomization) error {
+	data, err := b.resmap.AsYaml()
+	if err != nil {
+		return err
+	}
+	kdata, err := yaml.Marshal(k)
+	if err != nil {
+		return err
+	}
+	fs := filesys.MakeFsInMemory()
+	if err := fs.WriteFile("resources.yaml", data); err != nil {
+		return err
+	}
+	if err := fs.WriteFile("kustomization.yaml", kdata); err != nil {
+		return err
+	}
+	rm, err := krusty.MakeKustomizer(DefaultKustomizerOptions).Run(fs, ".")
+	if err != nil {
+		return err
+	}
+	b.resmap.Clear()
+	return b.resmap.AppendAll(rm)
+}
+
+// ApplyMetaData sets the fields of k transforming resources according to meta. Labels are added to pod templates
+// and, only if enabled by meta, selectors.
+func ApplyMetaData(k *ktypes.Kustomization, meta *types.ObjectMeta) {
+	if meta == nil {
+		return
+	}
+	if len(meta.Namespace) > 0 {
+		k.Namespace = meta.Namespace
+	}
+	k.NamePrefix = meta.NamePrefix
+	if len(meta.Labels) > 0 {
+		includeSelectors := meta.IncludeSelectors != nil && *meta.IncludeSelectors
+		k.Labels = append(k.Labels, ktypes.Label{
+			Pairs:            meta.Labels,
+			IncludeSelectors: includeSelectors,
+			IncludeTemplates: !includeSelectors,
+		})
+	}
+	if len(meta.Annotations) > 0 {
+		k.CommonAnnotations = meta.Annotations
+	}
+}
@@ -0,0 +1,76 @@
+package module
+
+import (
+	"testing"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/api/resmap"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+func TestBundle_MetaData(t *testing.T) {
+	deployment := map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "web"},
+		"spec": map[string]interface{}{
+			"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "web"}},
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": map[string]interface{}{"app": "web"}},
+			},
+		},
+	}
+	yes := true
+
+	var tests = []struct {
+		name         string
+		meta         *types.ObjectMeta
+		wantSelector map[string]interface{}
+	}{
+		{
+			"selectors left as is",
+			&types.ObjectMeta{Namespace: "web", Labels: map[string]string{"team": "platform"}, Annotations: map[string]string{"owner": "ops"}},
+			map[string]interface{}{"app": "web"},
+		},
+		{
+			"selectors included",
+			&types.ObjectMeta{Namespace: "web", Labels: map[string]string{"team": "platform"}, Annotations: map[string]string{"owner": "ops"}, IncludeSelectors: &yes},
+			map[string]interface{}{"app": "web", "team": "platform"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rm := resmap.New()
+			if err := rm.Append(makeResources(t, deployment)[0].Resource); err != nil {
+				t.Fatal(err)
+			}
+			b, err := NewBundle(newModule(types.Module{Name: "web/app"}), WithResMap(rm), WithMetaData(tt.meta))
+			if err != nil {
+				t.Fatal(err)
+			}
+			fs := filesys.MakeFsInMemory()
+			if err := b.Export(fs); err != nil {
+				t.Fatal(err)
+			}
+
+			out, err := krusty.MakeKustomizer(DefaultKustomizerOptions).Run(fs, "web/app")
+			if err != nil {
+				t.Fatal(err)
+			}
+			res := out.Resources()[0]
+			assert.Equal(t, "web", res.GetNamespace())
+			assert.Equal(t, "platform", res.GetLabels()["team"])
+			assert.Equal(t, "ops", res.GetAnnotations()["owner"])
+
+			template, err := res.GetFieldValue("spec.template.metadata.labels.team")
+			assert.NoError(t, err)
+			assert.Equal(t, "platform", template)
+			selector, err := res.GetFieldValue("spec.selector.matchLabels")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantSelector, selector)
+		})
+	}
+}
@@ -15,6 +15,7 @@ type Module interface {
 	URL() string
 	Namespace() string
 	Components() []string
+	ComponentVersions() []string
 	Resolve() error
 	Secrets() []Secret
 	Host() string
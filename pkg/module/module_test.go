@@ -23,3 +23,15 @@ spec:
               number: 80
         path: /
         pathType: Prefix`
+
+var secretData = `apiVersion: v1
+kind: Secret
+metadata:
+  name: test-secret
+  namespace: test-namespace
+  labels:
+    app: test
+type: Opaque
+data:
+  USERNAME: YWRtaW4=
+  PASSWORD: cGFzc3dvcmQ=`
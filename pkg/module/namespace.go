@@ -0,0 +1,28 @@
+package module
+
+// NewNamespace returns a v1 Namespace resource with the given labels and annotations, which may be nil
+func NewNamespace(name string, labels, annotations map[string]string) (Resource, error) {
+	res := Resource{Resource: resourceFactory.FromMap(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Namespace",
+		"metadata": map[string]interface{}{
+			"name": name,
+		},
+	})}
+	if len(labels) > 0 {
+		if err := res.SetLabels(labels); err != nil {
+			return Resource{}, err
+		}
+	}
+	if len(annotations) > 0 {
+		if err := res.SetAnnotations(annotations); err != nil {
+			return Resource{}, err
+		}
+	}
+	return res, nil
+}
+
+// IsNamespace returns true if res is a v1 Namespace
+func (r *Resource) IsNamespace() bool {
+	return r.GetKind() == "Namespace" && r.GetApiVersion() == "v1"
+}
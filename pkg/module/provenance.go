@@ -0,0 +1,84 @@
+package module
+
+import (
+	"strings"
+	"time"
+)
+
+// Annotations describing where a resource comes from, added to every resource by WithProvenance
+const (
+	// AnnotationBananaVersion is the version of banana that built the resource
+	AnnotationBananaVersion = "banana.io/banana-version"
+	// AnnotationModule is the name of the module the resource is part of
+	AnnotationModule = "banana.io/module"
+	// AnnotationModuleVersion is the version of the module, as declared in the banana file
+	AnnotationModuleVersion = "banana.io/module-version"
+	// AnnotationSource is the URL of the repository the module is cloned from
+	AnnotationSource = "banana.io/source"
+	// AnnotationCommit is the commit the module is resolved to
+	AnnotationCommit = "banana.io/commit"
+	// AnnotationComponents is the comma separated components of the module
+	AnnotationComponents = "banana.io/components"
+	// AnnotationBuildTime is the time of the build in RFC 3339 format
+	AnnotationBuildTime = "banana.io/build-time"
+)
+
+// provenanceAnnotations are the keys of every annotation added by WithProvenance
+var provenanceAnnotations = []string{
+	AnnotationBananaVersion,
+	AnnotationModule,
+	AnnotationModuleVersion,
+	AnnotationSource,
+	AnnotationCommit,
+	AnnotationComponents,
+	AnnotationBuildTime,
+}
+
+// Provenance holds the details of a build not known by the module itself
+type Provenance struct {
+	// BananaVersion is the version of banana building the module
+	BananaVersion string
+
+	// Commit is the commit the module was cloned at
+	Commit string
+
+	// BuildTime is the time of the build. Left out if zero so that builds are reproducible
+	BuildTime time.Time
+}
+
+// WithProvenance returns a BundleOpts annotating every resource of the bundle with the module, source and commit
+// it is built from so that resources in a cluster can be traced back to where they come from. Empty values are left out.
+func WithProvenance(p Provenance) BundleOpts {
+	return func(b *Bundle) error {
+		annotations := map[string]string{
+			AnnotationBananaVersion: p.BananaVersion,
+			AnnotationModule:        b.mod.Name(),
+			AnnotationModuleVersion: b.mod.Version(),
+			AnnotationSource:        b.mod.URL(),
+			AnnotationCommit:        p.Commit,
+			AnnotationComponents:    strings.Join(b.mod.Components(), ","),
+		}
+		if !p.BuildTime.IsZero() {
+			annotations[AnnotationBuildTime] = p.BuildTime.UTC().Format(time.RFC3339)
+		}
+		b.provenance = map[string]string{}
+		for k, v := range annotations {
+			if len(v) > 0 {
+				b.provenance[k] = v
+			}
+		}
+
+		for _, res := range b.resmap.Resources() {
+			a := res.GetAnnotations()
+			for k, v := range annotations {
+				if len(v) > 0 {
+					a[k] = v
+				}
+			}
+			if err := res.SetAnnotations(a); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
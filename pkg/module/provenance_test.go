@@ -0,0 +1,65 @@
+package module
+
+import (
+	"testing"
+	"time"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBundle_Provenance(t *testing.T) {
+	m := newModule(types.Module{Name: "test-namespace/test-module", Version: "v1.0.0"})
+
+	b, err := m.Bundle(WithProvenance(Provenance{BananaVersion: "v0.5.0", Commit: "abc123"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotEmpty(t, b.Resources())
+	for _, res := range b.Resources() {
+		assert.Equal(t, map[string]string{
+			AnnotationBananaVersion: "v0.5.0",
+			AnnotationModule:        "test-namespace/test-module",
+			AnnotationModuleVersion: "v1.0.0",
+			AnnotationSource:        "src",
+			AnnotationCommit:        "abc123",
+		}, res.GetAnnotations())
+	}
+
+	// The time of the build is only recorded when given
+	built := time.Date(2024, 5, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	b, err = m.Bundle(WithProvenance(Provenance{BuildTime: built}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotEmpty(t, b.Resources())
+	for _, res := range b.Resources() {
+		assert.Equal(t, "2024-05-01T10:00:00Z", res.GetAnnotations()[AnnotationBuildTime])
+	}
+}
+
+func TestBundle_ProvenanceSealedSecrets(t *testing.T) {
+	makeSealedSecretsCert(t, "sealed-secrets.pem")
+	m := newModule(types.Module{Name: "test-namespace/test-secret-module", Version: "v1.0.0"})
+
+	// Secrets are sealed after every other option, the SealedSecret carries the provenance of the Secret
+	b, err := m.Bundle(
+		WithProvenance(Provenance{BananaVersion: "v0.5.0", Commit: "abc123"}),
+		WithSealedSecrets(testfs, "sealed-secrets.pem", SealedSecretScopeNamespaceWide),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed := b.FindByGVK(GroupVersionKind{"bitnami.com", "v1alpha1", "SealedSecret"})
+	if !assert.Len(t, sealed, 1) {
+		return
+	}
+	assert.Equal(t, map[string]string{
+		AnnotationBananaVersion:              "v0.5.0",
+		AnnotationModule:                     "test-namespace/test-secret-module",
+		AnnotationModuleVersion:              "v1.0.0",
+		AnnotationSource:                     "src",
+		AnnotationCommit:                     "abc123",
+		sealedSecretsAnnotationNamespaceWide: "true",
+	}, sealed[0].GetAnnotations())
+}
@@ -2,8 +2,6 @@ package module
 
 import (
 	"bytes"
-	"fmt"
-	"strings"
 
 	"sigs.k8s.io/kustomize/api/resource"
 )
@@ -12,8 +10,10 @@ type Resource struct {
 	*resource.Resource
 }
 
+// FileName returns the name of the file the resource is exported to in the flat layout, unless it has to be
+// qualified to tell it apart from other resources of the bundle
 func (r *Resource) FileName() string {
-	return strings.ToLower(fmt.Sprintf("%s_%s.yaml", r.GetKind(), r.GetName()))
+	return LayoutFlat.path(r, qualifyNone)
 }
 
 // FlattenSecure flattenes the resource returning a byte array containing a YAML representation of the resource.
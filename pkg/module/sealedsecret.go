@@ -0,0 +1,235 @@
+package module
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io"
+
+	"sigs.k8s.io/kustomize/api/resource"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// SealedSecretScope determines which names and namespaces a SealedSecret may be unsealed as.
+type SealedSecretScope string
+
+const (
+	// SealedSecretScopeStrict binds the secret to both its name and namespace
+	SealedSecretScopeStrict SealedSecretScope = "strict"
+	// SealedSecretScopeNamespaceWide allows the secret to be renamed within its namespace
+	SealedSecretScopeNamespaceWide SealedSecretScope = "namespace-wide"
+	// SealedSecretScopeClusterWide allows the secret to be unsealed in any namespace under any name
+	SealedSecretScopeClusterWide SealedSecretScope = "cluster-wide"
+)
+
+const (
+	sealedSecretsAnnotationNamespaceWide = "sealedsecrets.bitnami.com/namespace-wide"
+	sealedSecretsAnnotationClusterWide   = "sealedsecrets.bitnami.com/cluster-wide"
+	sealedSecretsSessionKeyBytes         = 32
+)
+
+// ParseSealedSecretScope returns the scope matching s. An empty string defaults to strict.
+func ParseSealedSecretScope(s string) (SealedSecretScope, error) {
+	switch SealedSecretScope(s) {
+	case "", SealedSecretScopeStrict:
+		return SealedSecretScopeStrict, nil
+	case SealedSecretScopeNamespaceWide, SealedSecretScopeClusterWide:
+		return SealedSecretScope(s), nil
+	}
+	return "", fmt.Errorf("unknown sealed secrets scope %q, must be one of %s, %s or %s", s, SealedSecretScopeStrict, SealedSecretScopeNamespaceWide, SealedSecretScopeClusterWide)
+}
+
+// label returns the label used as additional data when encrypting values for the given secret
+func (s SealedSecretScope) label(namespace, name string) []byte {
+	switch s {
+	case SealedSecretScopeClusterWide:
+		return []byte{}
+	case SealedSecretScopeNamespaceWide:
+		return []byte(namespace)
+	}
+	return []byte(fmt.Sprintf("%s/%s", namespace, name))
+}
+
+// parseSealedSecretsCert returns the RSA public key of the PEM encoded sealed-secrets controller certificate
+func parseSealedSecretsCert(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no PEM encoded certificate found")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("expected an RSA public key in certificate, got %T", cert.PublicKey)
+	}
+	return pub, nil
+}
+
+// hybridEncrypt encrypts plaintext the same way kubeseal does. A random session key is encrypted
+// with RSA-OAEP and prepended to the AES-GCM encrypted plaintext.
+func hybridEncrypt(rnd io.Reader, pub *rsa.PublicKey, plaintext, label []byte) ([]byte, error) {
+	sessionKey := make([]byte, sealedSecretsSessionKeyBytes)
+	if _, err := io.ReadFull(rnd, sessionKey); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	rsaCiphertext, err := rsa.EncryptOAEP(sha256.New(), rnd, pub, sessionKey, label)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext := make([]byte, 2)
+	binary.BigEndian.PutUint16(ciphertext, uint16(len(rsaCiphertext)))
+	ciphertext = append(ciphertext, rsaCiphertext...)
+
+	// The session key is only ever used once so a zero nonce is safe
+	zeroNonce := make([]byte, aead.NonceSize())
+	return aead.Seal(ciphertext, zeroNonce, plaintext, nil), nil
+}
+
+// sealSecret replaces the v1/Secret resource res with a SealedSecret holding the encrypted values of res
+func sealSecret(res *resource.Resource, pub *rsa.PublicKey, scope SealedSecretScope) error {
+	name, namespace := res.GetName(), res.GetNamespace()
+	if scope != SealedSecretScopeClusterWide && len(namespace) == 0 {
+		return fmt.Errorf("secret %s has no namespace which is required by the %s sealed secrets scope", name, scope)
+	}
+
+	plain := map[string][]byte{}
+	for k, v := range res.GetDataMap() {
+		d, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return fmt.Errorf("secret %s: value of key %s is not base64 encoded: %w", name, k, err)
+		}
+		plain[k] = d
+	}
+	stringData, err := res.Pipe(kyaml.Lookup("stringData"))
+	if err != nil {
+		return err
+	}
+	if stringData != nil {
+		err = stringData.VisitFields(func(n *kyaml.MapNode) error {
+			plain[n.Key.YNode().Value] = []byte(n.Value.YNode().Value)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	encryptedData := map[string]interface{}{}
+	for k, v := range plain {
+		out, err := hybridEncrypt(rand.Reader, pub, v, scope.label(namespace, name))
+		if err != nil {
+			return err
+		}
+		encryptedData[k] = base64.StdEncoding.EncodeToString(out)
+	}
+
+	// Metadata of the resulting Secret
+	templateMeta := map[string]interface{}{
+		"name": name,
+	}
+	if len(namespace) > 0 {
+		templateMeta["namespace"] = namespace
+	}
+	if labels := res.GetLabels(); len(labels) > 0 {
+		templateMeta["labels"] = labels
+	}
+	if annotations := res.GetAnnotations(); len(annotations) > 0 {
+		templateMeta["annotations"] = annotations
+	}
+	template := map[string]interface{}{
+		"metadata": templateMeta,
+	}
+	if t, err := res.GetString("type"); err == nil && len(t) > 0 {
+		template["type"] = t
+	}
+
+	// Metadata of the SealedSecret itself, carrying the provenance of the Secret so that it can be traced as well
+	meta := map[string]interface{}{
+		"name": name,
+	}
+	if len(namespace) > 0 {
+		meta["namespace"] = namespace
+	}
+	annotations := map[string]interface{}{}
+	for _, k := range provenanceAnnotations {
+		if v, ok := res.GetAnnotations()[k]; ok {
+			annotations[k] = v
+		}
+	}
+	switch scope {
+	case SealedSecretScopeNamespaceWide:
+		annotations[sealedSecretsAnnotationNamespaceWide] = "true"
+	case SealedSecretScopeClusterWide:
+		annotations[sealedSecretsAnnotationClusterWide] = "true"
+	}
+	if len(annotations) > 0 {
+		meta["annotations"] = annotations
+	}
+
+	sealed, err := kyaml.FromMap(map[string]interface{}{
+		"apiVersion": "bitnami.com/v1alpha1",
+		"kind":       "SealedSecret",
+		"metadata":   meta,
+		"spec": map[string]interface{}{
+			"encryptedData": encryptedData,
+			"template":      template,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	res.SetYNode(sealed.YNode())
+	return nil
+}
+
+// sealSecrets converts every v1/Secret in the bundle into a SealedSecret
+func (b *Bundle) sealSecrets() error {
+	for _, res := range b.FindByGVK(GroupVersionKind{"", "v1", "Secret"}) {
+		if err := sealSecret(res, b.sealCert, b.sealScope); err != nil {
+			return err
+		}
+		if err := b.applyGenerated(res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WithSealedSecrets configures the bundle to convert each v1/Secret into a bitnami.com/v1alpha1 SealedSecret.
+// Values are encrypted offline using the sealed-secrets controller certificate read from certFile on fs.
+func WithSealedSecrets(fs filesys.FileSystem, certFile string, scope SealedSecretScope) BundleOpts {
+	return func(b *Bundle) error {
+		data, err := fs.ReadFile(certFile)
+		if err != nil {
+			return err
+		}
+		pub, err := parseSealedSecretsCert(data)
+		if err != nil {
+			return fmt.Errorf("unable to read sealed secrets certificate %s: %w", certFile, err)
+		}
+		b.sealCert = pub
+		b.sealScope = scope
+		return nil
+	}
+}
@@ -0,0 +1,158 @@
+package module
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// makeSealedSecretsCert writes a self-signed certificate to testfs and returns its private key
+func makeSealedSecretsCert(t *testing.T, path string) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sealed-secret"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = testfs.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// hybridDecrypt is the inverse of hybridEncrypt
+func hybridDecrypt(t *testing.T, key *rsa.PrivateKey, ciphertext, label []byte) []byte {
+	l := int(binary.BigEndian.Uint16(ciphertext))
+	sessionKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, key, ciphertext[2:2+l], label)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher(sessionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := aead.Open(nil, make([]byte, aead.NonceSize()), ciphertext[2+l:], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return plain
+}
+
+func TestBundle_SealedSecrets(t *testing.T) {
+	key := makeSealedSecretsCert(t, "sealed-secrets.pem")
+
+	var tests = []struct {
+		name       string
+		scope      SealedSecretScope
+		label      string
+		annotation string
+	}{
+		{"strict", SealedSecretScopeStrict, "test-namespace/test-secret", ""},
+		{"namespace-wide", SealedSecretScopeNamespaceWide, "test-namespace", sealedSecretsAnnotationNamespaceWide},
+		{"cluster-wide", SealedSecretScopeClusterWide, "", sealedSecretsAnnotationClusterWide},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newModule(types.Module{Name: "test-namespace/test-secret-module"})
+			b, err := m.Bundle(
+				WithSecrets([]Secret{{Key: "PASSWORD", Value: "myownpassword"}}),
+				WithSealedSecrets(testfs, "sealed-secrets.pem", tt.scope),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Empty(t, b.FindByGVK(GroupVersionKind{"", "v1", "Secret"}))
+			sealed := b.FindByGVK(GroupVersionKind{"bitnami.com", "v1alpha1", "SealedSecret"})
+			if !assert.Len(t, sealed, 1) {
+				return
+			}
+			res := sealed[0]
+
+			if len(tt.annotation) > 0 {
+				assert.Equal(t, "true", res.GetAnnotations()[tt.annotation])
+			}
+
+			tmplType, err := res.GetString("spec.template.type")
+			assert.NoError(t, err)
+			assert.Equal(t, "Opaque", tmplType)
+
+			want := map[string]string{"USERNAME": "admin", "PASSWORD": "myownpassword"}
+			for k, v := range want {
+				enc, err := res.GetString("spec.encryptedData." + k)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ciphertext, err := base64.StdEncoding.DecodeString(enc)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, v, string(hybridDecrypt(t, key, ciphertext, []byte(tt.label))))
+			}
+		})
+	}
+}
+
+func TestBundle_SealedSecretsMetaData(t *testing.T) {
+	key := makeSealedSecretsCert(t, "sealed-secrets.pem")
+	secret := strings.Replace(secretData, "  namespace: test-namespace\n", "", 1)
+	if err := makeSingleModule("platform/test-metadata-module", []byte(secret)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The namespace is only given by the metadata, which is applied before secrets are sealed
+	m := newModule(types.Module{Name: "platform/test-metadata-module"})
+	b, err := m.Bundle(
+		WithMetaData(&types.ObjectMeta{Namespace: "platform", NamePrefix: "acme-"}),
+		WithSealedSecrets(testfs, "sealed-secrets.pem", SealedSecretScopeStrict),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "platform", b.Namespace())
+	sealed := b.FindByGVK(GroupVersionKind{"bitnami.com", "v1alpha1", "SealedSecret"})
+	if !assert.Len(t, sealed, 1) {
+		return
+	}
+	res := sealed[0]
+	assert.Equal(t, "acme-test-secret", res.GetName())
+	assert.Equal(t, "platform", res.GetNamespace())
+
+	enc, err := res.GetString("spec.encryptedData.USERNAME")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "admin", string(hybridDecrypt(t, key, ciphertext, []byte("platform/acme-test-secret"))))
+}
@@ -1,5 +1,14 @@
 package module
 
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// secretRefPrefix is the prefix of secret values referencing an external secret store
+const secretRefPrefix = "ref+"
+
 type Secret struct {
 	Key   string
 	Value string
@@ -8,5 +17,25 @@ type Secret struct {
 // IsFile returns true if secret is a path to a file. This is determined
 // by the key. If it is prefixed with '@' then the secret is assumed to be a path.
 func (s *Secret) IsFile() bool {
-	return s.Key[0:1] == "@"
+	return strings.HasPrefix(s.Key, "@")
+}
+
+// IsRef returns true if the value of the secret is a reference to an external secret store
+// rather than the value itself. For example ref+vault://kv/app#password
+func (s *Secret) IsRef() bool {
+	return strings.HasPrefix(s.Value, secretRefPrefix)
+}
+
+// RemoteRef returns the remote key and property of a secret reference. Given the value
+// ref+vault://kv/app#password the key is kv/app and the property is password.
+func (s *Secret) RemoteRef() (string, string, error) {
+	u, err := url.Parse(strings.TrimPrefix(s.Value, secretRefPrefix))
+	if err != nil {
+		return "", "", fmt.Errorf("invalid reference for secret %s: %w", s.Key, err)
+	}
+	key := strings.Trim(u.Host+u.Path, "/")
+	if len(u.Scheme) == 0 || len(key) == 0 {
+		return "", "", fmt.Errorf("invalid reference for secret %s: expected the form ref+<provider>://<key>[#<property>]", s.Key)
+	}
+	return key, u.Fragment, nil
 }
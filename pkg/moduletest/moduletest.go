@@ -0,0 +1,251 @@
+// Package moduletest runs golden file tests of modules. Test cases are directories in the tests directory of a module,
+// each holding a module entry of the banana file to build and the flattened output expected from building it.
+package moduletest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/middlewaregruppen/banana/pkg/module"
+	"github.com/pmezard/go-difflib/difflib"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const (
+	// TestsDir is the directory within a module holding its test cases
+	TestsDir = "tests"
+
+	// InputFile is the file of a test case holding the module entry to build
+	InputFile = "module.yaml"
+
+	// ExpectedFile is the file of a test case holding the expected flattened output
+	ExpectedFile = "expected.yaml"
+)
+
+// Case is a test case of a module
+type Case struct {
+	// Name is the name of the test case, which is the name of its directory
+	Name string
+
+	// Dir is the directory of the test case
+	Dir string
+
+	// Input is the module entry to build. Its name defaults to the name of the module tested.
+	Input types.Module
+}
+
+// Result is the outcome of running a test case
+type Result struct {
+	Case Case
+
+	// Passed is true if the output built matches the expected output
+	Passed bool
+
+	// Updated is true if the expected output was rewritten
+	Updated bool
+
+	// Diff is a unified diff between the expected and actual output of a failed test case
+	Diff string
+}
+
+// Runner runs the test cases of modules in a module repository
+type Runner struct {
+	fs     filesys.FileSystem
+	root   string
+	update bool
+}
+
+// RunnerOpts is options for the runner
+type RunnerOpts func(r *Runner)
+
+// WithUpdate returns a RunnerOpts that rewrites the expected output of test cases instead of comparing it
+func WithUpdate(update bool) RunnerOpts {
+	return func(r *Runner) {
+		r.update = update
+	}
+}
+
+// NewRunner returns a runner for the module repository at root on fs
+func NewRunner(fs filesys.FileSystem, root string, opts ...RunnerOpts) *Runner {
+	r := &Runner{fs: fs, root: root}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Cases returns the test cases of the module name, sorted by name
+func (r *Runner) Cases(name string) ([]Case, error) {
+	testsDir := path.Join(r.root, name, TestsDir)
+	if !r.fs.IsDir(testsDir) {
+		return nil, nil
+	}
+	entries, err := r.fs.ReadDir(testsDir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(entries)
+
+	var cases []Case
+	for _, e := range entries {
+		dir := path.Join(testsDir, e)
+		if !r.fs.IsDir(dir) {
+			continue
+		}
+		data, err := r.fs.ReadFile(path.Join(dir, InputFile))
+		if err != nil {
+			return nil, err
+		}
+		c := Case{Name: e, Dir: dir}
+		d := kyaml.NewDecoder(bytes.NewReader(data))
+		d.KnownFields(true)
+		if err := d.Decode(&c.Input); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("%s: %w", path.Join(dir, InputFile), err)
+		}
+		if len(c.Input.Name) == 0 {
+			c.Input.Name = name
+		}
+		cases = append(cases, c)
+	}
+	return cases, nil
+}
+
+// Run runs every test case of the module name
+func (r *Runner) Run(name string) ([]Result, error) {
+	cases, err := r.Cases(name)
+	if err != nil {
+		return nil, err
+	}
+	var results []Result
+	for _, c := range cases {
+		res, err := r.run(c)
+		if err != nil {
+			return nil, fmt.Errorf("%s/%s: %w", name, c.Name, err)
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+func (r *Runner) run(c Case) (Result, error) {
+	actual, err := Build(r.fs, r.root, c.Input)
+	if err != nil {
+		return Result{}, err
+	}
+	expectedFile := path.Join(c.Dir, ExpectedFile)
+	if r.update {
+		return Result{Case: c, Passed: true, Updated: true}, r.fs.WriteFile(expectedFile, actual)
+	}
+
+	var expected []byte
+	if r.fs.Exists(expectedFile) {
+		if expected, err = r.fs.ReadFile(expectedFile); err != nil {
+			return Result{}, err
+		}
+	}
+	diff, err := Diff(expected, actual)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Case: c, Passed: len(diff) == 0, Diff: diff}, nil
+}
+
+// Build copies the module mod from the module repository at root on fs into memory and returns it bundled and flattened
+func Build(fs filesys.FileSystem, root string, mod types.Module) ([]byte, error) {
+	memfs := filesys.MakeFsInMemory()
+	src := path.Join(root, mod.Name)
+	err := fs.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		content, err := fs.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		// Paths walked on an in-memory filesystem are absolute even if src is not
+		rel := strings.TrimPrefix(strings.TrimPrefix(p, "/"), strings.TrimPrefix(path.Clean(src), "/"))
+		dst := path.Join(mod.Name, rel)
+		if err := memfs.MkdirAll(path.Dir(dst)); err != nil {
+			return err
+		}
+		return memfs.WriteFile(dst, content)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	m := module.NewKustomizeModule(memfs, mod, "")
+	b, err := m.Bundle(module.WithSecrets(m.Secrets()), module.WithURLs(m.Host()))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := b.Flatten(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Diff returns a unified diff between the yaml documents expected and actual, or an empty string if they are equal.
+// Documents are compared by content so that differences in key order, formatting and comments are ignored.
+func Diff(expected, actual []byte) (string, error) {
+	e, err := normalize(expected)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse expected output: %w", err)
+	}
+	a, err := normalize(actual)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse actual output: %w", err)
+	}
+	if e == a {
+		return "", nil
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        lines(e),
+		B:        lines(a),
+		FromFile: "expected",
+		ToFile:   "actual",
+		Context:  3,
+	})
+}
+
+// normalize decodes every document in data and encodes them again with sorted keys and without comments
+func normalize(data []byte) (string, error) {
+	d := kyaml.NewDecoder(bytes.NewReader(data))
+	var docs []string
+	for {
+		var v interface{}
+		err := d.Decode(&v)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if v == nil {
+			continue
+		}
+		out, err := kyaml.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		docs = append(docs, string(out))
+	}
+	return strings.Join(docs, "---\n"), nil
+}
+
+// lines splits s into lines, each ending with a newline
+func lines(s string) []string {
+	l := strings.SplitAfter(s, "\n")
+	if len(l) > 0 && len(l[len(l)-1]) == 0 {
+		l = l[:len(l)-1]
+	}
+	return l
+}
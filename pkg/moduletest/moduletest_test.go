@@ -0,0 +1,101 @@
+package moduletest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+var testFiles = map[string]string{
+	"modules/test/app/kustomization.yaml": `resources:
+- secret.yaml
+`,
+	"modules/test/app/secret.yaml": `apiVersion: v1
+kind: Secret
+metadata:
+  name: app
+data:
+  PASSWORD: Q0hBTkdFX01F
+`,
+	"modules/test/app/tests/password/module.yaml": `namespace: apps
+secrets:
+- key: PASSWORD
+  value: password
+`,
+	// Key order and comments differ from the built output
+	"modules/test/app/tests/password/expected.yaml": `# The secret
+kind: Secret
+apiVersion: v1
+metadata:
+  namespace: apps
+  name: app
+data:
+  PASSWORD: cGFzc3dvcmQ=
+`,
+	"modules/test/app/tests/wrong/module.yaml": `namespace: other
+`,
+	"modules/test/app/tests/wrong/expected.yaml": `apiVersion: v1
+kind: Secret
+metadata:
+  name: app
+  namespace: apps
+data:
+  PASSWORD: Q0hBTkdFX01F
+`,
+}
+
+func makeRepo(t *testing.T) filesys.FileSystem {
+	fs := filesys.MakeFsInMemory()
+	for p, data := range testFiles {
+		assert.NoError(t, fs.WriteFile(p, []byte(data)))
+	}
+	return fs
+}
+
+func TestRun(t *testing.T) {
+	fs := makeRepo(t)
+	results, err := NewRunner(fs, "modules").Run("test/app")
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+
+	assert.Equal(t, "password", results[0].Case.Name)
+	assert.Equal(t, "test/app", results[0].Case.Input.Name)
+	assert.True(t, results[0].Passed)
+	assert.Empty(t, results[0].Diff)
+
+	assert.Equal(t, "wrong", results[1].Case.Name)
+	assert.False(t, results[1].Passed)
+	assert.Contains(t, results[1].Diff, "-  namespace: apps\n+  namespace: other\n")
+
+	// Updating rewrites the expected output so that every test case passes
+	results, err = NewRunner(fs, "modules", WithUpdate(true)).Run("test/app")
+	assert.NoError(t, err)
+	assert.True(t, results[1].Updated)
+	results, err = NewRunner(fs, "modules").Run("test/app")
+	assert.NoError(t, err)
+	assert.True(t, results[0].Passed)
+	assert.True(t, results[1].Passed)
+
+	// Modules without tests have no test cases
+	results, err = NewRunner(fs, "modules").Run("test/other")
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func TestCasesUnknownField(t *testing.T) {
+	fs := makeRepo(t)
+	assert.NoError(t, fs.WriteFile("modules/test/app/tests/password/module.yaml", []byte("namespaces: apps\n")))
+	_, err := NewRunner(fs, "modules").Cases("test/app")
+	assert.ErrorContains(t, err, "field namespaces not found")
+}
+
+func TestDiff(t *testing.T) {
+	diff, err := Diff([]byte("a: 1\nb: 2\n---\nc: 3\n"), []byte("b: 2\na: 1\n---\n# comment\nc: 3\n"))
+	assert.NoError(t, err)
+	assert.Empty(t, diff)
+
+	diff, err = Diff([]byte("a: 1\n"), []byte("a: 1\n---\nc: 3\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "--- expected\n+++ actual\n@@ -1 +1,3 @@\n a: 1\n+---\n+c: 3\n", diff)
+}
@@ -0,0 +1,116 @@
+// Package scaffold generates new modules for module authors
+package scaffold
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"text/template"
+
+	"github.com/middlewaregruppen/banana/api/types"
+	"github.com/middlewaregruppen/banana/pkg/moduletest"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const (
+	// ExampleComponent is the name of the component generated in new modules
+	ExampleComponent = "example"
+
+	defaultTest = "default"
+)
+
+var nameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?/[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// data is passed to the templates of the module files
+type data struct {
+	Name      string
+	ShortName string
+	Component string
+}
+
+// Init generates the module name, in the form of <category>/<name>, in the module repository at root.
+// Returns the paths of the files created. Fails if the module directory already exists.
+func Init(fs filesys.FileSystem, root, name string) ([]string, error) {
+	if !nameRegexp.MatchString(name) {
+		return nil, fmt.Errorf("invalid module name %q, expected <category>/<name> of lower case alphanumeric characters or '-'", name)
+	}
+	dir := path.Join(root, name)
+	if fs.Exists(dir) {
+		return nil, fmt.Errorf("%s already exists", dir)
+	}
+
+	d := data{
+		Name:      name,
+		ShortName: path.Base(name),
+		Component: ExampleComponent,
+	}
+	var created []string
+	for p, t := range templates {
+		p, err := execute(p, d)
+		if err != nil {
+			return nil, err
+		}
+		content, err := execute(t, d)
+		if err != nil {
+			return nil, err
+		}
+		f := path.Join(dir, p)
+		if err := write(fs, f, []byte(content)); err != nil {
+			return nil, err
+		}
+		created = append(created, f)
+	}
+
+	// Golden test built from the generated module
+	mod := types.Module{
+		Name:       name,
+		Namespace:  d.ShortName,
+		Components: []types.Component{{Name: ExampleComponent}},
+		Hosts:      &types.Host{Prefix: "test"},
+		Secrets: []types.Secret{
+			{Key: "USERNAME", Value: "admin"},
+			{Key: "PASSWORD", Value: "password"},
+		},
+	}
+	input, err := kyaml.Marshal(mod)
+	if err != nil {
+		return nil, err
+	}
+	expected, err := moduletest.Build(fs, root, mod)
+	if err != nil {
+		return nil, fmt.Errorf("unable to build the generated module: %w", err)
+	}
+	testDir := path.Join(dir, moduletest.TestsDir, defaultTest)
+	for f, content := range map[string][]byte{moduletest.InputFile: input, moduletest.ExpectedFile: expected} {
+		f = path.Join(testDir, f)
+		if err := write(fs, f, content); err != nil {
+			return nil, err
+		}
+		created = append(created, f)
+	}
+
+	sort.Strings(created)
+	return created, nil
+}
+
+func execute(text string, d data) (string, error) {
+	t, err := template.New("").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, d); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func write(fs filesys.FileSystem, p string, content []byte) error {
+	if err := fs.MkdirAll(path.Dir(p)); err != nil {
+		return err
+	}
+	return fs.WriteFile(p, content)
+}
@@ -0,0 +1,48 @@
+package scaffold
+
+import (
+	"testing"
+
+	"github.com/middlewaregruppen/banana/pkg/catalog"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+func TestInit(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	created, err := Init(fs, "modules", "monitoring/grafana")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"modules/monitoring/grafana/banana-module.yaml",
+		"modules/monitoring/grafana/deployment.yaml",
+		"modules/monitoring/grafana/example/kustomization.yaml",
+		"modules/monitoring/grafana/ingress.yaml",
+		"modules/monitoring/grafana/kustomization.yaml",
+		"modules/monitoring/grafana/secret.yaml",
+		"modules/monitoring/grafana/service.yaml",
+		"modules/monitoring/grafana/tests/default/expected.yaml",
+		"modules/monitoring/grafana/tests/default/module.yaml",
+	}, created)
+
+	expected, err := fs.ReadFile("modules/monitoring/grafana/tests/default/expected.yaml")
+	assert.NoError(t, err)
+	assert.Contains(t, string(expected), "host: test-grafana")
+	assert.Contains(t, string(expected), "replicas: 2")
+	assert.Contains(t, string(expected), "PASSWORD: cGFzc3dvcmQ=")
+
+	// The module is found in the module repository along with its component and metadata
+	c, err := catalog.Discover(fs, "modules")
+	assert.NoError(t, err)
+	assert.Len(t, c.Modules, 1)
+	assert.Equal(t, "monitoring/grafana", c.Modules[0].Name)
+	assert.Equal(t, []string{ExampleComponent}, c.Modules[0].Components)
+	assert.Len(t, c.Modules[0].Secrets, 2)
+
+	_, err = Init(fs, "modules", "monitoring/grafana")
+	assert.EqualError(t, err, "modules/monitoring/grafana already exists")
+
+	for _, name := range []string{"grafana", "monitoring/grafana/dashboards", "Monitoring/grafana", "monitoring/-grafana"} {
+		_, err = Init(fs, "modules", name)
+		assert.Error(t, err, name)
+	}
+}
@@ -0,0 +1,118 @@
+package scaffold
+
+// Templates of the files of a new module, keyed by their path relative to the module directory.
+// Values marked with CHANGE_ME are placeholders the module author is expected to replace.
+var templates = map[string]string{
+	"kustomization.yaml": `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+resources:
+- deployment.yaml
+- service.yaml
+- ingress.yaml
+- secret.yaml
+`,
+
+	"deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .ShortName }}
+  labels:
+    app.kubernetes.io/name: {{ .ShortName }}
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app.kubernetes.io/name: {{ .ShortName }}
+  template:
+    metadata:
+      labels:
+        app.kubernetes.io/name: {{ .ShortName }}
+    spec:
+      containers:
+      - name: {{ .ShortName }}
+        # CHANGE_ME: the image of {{ .Name }}
+        image: nginx:stable
+        ports:
+        - name: http
+          containerPort: 80
+        envFrom:
+        - secretRef:
+            name: {{ .ShortName }}
+`,
+
+	"service.yaml": `apiVersion: v1
+kind: Service
+metadata:
+  name: {{ .ShortName }}
+  labels:
+    app.kubernetes.io/name: {{ .ShortName }}
+spec:
+  selector:
+    app.kubernetes.io/name: {{ .ShortName }}
+  ports:
+  - name: http
+    port: 80
+    targetPort: http
+`,
+
+	// The host is rewritten by banana using the hosts of the module
+	"ingress.yaml": `apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: {{ .ShortName }}
+  labels:
+    app.kubernetes.io/name: {{ .ShortName }}
+spec:
+  rules:
+  - host: {{ .ShortName }}
+    http:
+      paths:
+      - path: /
+        pathType: Prefix
+        backend:
+          service:
+            name: {{ .ShortName }}
+            port:
+              name: http
+`,
+
+	// Keys are declared with placeholder values that users override with the secrets of the module
+	"secret.yaml": `apiVersion: v1
+kind: Secret
+metadata:
+  name: {{ .ShortName }}
+  labels:
+    app.kubernetes.io/name: {{ .ShortName }}
+type: Opaque
+data:
+  # CHANGE_ME
+  USERNAME: Q0hBTkdFX01F
+  # CHANGE_ME
+  PASSWORD: Q0hBTkdFX01F
+`,
+
+	"{{ .Component }}/kustomization.yaml": `apiVersion: kustomize.config.k8s.io/v1alpha1
+kind: Component
+patches:
+- target:
+    kind: Deployment
+    name: {{ .ShortName }}
+  patch: |-
+    - op: replace
+      path: /spec/replicas
+      value: 2
+`,
+
+	"banana-module.yaml": `kind: BananaModule
+apiVersion: banana.io/v1beta1
+# CHANGE_ME: a short description of {{ .Name }}
+description: {{ .Name }}
+secrets:
+- key: USERNAME
+  description: Username of {{ .ShortName }}
+  required: true
+- key: PASSWORD
+  description: Password of {{ .ShortName }}
+  required: true
+`,
+}